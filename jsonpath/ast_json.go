@@ -0,0 +1,442 @@
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ASTVersion is the version of the JSON encoding of programs written by
+// Program.MarshalJSON. It changes whenever the encoding does in a way older
+// decoders wouldn't understand.
+//
+// A program is encoded as
+//
+//	{"version": 1, "mode": "lax" | "strict", "implicit": bool, "root": node}
+//
+// where implicit is left out when false, and each node is an object whose
+// "type" says which of the following it is. Fields holding nodes are marked
+// expr, pred or accessor for the kind of node they hold.
+//
+//	{"type": "binary", "op": "+" | "-" | "*" | "/" | "%", "left": expr, "right": expr}
+//	{"type": "unary", "op": "-" | "+", "expr": expr}
+//	{"type": "number", "value": string}, the number in decimal, as a string so
+//	  that it's exact
+//	{"type": "string", "value": string}
+//	{"type": "bool", "value": bool}
+//	{"type": "null"}
+//	{"type": "variable", "name": string}, where name is "$", "@" or "$" and
+//	  the name of a named variable
+//	{"type": "last"}
+//	{"type": "access", "left": expr, "right": accessor}
+//	{"type": "member", "name": string, "quoted": bool}, `.name`, where quoted
+//	  is left out when false
+//	{"type": "member_wildcard"}, `.*`
+//	{"type": "subscripts", "subscripts": [subscript, ...]}, `[...]`, where each
+//	  subscript is {"type": "subscript", "start": expr, "end": expr}, and end is
+//	  left out unless it's a range
+//	{"type": "array_wildcard"}, `[*]`
+//	{"type": "recursive_wildcard", "first": int, "last": int}, `.**`, where a
+//	  level is left out when it's `last`
+//	{"type": "method", "name": string, "args": [node, ...]}, where args is
+//	  left out when empty
+//	{"type": "filter", "pred": pred}
+//	{"type": "comparison", "op": "==" | "!=" | ">" | ">=" | "<" | "<=", "left": expr, "right": expr}
+//	{"type": "logic", "op": "&&" | "||", "left": pred, "right": pred}
+//	{"type": "not", "pred": pred}
+//	{"type": "exists", "expr": expr}
+//	{"type": "like_regex", "left": expr, "pattern": string, "flag": string},
+//	  where flag is left out when empty
+//	{"type": "starts_with", "left": expr, "right": expr}
+//	{"type": "is_unknown", "pred": pred}
+const ASTVersion = 1
+
+type programJSON struct {
+	Version  int       `json:"version"`
+	Mode     string    `json:"mode"`
+	Implicit bool      `json:"implicit,omitempty"`
+	Root     *nodeJSON `json:"root"`
+}
+
+// nodeJSON holds the fields of every type of node, of which each uses only
+// a few.
+type nodeJSON struct {
+	Type       string          `json:"type"`
+	Op         string          `json:"op,omitempty"`
+	Name       *string         `json:"name,omitempty"`
+	Quoted     bool            `json:"quoted,omitempty"`
+	Value      json.RawMessage `json:"value,omitempty"`
+	Left       *nodeJSON       `json:"left,omitempty"`
+	Right      *nodeJSON       `json:"right,omitempty"`
+	Expr       *nodeJSON       `json:"expr,omitempty"`
+	Pred       *nodeJSON       `json:"pred,omitempty"`
+	Start      *nodeJSON       `json:"start,omitempty"`
+	End        *nodeJSON       `json:"end,omitempty"`
+	Subscripts []*nodeJSON     `json:"subscripts,omitempty"`
+	First      *int            `json:"first,omitempty"`
+	Last       *int            `json:"last,omitempty"`
+	Args       []*nodeJSON     `json:"args,omitempty"`
+	Pattern    *string         `json:"pattern,omitempty"`
+	Flag       string          `json:"flag,omitempty"`
+}
+
+var modeNames = [...]string{ModeLax: "lax", ModeStrict: "strict"}
+
+// MarshalJSON encodes the program as described by ASTVersion.
+func (p Program) MarshalJSON() ([]byte, error) {
+	root, err := encodeNode(p.Root)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(programJSON{
+		Version:  ASTVersion,
+		Mode:     modeNames[p.Mode],
+		Implicit: p.Implicit,
+		Root:     root,
+	})
+}
+
+// UnmarshalJSON decodes a program encoded as described by ASTVersion, and
+// checks it with Validate.
+func (p *Program) UnmarshalJSON(data []byte) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	var j programJSON
+	if err := d.Decode(&j); err != nil {
+		return err
+	}
+	if j.Version != ASTVersion {
+		return fmt.Errorf("unsupported jsonpath AST version %d, expected %d", j.Version, ASTVersion)
+	}
+	mode, ok := lookup(modeNames[:], j.Mode)
+	if !ok {
+		return fmt.Errorf("invalid mode %q", j.Mode)
+	}
+	root, err := j.Root.expr("program", "root")
+	if err != nil {
+		return err
+	}
+	prog := Program{Mode: Mode(mode), Root: root, Implicit: j.Implicit}
+	if errs := Validate(prog); len(errs) > 0 {
+		return errs[0]
+	}
+	*p = prog
+	return nil
+}
+
+func lookup(names []string, s string) (int, bool) {
+	for i, name := range names {
+		if name == s {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func levelPtr(level int) *int {
+	if level == LastLevel {
+		return nil
+	}
+	return &level
+}
+
+func encodeNode(n Node) (*nodeJSON, error) {
+	var err error
+	enc := func(n Node) *nodeJSON {
+		var j *nodeJSON
+		if err == nil {
+			j, err = encodeNode(n)
+		}
+		return j
+	}
+	var j *nodeJSON
+	switch t := n.(type) {
+	case BinExpr:
+		j = &nodeJSON{Type: "binary", Op: t.Op.String(), Left: enc(t.Left), Right: enc(t.Right)}
+	case UnaryExpr:
+		j = &nodeJSON{Type: "unary", Op: t.Op.String(), Expr: enc(t.Expr)}
+	case NumberExpr:
+		j = &nodeJSON{Type: "number"}
+		j.Value, err = json.Marshal(t.String())
+	case StringExpr:
+		j = &nodeJSON{Type: "string"}
+		j.Value, err = json.Marshal(t.Value)
+	case BoolExpr:
+		j = &nodeJSON{Type: "bool"}
+		j.Value, err = json.Marshal(t.Value)
+	case NullExpr:
+		j = &nodeJSON{Type: "null"}
+	case VariableExpr:
+		j = &nodeJSON{Type: "variable", Name: stringPtr(t.Name)}
+	case LastExpr:
+		j = &nodeJSON{Type: "last"}
+	case AccessExpr:
+		j = &nodeJSON{Type: "access", Left: enc(t.Left), Right: enc(t.Right)}
+	case DotAccessor:
+		j = &nodeJSON{Type: "member", Name: stringPtr(t.Name), Quoted: t.Quoted}
+	case MemberWildcardAccessor:
+		j = &nodeJSON{Type: "member_wildcard"}
+	case ArrayAccessor:
+		j = &nodeJSON{Type: "subscripts", Subscripts: make([]*nodeJSON, len(t.Subscripts))}
+		for i, s := range t.Subscripts {
+			j.Subscripts[i] = enc(s)
+		}
+	case RangeSubscriptNode:
+		j = &nodeJSON{Type: "subscript", Start: enc(t.Start)}
+		if t.End != nil {
+			j.End = enc(t.End)
+		}
+	case WildcardArrayAccessor:
+		j = &nodeJSON{Type: "array_wildcard"}
+	case RecursiveWildcardAccessor:
+		j = &nodeJSON{Type: "recursive_wildcard", First: levelPtr(t.First), Last: levelPtr(t.Last)}
+	case FuncNode:
+		j = &nodeJSON{Type: "method", Name: stringPtr(t.Func.String())}
+		for _, a := range t.Args {
+			j.Args = append(j.Args, enc(a))
+		}
+	case FilterNode:
+		j = &nodeJSON{Type: "filter", Pred: enc(t.Pred)}
+	case BinPred:
+		j = &nodeJSON{Type: "comparison", Op: t.Op.String(), Left: enc(t.Left), Right: enc(t.Right)}
+	case BinLogic:
+		j = &nodeJSON{Type: "logic", Op: t.Op.String(), Left: enc(t.Left), Right: enc(t.Right)}
+	case UnaryNot:
+		j = &nodeJSON{Type: "not", Pred: enc(t.Pred)}
+	case ExistsNode:
+		j = &nodeJSON{Type: "exists", Expr: enc(t.Expr)}
+	case LikeRegexNode:
+		j = &nodeJSON{Type: "like_regex", Left: enc(t.Left), Pattern: stringPtr(t.Pattern), Flag: t.Flag}
+	case StartsWithNode:
+		j = &nodeJSON{Type: "starts_with", Left: enc(t.Left), Right: enc(t.Right)}
+	case IsUnknownNode:
+		j = &nodeJSON{Type: "is_unknown", Pred: enc(t.Pred)}
+	case ParenExpr:
+		// Parentheses don't change the meaning, so they're left out, as
+		// FormatNode leaves them out.
+		return encodeNode(t.Expr)
+	case ParenPred:
+		return encodeNode(t.Pred)
+	case BadNode:
+		return nil, errors.New("cannot encode a jsonpath containing syntax errors")
+	default:
+		return nil, fmt.Errorf("cannot encode %T", n)
+	}
+	return j, err
+}
+
+func (j *nodeJSON) expr(parent, field string) (Expr, error) {
+	n, err := j.child(parent, field)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := n.(Expr)
+	if !ok {
+		return nil, fmt.Errorf("the %s of %s must be an expression, but has type %q", field, parent, j.Type)
+	}
+	return e, nil
+}
+
+func (j *nodeJSON) pred(parent, field string) (Pred, error) {
+	n, err := j.child(parent, field)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := n.(Pred)
+	if !ok {
+		return nil, fmt.Errorf("the %s of %s must be a predicate, but has type %q", field, parent, j.Type)
+	}
+	return p, nil
+}
+
+func (j *nodeJSON) accessor(parent, field string) (Accessor, error) {
+	n, err := j.child(parent, field)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := n.(Accessor)
+	if !ok {
+		return nil, fmt.Errorf("the %s of %s must be an accessor, but has type %q", field, parent, j.Type)
+	}
+	return a, nil
+}
+
+func (j *nodeJSON) child(parent, field string) (Node, error) {
+	if j == nil {
+		return nil, fmt.Errorf("%s node is missing its %s", parent, field)
+	}
+	return j.node()
+}
+
+func (j *nodeJSON) name() (string, error) {
+	if j.Name == nil {
+		return "", fmt.Errorf("%s node is missing its name", j.Type)
+	}
+	return *j.Name, nil
+}
+
+func (j *nodeJSON) op(ops []string) (int, error) {
+	op, ok := lookup(ops, j.Op)
+	if !ok {
+		return 0, fmt.Errorf("invalid operator %q for a %s node", j.Op, j.Type)
+	}
+	return op, nil
+}
+
+func (j *nodeJSON) value(v interface{}) error {
+	if j.Value == nil {
+		return fmt.Errorf("%s node is missing its value", j.Type)
+	}
+	if err := json.Unmarshal(j.Value, v); err != nil {
+		return fmt.Errorf("invalid value for a %s node: %v", j.Type, err)
+	}
+	return nil
+}
+
+func level(l *int) int {
+	if l == nil {
+		return LastLevel
+	}
+	return *l
+}
+
+func (j *nodeJSON) node() (Node, error) {
+	var err error
+	// Each of these keeps the first error, so that a node can be built from
+	// its fields before checking it.
+	expr := func(field string, child *nodeJSON) Expr {
+		var e Expr
+		if err == nil {
+			e, err = child.expr(j.Type, field)
+		}
+		return e
+	}
+	pred := func(field string, child *nodeJSON) Pred {
+		var p Pred
+		if err == nil {
+			p, err = child.pred(j.Type, field)
+		}
+		return p
+	}
+	op := func(ops []string) int {
+		var op int
+		if err == nil {
+			op, err = j.op(ops)
+		}
+		return op
+	}
+
+	var n Node
+	switch j.Type {
+	case "binary":
+		n = BinExpr{Op: BinExprType(op(binExprOps[:])), Left: expr("left", j.Left), Right: expr("right", j.Right)}
+	case "unary":
+		n = UnaryExpr{Op: UnaryExprType(op(unaryExprOps[:])), Expr: expr("expr", j.Expr)}
+	case "number":
+		var s string
+		if err = j.value(&s); err == nil {
+			n, err = NewNumberExpr(s)
+		}
+	case "string":
+		var s string
+		err = j.value(&s)
+		n = StringExpr{Value: s}
+	case "bool":
+		var b bool
+		err = j.value(&b)
+		n = BoolExpr{Value: b}
+	case "null":
+		n = NullExpr{}
+	case "variable":
+		var name string
+		name, err = j.name()
+		n = VariableExpr{Name: name}
+	case "last":
+		n = LastExpr{}
+	case "access":
+		left := expr("left", j.Left)
+		if err == nil {
+			var right Accessor
+			right, err = j.Right.accessor(j.Type, "right")
+			n = AccessExpr{Left: left, Right: right}
+		}
+	case "member":
+		var name string
+		name, err = j.name()
+		n = DotAccessor{Name: name, Quoted: j.Quoted}
+	case "member_wildcard":
+		n = MemberWildcardAccessor{}
+	case "subscripts":
+		a := ArrayAccessor{Subscripts: make([]RangeSubscriptNode, len(j.Subscripts))}
+		for i, s := range j.Subscripts {
+			if err != nil {
+				break
+			}
+			if s == nil || s.Type != "subscript" {
+				return nil, errors.New("the subscripts of a subscripts node must be subscript nodes")
+			}
+			a.Subscripts[i] = RangeSubscriptNode{Start: expr("start", s.Start)}
+			if s.End != nil {
+				a.Subscripts[i].End = expr("end", s.End)
+			}
+		}
+		n = a
+	case "array_wildcard":
+		n = WildcardArrayAccessor{}
+	case "recursive_wildcard":
+		n = RecursiveWildcardAccessor{First: level(j.First), Last: level(j.Last)}
+	case "method":
+		var name string
+		name, err = j.name()
+		f := -1
+		for k, v := range functionNames {
+			if v == name {
+				f = int(k)
+			}
+		}
+		if err == nil && f < 0 {
+			err = fmt.Errorf("unknown item method %q", name)
+		}
+		var args []Node
+		for _, a := range j.Args {
+			if err != nil {
+				break
+			}
+			args = append(args, expr("argument", a))
+		}
+		n = NewFuncNode(Function(f), args...)
+	case "filter":
+		n = FilterNode{Pred: pred("pred", j.Pred)}
+	case "comparison":
+		n = BinPred{Op: BinPredType(op(binPredOps[:])), Left: expr("left", j.Left), Right: expr("right", j.Right)}
+	case "logic":
+		n = BinLogic{Op: BinLogicType(op(binLogicOps[:])), Left: pred("left", j.Left), Right: pred("right", j.Right)}
+	case "not":
+		n = UnaryNot{Pred: pred("pred", j.Pred)}
+	case "exists":
+		n = ExistsNode{Expr: expr("expr", j.Expr)}
+	case "like_regex":
+		left := expr("left", j.Left)
+		if err == nil && j.Pattern == nil {
+			err = errors.New("like_regex node is missing its pattern")
+		}
+		if err == nil {
+			n, err = NewLikeRegexNode(left, *j.Pattern, j.Flag)
+		}
+	case "starts_with":
+		n = StartsWithNode{Left: expr("left", j.Left), Right: expr("right", j.Right)}
+	case "is_unknown":
+		n = IsUnknownNode{Pred: pred("pred", j.Pred)}
+	default:
+		return nil, fmt.Errorf("unknown node type %q", j.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
@@ -0,0 +1,96 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestProgramJSON(t *testing.T) {
+	p, err := Parse(`strict $.a[1, 2 to last].**{1}?(@.b == "x" && !exists (@.c) || @ like_regex "^a" flag "i").decimal(5, -2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"version":1,"mode":"strict","root":{"type":"access","left":{"type":"access","left":{"type":"access","left":{"type":"access","left":` +
+		`{"type":"access","left":{"type":"variable","name":"$"},"right":{"type":"member","name":"a"}},` +
+		`"right":{"type":"subscripts","subscripts":[{"type":"subscript","start":{"type":"number","value":"1"}},{"type":"subscript","start":{"type":"number","value":"2"},"end":{"type":"last"}}]}},` +
+		`"right":{"type":"recursive_wildcard","first":1,"last":1}},` +
+		`"right":{"type":"filter","pred":{"type":"logic","op":"||",` +
+		`"left":{"type":"logic","op":"\u0026\u0026","left":{"type":"comparison","op":"==","left":{"type":"access","left":{"type":"variable","name":"@"},"right":{"type":"member","name":"b"}},"right":{"type":"string","value":"x"}},` +
+		`"right":{"type":"not","pred":{"type":"exists","expr":{"type":"access","left":{"type":"variable","name":"@"},"right":{"type":"member","name":"c"}}}}},` +
+		`"right":{"type":"like_regex","left":{"type":"variable","name":"@"},"pattern":"^a","flag":"i"}}}},` +
+		`"right":{"type":"method","name":"decimal","args":[{"type":"number","value":"5"},{"type":"number","value":"-2"}]}}}`
+	if string(res) != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, res)
+	}
+
+	var decoded Program
+	if err := json.Unmarshal(res, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, p) {
+		t.Fatalf("expected `%s`, got `%s`", FormatNode(p), FormatNode(decoded))
+	}
+}
+
+func TestProgramJSONRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		g := &astGenerator{r: r}
+		p := NewProgram(Mode(r.Intn(2)), g.expr(4))
+		p.Implicit = r.Intn(2) == 0
+		res, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("could not encode `%s`: %v", FormatNode(p), err)
+		}
+		var decoded Program
+		if err := json.Unmarshal(res, &decoded); err != nil {
+			t.Fatalf("could not decode %s: %v", res, err)
+		}
+		if !reflect.DeepEqual(decoded, p) {
+			t.Fatalf("%s decoded as `%s`, rather than `%s`", res, FormatNode(decoded), FormatNode(p))
+		}
+	}
+}
+
+func TestProgramJSONErrors(t *testing.T) {
+	testCases := []struct {
+		input  string
+		errMsg string
+	}{
+		{`{"version":2,"mode":"lax","root":{"type":"null"}}`, "unsupported jsonpath AST version 2, expected 1"},
+		{`{"mode":"lax","root":{"type":"null"}}`, "unsupported jsonpath AST version 0, expected 1"},
+		{`{"version":1,"mode":"loose","root":{"type":"null"}}`, "invalid mode \"loose\""},
+		{`{"version":1,"mode":"lax"}`, "program node is missing its root"},
+		{`{"version":1,"mode":"lax","root":{"type":"nil"}}`, "unknown node type \"nil\""},
+		{`{"version":1,"mode":"lax","root":{"type":"null","extra":1}}`, "json: unknown field \"extra\""},
+		{`{"version":1,"mode":"lax","root":{"type":"binary","op":"^","left":{"type":"null"},"right":{"type":"null"}}}`, "invalid operator \"^\" for a binary node"},
+		{`{"version":1,"mode":"lax","root":{"type":"binary","op":"+","left":{"type":"null"}}}`, "binary node is missing its right"},
+		{`{"version":1,"mode":"lax","root":{"type":"exists","expr":{"type":"null"}}}`, "the root of program must be an expression, but has type \"exists\""},
+		{`{"version":1,"mode":"lax","root":{"type":"access","left":{"type":"variable","name":"$"},"right":{"type":"null"}}}`, "the right of access must be an accessor, but has type \"null\""},
+		{`{"version":1,"mode":"lax","root":{"type":"number","value":"1e"}}`, "invalid number \"1e\""},
+		{`{"version":1,"mode":"lax","root":{"type":"number","value":1}}`, "invalid value for a number node: json: cannot unmarshal number into Go value of type string"},
+		{`{"version":1,"mode":"lax","root":{"type":"variable"}}`, "variable node is missing its name"},
+		{`{"version":1,"mode":"lax","root":{"type":"variable","name":"@"}}`, "@ only allowed within filter expressions"},
+		{`{"version":1,"mode":"lax","root":{"type":"access","left":{"type":"variable","name":"$"},"right":{"type":"method","name":"length"}}}`, "unknown item method \"length\""},
+		{`{"version":1,"mode":"lax","root":{"type":"access","left":{"type":"variable","name":"$"},"right":{"type":"subscripts","subscripts":[{"type":"last"}]}}}`, "the subscripts of a subscripts node must be subscript nodes"},
+		{`{"version":1,"mode":"lax","root":{"type":"access","left":{"type":"variable","name":"$"},"right":{"type":"filter","pred":{"type":"like_regex","left":{"type":"variable","name":"@"},"pattern":"("}}}}`, "error parsing regexp: missing closing ): `(`"},
+	}
+
+	for _, tc := range testCases {
+		var p Program
+		err := json.Unmarshal([]byte(tc.input), &p)
+		if err == nil || err.Error() != tc.errMsg {
+			t.Errorf("%s: expected error %q, got %v", tc.input, tc.errMsg, err)
+		}
+	}
+
+	if _, err := json.Marshal(NewProgram(ModeLax, BadNode{})); err == nil {
+		t.Error("expected a tree with syntax errors not to encode")
+	}
+}
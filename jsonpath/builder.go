@@ -0,0 +1,385 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Path is a path expression under construction, such as
+//
+//	Root().Field("items").Wildcard().Filter(Cur().Field("price").Gt(Var("min")))
+//
+// Each method returns a new Path, so a Path can be shared as the prefix of
+// several others. The first mistake made in building it is kept and returned
+// by Expr or Program.
+type Path struct {
+	expr Expr
+	err  error
+}
+
+// Root returns the path `$`, the value the path is evaluated against.
+func Root() Path {
+	return Path{expr: NewVariableExpr("$")}
+}
+
+// Cur returns the path `@`, the item being tested by the enclosing filter.
+func Cur() Path {
+	return Path{expr: NewVariableExpr("@")}
+}
+
+// Var returns the path `$name` for the named variable, given without its
+// leading `$`.
+func Var(name string) Path {
+	if name == "" || !isIdentifier("$"+name) {
+		return Path{err: fmt.Errorf("invalid variable name %q", name)}
+	}
+	return Path{expr: NewVariableExpr("$" + name)}
+}
+
+// Last returns `last`, the index of the last element of the array being
+// subscripted.
+func Last() Path {
+	return Path{expr: LastExpr{}}
+}
+
+// PathOf returns a Path starting from e.
+func PathOf(e Expr) Path {
+	return Path{expr: e}
+}
+
+// Expr returns the path built so far. It isn't validated, since a path built
+// from Cur() is only valid within a filter.
+func (p Path) Expr() (Expr, error) {
+	return p.expr, p.err
+}
+
+// Program returns the path as a program in the given mode, if it passes
+// Validate.
+func (p Path) Program(mode Mode) (Program, error) {
+	if p.err != nil {
+		return Program{}, p.err
+	}
+	prog := NewProgram(mode, p.expr)
+	if errs := Validate(prog); len(errs) > 0 {
+		return Program{}, errs[0]
+	}
+	return prog, nil
+}
+
+// Access returns the path with a appended.
+func (p Path) Access(a Accessor) Path {
+	if p.err != nil {
+		return p
+	}
+	if err := checkAccess(p.expr); err != nil {
+		return Path{err: err}
+	}
+	return Path{expr: NewAccessExpr(p.expr, a)}
+}
+
+// Field returns the path with `.name` appended.
+func (p Path) Field(name string) Path {
+	return p.Access(NewDotAccessor(name))
+}
+
+// AnyField returns the path with `.*` appended.
+func (p Path) AnyField() Path {
+	return p.Access(MemberWildcardAccessor{})
+}
+
+// Wildcard returns the path with `[*]` appended.
+func (p Path) Wildcard() Path {
+	return p.Access(WildcardArrayAccessor{})
+}
+
+// Recursive returns the path with `.**` appended.
+func (p Path) Recursive() Path {
+	return p.Access(NewRecursiveWildcardAccessor(0, LastLevel))
+}
+
+// Index returns the path with a subscript appended for each of indexes,
+// which can be numbers or paths such as Last().
+func (p Path) Index(indexes ...interface{}) Path {
+	if len(indexes) == 0 {
+		return p.fail(errors.New("an array subscript needs at least one index"))
+	}
+	subscripts := make([]RangeSubscriptNode, len(indexes))
+	for i, index := range indexes {
+		e, err := operand(index)
+		if err != nil {
+			return p.fail(err)
+		}
+		subscripts[i] = NewSubscript(e)
+	}
+	return p.Access(NewArrayAccessor(subscripts...))
+}
+
+// Range returns the path with `[start to end]` appended.
+func (p Path) Range(start, end interface{}) Path {
+	s, err := operand(start)
+	if err != nil {
+		return p.fail(err)
+	}
+	e, err := operand(end)
+	if err != nil {
+		return p.fail(err)
+	}
+	return p.Access(NewArrayAccessor(NewRangeSubscript(s, e)))
+}
+
+// Method returns the path with the item method f appended, passing it args,
+// which must be literals.
+func (p Path) Method(f Function, args ...interface{}) Path {
+	nodes := make([]Node, len(args))
+	for i, arg := range args {
+		e, err := literal(arg)
+		if err != nil {
+			return p.fail(err)
+		}
+		nodes[i] = e
+	}
+	n := NewFuncNode(f, nodes...)
+	if len(args) == 0 {
+		// The parser leaves out an empty argument list.
+		n.Args = nil
+	}
+	if err := checkArgs(n); err != nil {
+		return p.fail(err)
+	}
+	return p.Access(n)
+}
+
+// Filter returns the path with `? (c)` appended.
+func (p Path) Filter(c Cond) Path {
+	if c.err != nil {
+		return p.fail(c.err)
+	}
+	return p.Access(NewFilterNode(c.pred))
+}
+
+func (p Path) fail(err error) Path {
+	if p.err != nil {
+		return p
+	}
+	return Path{err: err}
+}
+
+// Cond is a filter predicate under construction, which like Path keeps the
+// first mistake made in building it.
+type Cond struct {
+	pred Pred
+	err  error
+}
+
+// CondOf returns a Cond testing pred, such as the predicate of a FilterNode
+// from a parsed path.
+func CondOf(pred Pred) Cond {
+	return Cond{pred: pred}
+}
+
+// Pred returns the predicate built so far.
+func (c Cond) Pred() (Pred, error) {
+	return c.pred, c.err
+}
+
+func (p Path) compare(op BinPredType, v interface{}) Cond {
+	if p.err != nil {
+		return Cond{err: p.err}
+	}
+	e, err := operand(v)
+	if err != nil {
+		return Cond{err: err}
+	}
+	return Cond{pred: NewBinPred(op, p.expr, e)}
+}
+
+// Eq returns `p == v`, where v is a Path, an Expr or a Go value which can be
+// written as a literal: nil, a bool, a string or a number.
+func (p Path) Eq(v interface{}) Cond { return p.compare(EqBinOp, v) }
+
+// Ne returns `p != v`.
+func (p Path) Ne(v interface{}) Cond { return p.compare(NeqBinOp, v) }
+
+// Gt returns `p > v`.
+func (p Path) Gt(v interface{}) Cond { return p.compare(GtBinOp, v) }
+
+// Ge returns `p >= v`.
+func (p Path) Ge(v interface{}) Cond { return p.compare(GteBinOp, v) }
+
+// Lt returns `p < v`.
+func (p Path) Lt(v interface{}) Cond { return p.compare(LtBinOp, v) }
+
+// Le returns `p <= v`.
+func (p Path) Le(v interface{}) Cond { return p.compare(LteBinOp, v) }
+
+// StartsWith returns `p starts with v`.
+func (p Path) StartsWith(v interface{}) Cond {
+	if p.err != nil {
+		return Cond{err: p.err}
+	}
+	e, err := operand(v)
+	if err != nil {
+		return Cond{err: err}
+	}
+	return Cond{pred: NewStartsWithNode(p.expr, e)}
+}
+
+// LikeRegex returns `p like_regex pattern flag flags`.
+func (p Path) LikeRegex(pattern, flags string) Cond {
+	if p.err != nil {
+		return Cond{err: p.err}
+	}
+	n, err := NewLikeRegexNode(p.expr, pattern, flags)
+	if err != nil {
+		return Cond{err: err}
+	}
+	return Cond{pred: n}
+}
+
+// Exists returns `exists (p)`.
+func (p Path) Exists() Cond {
+	if p.err != nil {
+		return Cond{err: p.err}
+	}
+	return Cond{pred: NewExistsNode(p.expr)}
+}
+
+// Not returns `!(c)`.
+func (c Cond) Not() Cond {
+	if c.err != nil {
+		return c
+	}
+	return Cond{pred: NewUnaryNot(c.pred)}
+}
+
+// IsUnknown returns `(c) is unknown`.
+func (c Cond) IsUnknown() Cond {
+	if c.err != nil {
+		return c
+	}
+	return Cond{pred: NewIsUnknownNode(c.pred)}
+}
+
+// And returns `c && d`.
+func (c Cond) And(d Cond) Cond {
+	return And(c, d)
+}
+
+// Or returns `c || d`.
+func (c Cond) Or(d Cond) Cond {
+	return Or(c, d)
+}
+
+// And joins conds with `&&`, grouping from the left.
+func And(conds ...Cond) Cond {
+	return joinConds(AndBinOp, conds)
+}
+
+// Or joins conds with `||`, grouping from the left.
+func Or(conds ...Cond) Cond {
+	return joinConds(OrBinOp, conds)
+}
+
+func joinConds(op BinLogicType, conds []Cond) Cond {
+	if len(conds) == 0 {
+		return Cond{err: fmt.Errorf("%s needs at least one predicate", op)}
+	}
+	res := conds[0]
+	for _, c := range conds[1:] {
+		if res.err != nil {
+			return res
+		}
+		if c.err != nil {
+			return c
+		}
+		res = Cond{pred: NewBinLogic(op, res.pred, c.pred)}
+	}
+	return res
+}
+
+// Extend appends to prog the accessors which f appends to the Path it's
+// given, keeping prog's mode, and checks the result with Validate.
+func Extend(prog Program, f func(Path) Path) (Program, error) {
+	p := f(PathOf(prog.Root))
+	if p.err != nil {
+		return Program{}, p.err
+	}
+	prog.Root = p.expr
+	if errs := Validate(prog); len(errs) > 0 {
+		return Program{}, errs[0]
+	}
+	return prog, nil
+}
+
+// Substitute replaces each named variable `$name` in prog for which vars has
+// a value with that value written as a literal, leaving any others in place.
+// Values can be nil, bools, strings and numbers.
+func Substitute(prog Program, vars map[string]interface{}) (Program, error) {
+	var err error
+	res, rewriteErr := Rewrite(prog, func(n Node) Node {
+		v, ok := n.(VariableExpr)
+		if !ok || v.Name == "$" || v.Name == "@" {
+			return n
+		}
+		val, ok := vars[v.Name[1:]]
+		if !ok {
+			return n
+		}
+		e, litErr := operand(val)
+		if litErr != nil {
+			if err == nil {
+				err = fmt.Errorf("variable %q: %v", v.Name[1:], litErr)
+			}
+			return n
+		}
+		return e
+	})
+	if err == nil {
+		err = rewriteErr
+	}
+	if err != nil {
+		return Program{}, err
+	}
+	prog = res.(Program)
+	if errs := Validate(prog); len(errs) > 0 {
+		return Program{}, errs[0]
+	}
+	return prog, nil
+}
+
+// operand returns v as an expression, writing a negative number as the
+// parser would read it, as `-` applied to the number.
+func operand(v interface{}) (Expr, error) {
+	switch t := v.(type) {
+	case Path:
+		return t.expr, t.err
+	case Expr:
+		return t, nil
+	}
+	e, err := literal(v)
+	if n, ok := e.(NumberExpr); ok {
+		return numberLiteral(n.val), nil
+	}
+	return e, err
+}
+
+// literal returns v, a JSON value, as a literal.
+func literal(v interface{}) (Expr, error) {
+	switch t := v.(type) {
+	case nil:
+		return NullExpr{}, nil
+	case bool:
+		return NewBoolExpr(t), nil
+	case string:
+		return NewStringExpr(t), nil
+	case float64:
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return nil, fmt.Errorf("%v can't be written as a jsonpath number", t)
+		}
+	}
+	if n, ok := asNumeric(v); ok {
+		return NumberExpr{val: n}, nil
+	}
+	return nil, fmt.Errorf("a %T can't be written as a jsonpath literal", v)
+}
@@ -0,0 +1,138 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	price := Cur().Field("price")
+	testCases := []struct {
+		path     Path
+		expected string
+		errMsg   string
+	}{
+		{Root().Field("items").Wildcard().Filter(price.Gt(Var("min"))), "lax $.items[*]?(@.price > $min)", ""},
+		{Root().Field("a b").AnyField().Recursive(), "lax $.\"a b\".*.**", ""},
+		{Root().Index(0, Last()).Range(1, -1), "lax $[0, last][1 to -1]", ""},
+		{Root().Method(DecimalFunction, 5, -2).Method(SizeFunction), "lax $.decimal(5, -2).size()", ""},
+		{Root().Method(DatetimeFunction, "HH24:MI").Method(TimeFunction, 3), "lax $.datetime(\"HH24:MI\").time(3)", ""},
+		{Root().Filter(price.Ge(1.5).And(price.Le(json.Number("1e2")))), "lax $?(@.price >= 1.5 && @.price <= 100)", ""},
+		{Root().Filter(Or(price.Eq(nil), price.Eq(true)).And(Cur().Field("name").StartsWith("A"))), "lax $?((@.price == null || @.price == true) && @.name starts with \"A\")", ""},
+		{Root().Filter(price.Eq(1).Or(price.Eq(2).And(price.Eq(3)))), "lax $?(@.price == 1 || @.price == 2 && @.price == 3)", ""},
+		{Root().Filter(price.Eq(1).And(price.Eq(2).And(price.Eq(3)))), "lax $?(@.price == 1 && (@.price == 2 && @.price == 3))", ""},
+		{Root().Filter(price.Exists().Not().And(price.Lt(0).Not())), "lax $?(!exists (@.price) && !(@.price < 0))", ""},
+		{Root().Filter(Cur().Field("name").LikeRegex("^a", "i").IsUnknown()), "lax $?((@.name like_regex \"^a\" flag \"i\") is unknown)", ""},
+		{Root().Filter(Cur().Field("tags").Wildcard().Eq(Root().Field("tag"))), "lax $?(@.tags[*] == $.tag)", ""},
+		{Cur().Field("price"), "", "@ only allowed within filter expressions"},
+		{Root().Field("a").Filter(price.Gt(map[string]int{})), "", "a map[string]int can't be written as a jsonpath literal"},
+		{Root().Filter(price.Eq(math.NaN())), "", "NaN can't be written as a jsonpath number"},
+		{Var("a b"), "", "invalid variable name \"a b\""},
+		{Root().Index(), "", "an array subscript needs at least one index"},
+		{Root().Method(SizeFunction, 1), "", "too many arguments for .size(): at most 0, but got 1"},
+		{Root().Filter(price.LikeRegex("a", "g")), "", "unrecognized flag character \"g\" in like_regex predicate"},
+		{Root().Filter(And()), "", "&& needs at least one predicate"},
+		{PathOf(NewBinExpr(PlusBinOp, NewIntExpr(1), NewIntExpr(2))).Field("a"), "", "cannot access `1 + 2`, which is not a literal, variable or path"},
+	}
+
+	for _, tc := range testCases {
+		prog, err := tc.path.Program(ModeLax)
+		if tc.errMsg != "" {
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("expected error %q, got %v", tc.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.expected, err)
+			continue
+		}
+		if FormatNode(prog) != tc.expected {
+			t.Errorf("expected `%s`, got `%s`", tc.expected, FormatNode(prog))
+			continue
+		}
+		parsed, err := Parse(tc.expected)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expected, err)
+			continue
+		}
+		if FormatNode(parsed) != tc.expected {
+			t.Errorf("expected `%s` to round trip, got `%s`", tc.expected, FormatNode(parsed))
+		}
+	}
+}
+
+func TestExtend(t *testing.T) {
+	p, err := Parse("strict $.orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Extend(p, func(p Path) Path {
+		return p.Wildcard().Filter(Cur().Field("total").Gt(100))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "strict $.orders[*]?(@.total > 100)"; FormatNode(res) != expected {
+		t.Fatalf("expected `%s`, got `%s`", expected, FormatNode(res))
+	}
+	if FormatNode(p) != "strict $.orders" {
+		t.Fatalf("expected the original to be left alone, got `%s`", FormatNode(p))
+	}
+
+	p, err = Parse("$.a + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Extend(p, func(p Path) Path { return p.Field("b") })
+	if expected := "cannot access `$.a + 1`, which is not a literal, variable or path"; err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	testCases := []struct {
+		input    string
+		vars     map[string]interface{}
+		expected string
+		errMsg   string
+	}{
+		{"$.items ? (@.price > $min && @.name == $name)", map[string]interface{}{"min": 10, "name": "a\"b"}, "$.items?(@.price > 10 && @.name == \"a\\\"b\")", ""},
+		{"$.a[$i to $j]", map[string]interface{}{"i": -1}, "$.a[-1 to $j]", ""},
+		{"$.a ? (@ == $x)", map[string]interface{}{"x": nil}, "$.a?(@ == null)", ""},
+		{"$x.a", map[string]interface{}{"x": "s"}, "\"s\".a", ""},
+		{"$x.a", map[string]interface{}{"x": -1}, "", "cannot access `-1`, which is not a literal, variable or path"},
+		{"$.a ? (@ == $x)", map[string]interface{}{"x": []interface{}{}}, "", "variable \"x\": a []interface {} can't be written as a jsonpath literal"},
+	}
+
+	for _, tc := range testCases {
+		p, err := Parse(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := Substitute(p, tc.vars)
+		if tc.errMsg != "" {
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("expected error %q, got %v", tc.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+			continue
+		}
+		if FormatNode(res) != tc.expected {
+			t.Errorf("expected `%s`, got `%s`", tc.expected, FormatNode(res))
+			continue
+		}
+		parsed, err := Parse(tc.expected)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expected, err)
+		}
+		if !reflect.DeepEqual(parsed, res) {
+			t.Errorf("expected %#v, got %#v", parsed, res)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Comparisons follow the SQL/JSON rules: values of the same kind compare
+// naturally, null equals only null, null is unequal (but neither less nor
+// greater) than anything else, and any other comparison across kinds, or
+// involving an array or object, is unknown.
+
+type valueKind int
+
+const (
+	nullValue valueKind = iota
+	booleanValue
+	numberValue
+	stringValue
+	datetimeValue
+	arrayValue
+	objectValue
+)
+
+var valueKindNames = map[valueKind]string{
+	nullValue:     "null",
+	booleanValue:  "boolean",
+	numberValue:   "number",
+	stringValue:   "string",
+	datetimeValue: "datetime",
+	arrayValue:    "array",
+	objectValue:   "object",
+}
+
+func kindOf(v interface{}) (valueKind, error) {
+	switch v.(type) {
+	case nil:
+		return nullValue, nil
+	case bool:
+		return booleanValue, nil
+	case float64, json.Number, numeric, int, int64:
+		return numberValue, nil
+	case string:
+		return stringValue, nil
+	case datetime:
+		return datetimeValue, nil
+	case []interface{}:
+		return arrayValue, nil
+	case map[string]interface{}:
+		return objectValue, nil
+	}
+	return 0, fmt.Errorf("unsupported JSON value of type %T", v)
+}
+
+type cmpResult int
+
+const (
+	ltResult cmpResult = 1 << iota
+	eqResult
+	gtResult
+	// unorderedResult is the result of comparing null with a non-null value,
+	// which is only true for `!=`.
+	unorderedResult
+	unknownResult
+)
+
+func compare(ctx *naiveEvalContext, x interface{}, y interface{}) (cmpResult, error) {
+	xk, err := kindOf(x)
+	if err != nil {
+		return 0, err
+	}
+	yk, err := kindOf(y)
+	if err != nil {
+		return 0, err
+	}
+	if xk != yk {
+		if xk == nullValue || yk == nullValue {
+			return unorderedResult, nil
+		}
+		return unknownResult, nil
+	}
+	switch xk {
+	case nullValue:
+		return eqResult, nil
+	case booleanValue:
+		xx, yy := x.(bool), y.(bool)
+		if xx == yy {
+			return eqResult, nil
+		}
+		if !xx {
+			return ltResult, nil
+		}
+		return gtResult, nil
+	case numberValue:
+		xx, ok := asNumeric(x)
+		if !ok {
+			return 0, fmt.Errorf("invalid number %v", x)
+		}
+		yy, ok := asNumeric(y)
+		if !ok {
+			return 0, fmt.Errorf("invalid number %v", y)
+		}
+		return cmpToResult(xx.cmp(yy)), nil
+	case stringValue:
+		return cmpToResult(strings.Compare(x.(string), y.(string))), nil
+	case datetimeValue:
+		return compareDatetimes(x.(datetime), y.(datetime), ctx.timeZone)
+	}
+	return unknownResult, nil
+}
+
+func cmpToResult(c int) cmpResult {
+	switch {
+	case c < 0:
+		return ltResult
+	case c > 0:
+		return gtResult
+	}
+	return eqResult
+}
+
+// performCmp compares every pair of items from leftVal and rightVal, and is
+// true if any pair satisfies acceptedResult. In lax mode arrays are unwrapped
+// first, and a satisfying pair wins over pairs which can't be compared; in
+// strict mode any pair which can't be compared makes the result unknown.
+func performCmp(ctx *naiveEvalContext, leftVal, rightVal jsonSequence, acceptedResult cmpResult) (sqlJsonBool, error) {
+	identity := func(e interface{}) (interface{}, error) { return e, nil }
+	leftVal, err := mapItems(ctx, leftVal, identity)
+	if err != nil {
+		return 0, err
+	}
+	rightVal, err = mapItems(ctx, rightVal, identity)
+	if err != nil {
+		return 0, err
+	}
+
+	seenTrue, seenUnknown := false, false
+	for _, l := range leftVal {
+		for _, r := range rightVal {
+			result, err := compare(ctx, l, r)
+			if err != nil {
+				return 0, err
+			}
+
+			if result == unknownResult {
+				if ctx.mode == ModeStrict {
+					return sqlJsonUnknown, nil
+				}
+				seenUnknown = true
+			} else if (result & acceptedResult) != 0 {
+				if ctx.mode == ModeLax {
+					return sqlJsonTrue, nil
+				}
+				seenTrue = true
+			}
+		}
+	}
+	if seenTrue {
+		return sqlJsonTrue, nil
+	}
+	if seenUnknown {
+		return sqlJsonUnknown, nil
+	}
+	return sqlJsonFalse, nil
+}
@@ -0,0 +1,144 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// compareTestValue decodes a test value: `date`, `time` and `timestamp` are
+// datetimes, `json:`, `num:` and `int:` prefixes give a json.Number, a
+// numeric or an int, and anything else is decoded as JSON.
+func compareTestValue(t *testing.T, s string) interface{} {
+	switch {
+	case s == "date":
+		return mustParseDatetime(t, "2017-03-10")
+	case s == "time":
+		return mustParseDatetime(t, "12:00:00")
+	case s == "timestamp":
+		return mustParseDatetime(t, "2017-03-10 12:00:00")
+	case strings.HasPrefix(s, "json:"):
+		return json.Number(strings.TrimPrefix(s, "json:"))
+	case strings.HasPrefix(s, "num:"):
+		n, ok := parseNumeric(strings.TrimPrefix(s, "num:"))
+		if !ok {
+			t.Fatalf("couldn't parse %s", s)
+		}
+		return n
+	case strings.HasPrefix(s, "int:"):
+		n, ok := parseNumeric(strings.TrimPrefix(s, "int:"))
+		if !ok {
+			t.Fatalf("couldn't parse %s", s)
+		}
+		i, _ := n.int64()
+		return int(i)
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("couldn't decode %s: %s", s, err)
+	}
+	return v
+}
+
+func mustParseDatetime(t *testing.T, s string) datetime {
+	d, err := parseDatetime(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestCompare(t *testing.T) {
+	testCases := []struct {
+		x, y     string
+		expected cmpResult
+	}{
+		// Every pair of kinds.
+		{`null`, `null`, eqResult},
+		{`null`, `true`, unorderedResult},
+		{`null`, `1`, unorderedResult},
+		{`null`, `"a"`, unorderedResult},
+		{`null`, `date`, unorderedResult},
+		{`null`, `[1]`, unorderedResult},
+		{`null`, `{}`, unorderedResult},
+		{`true`, `null`, unorderedResult},
+		{`true`, `true`, eqResult},
+		{`true`, `1`, unknownResult},
+		{`true`, `"a"`, unknownResult},
+		{`true`, `date`, unknownResult},
+		{`true`, `[1]`, unknownResult},
+		{`true`, `{}`, unknownResult},
+		{`1`, `null`, unorderedResult},
+		{`1`, `true`, unknownResult},
+		{`1`, `1`, eqResult},
+		{`1`, `"a"`, unknownResult},
+		{`1`, `date`, unknownResult},
+		{`1`, `[1]`, unknownResult},
+		{`1`, `{}`, unknownResult},
+		{`"a"`, `null`, unorderedResult},
+		{`"a"`, `true`, unknownResult},
+		{`"a"`, `1`, unknownResult},
+		{`"a"`, `"a"`, eqResult},
+		{`"a"`, `date`, unknownResult},
+		{`"a"`, `[1]`, unknownResult},
+		{`"a"`, `{}`, unknownResult},
+		{`date`, `null`, unorderedResult},
+		{`date`, `true`, unknownResult},
+		{`date`, `1`, unknownResult},
+		{`date`, `"a"`, unknownResult},
+		{`date`, `date`, eqResult},
+		{`date`, `[1]`, unknownResult},
+		{`date`, `{}`, unknownResult},
+		{`[1]`, `null`, unorderedResult},
+		{`[1]`, `true`, unknownResult},
+		{`[1]`, `1`, unknownResult},
+		{`[1]`, `"a"`, unknownResult},
+		{`[1]`, `date`, unknownResult},
+		{`[1]`, `[1]`, unknownResult},
+		{`[1]`, `{}`, unknownResult},
+		{`{}`, `null`, unorderedResult},
+		{`{}`, `true`, unknownResult},
+		{`{}`, `1`, unknownResult},
+		{`{}`, `"a"`, unknownResult},
+		{`{}`, `date`, unknownResult},
+		{`{}`, `[1]`, unknownResult},
+		{`{}`, `{}`, unknownResult},
+
+		// Ordering within a kind.
+		{`false`, `true`, ltResult},
+		{`true`, `false`, gtResult},
+		{`1`, `2`, ltResult},
+		{`1.0`, `1`, eqResult},
+		{`"a"`, `"b"`, ltResult},
+		{`"b"`, `"a"`, gtResult},
+		{`"a"`, `"ab"`, ltResult},
+		{`"é"`, `"z"`, gtResult},
+		{`date`, `timestamp`, ltResult},
+		{`timestamp`, `date`, gtResult},
+		{`date`, `time`, unknownResult},
+		{`[]`, `[]`, unknownResult},
+		{`{}`, `{"a": 1}`, unknownResult},
+
+		// Numbers compare exactly across representations.
+		{`json:9007199254740993`, `num:9007199254740993`, eqResult},
+		{`json:9007199254740993`, `9007199254740992`, gtResult},
+		{`json:0.1`, `0.1`, eqResult},
+		{`num:0.30`, `json:0.3`, eqResult},
+		{`int:3`, `num:3.0`, eqResult},
+		{`int:3`, `json:2.5`, gtResult},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.x+"/"+tc.y, func(t *testing.T) {
+			x := compareTestValue(t, tc.x)
+			y := compareTestValue(t, tc.y)
+			result, err := compare(&naiveEvalContext{}, x, y)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != tc.expected {
+				t.Fatalf("expected %d, got %d", tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package jsonpath
+
+import "fmt"
+
+// The constructors below build the nodes of an AST without going through
+// Parse. They don't validate the tree as a whole, for instance that `@` only
+// appears within a filter.
+
+func NewProgram(mode Mode, root Expr) Program {
+	return Program{Mode: mode, Root: root}
+}
+
+func NewBinExpr(op BinExprType, left, right Expr) BinExpr {
+	return BinExpr{Op: op, Left: left, Right: right}
+}
+
+func NewBinPred(op BinPredType, left, right Expr) BinPred {
+	return BinPred{Op: op, Left: left, Right: right}
+}
+
+func NewBinLogic(op BinLogicType, left, right Pred) BinLogic {
+	return BinLogic{Op: op, Left: left, Right: right}
+}
+
+func NewUnaryExpr(op UnaryExprType, expr Expr) UnaryExpr {
+	return UnaryExpr{Op: op, Expr: expr}
+}
+
+func NewUnaryNot(pred Pred) UnaryNot {
+	return UnaryNot{Pred: pred}
+}
+
+func NewParenExpr(expr Expr) ParenExpr {
+	return ParenExpr{Expr: expr}
+}
+
+func NewParenPred(pred Pred) ParenPred {
+	return ParenPred{Pred: pred}
+}
+
+// NewNumberExpr returns the number written in decimal as text, with an
+// optional sign, fraction and exponent.
+func NewNumberExpr(text string) (NumberExpr, error) {
+	n, ok := parseNumeric(text)
+	if !ok {
+		return NumberExpr{}, fmt.Errorf("invalid number %q", text)
+	}
+	return NumberExpr{val: n}, nil
+}
+
+func NewIntExpr(i int64) NumberExpr {
+	return NumberExpr{val: numericFromInt(i)}
+}
+
+// String returns the number in decimal, keeping any trailing zeros it was
+// written with.
+func (n NumberExpr) String() string {
+	return n.val.String()
+}
+
+// Int64 returns the number if it is an integer which fits in an int64.
+func (n NumberExpr) Int64() (int64, bool) {
+	return n.val.int64()
+}
+
+// Float64 returns the nearest float64 to the number.
+func (n NumberExpr) Float64() float64 {
+	f, _ := n.val.float64()
+	return f
+}
+
+// NewVariableExpr returns a reference to `$`, `@` or a named variable, whose
+// name includes the leading `$`.
+func NewVariableExpr(name string) VariableExpr {
+	return VariableExpr{Name: name}
+}
+
+func NewBoolExpr(b bool) BoolExpr {
+	return BoolExpr{Value: b}
+}
+
+func NewStringExpr(s string) StringExpr {
+	return StringExpr{Value: s}
+}
+
+func NewAccessExpr(left Expr, right Accessor) AccessExpr {
+	return AccessExpr{Left: left, Right: right}
+}
+
+// NewDotAccessor accesses the member name, quoting it if it isn't a valid
+// identifier.
+func NewDotAccessor(name string) DotAccessor {
+	return DotAccessor{Name: name, Quoted: !isIdentifier(name)}
+}
+
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if i == 0 && !validFirstIdentifierChar(r) || !validIdentifierChar(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func NewArrayAccessor(subscripts ...RangeSubscriptNode) ArrayAccessor {
+	return ArrayAccessor{Subscripts: subscripts}
+}
+
+func NewSubscript(index Expr) RangeSubscriptNode {
+	return RangeSubscriptNode{Start: index}
+}
+
+func NewRangeSubscript(start, end Expr) RangeSubscriptNode {
+	return RangeSubscriptNode{Start: start, End: end}
+}
+
+// NewRecursiveWildcardAccessor returns `.**{first to last}`, where either
+// level can be LastLevel.
+func NewRecursiveWildcardAccessor(first, last int) RecursiveWildcardAccessor {
+	return RecursiveWildcardAccessor{First: first, Last: last}
+}
+
+func NewFuncNode(f Function, args ...Node) FuncNode {
+	n := FuncNode{Func: f, Args: args}
+	if f == DatetimeFunction && len(args) > 0 {
+		if s, ok := args[0].(StringExpr); ok {
+			// A template which doesn't compile is reported by Validate.
+			n.template, _ = compileDatetimeTemplate(s.Value)
+		}
+	}
+	return n
+}
+
+func NewFilterNode(pred Pred) FilterNode {
+	return FilterNode{Pred: pred}
+}
+
+func NewExistsNode(expr Expr) ExistsNode {
+	return ExistsNode{Expr: expr}
+}
+
+// NewLikeRegexNode returns `left like_regex pattern flag flags`, or an error
+// if the pattern or flags are invalid.
+func NewLikeRegexNode(left Expr, pattern, flags string) (LikeRegexNode, error) {
+	re, err := compileXQueryRegex(pattern, flags)
+	if err != nil {
+		return LikeRegexNode{}, err
+	}
+	return LikeRegexNode{Left: left, Pattern: pattern, Flag: flags, regex: re}, nil
+}
+
+func NewStartsWithNode(left, right Expr) StartsWithNode {
+	return StartsWithNode{Left: left, Right: right}
+}
+
+func NewIsUnknownNode(pred Pred) IsUnknownNode {
+	return IsUnknownNode{Pred: pred}
+}
@@ -0,0 +1,165 @@
+package jsonpath
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestConstructors(t *testing.T) {
+	mustNumber := func(s string) NumberExpr {
+		n, err := NewNumberExpr(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	dollar := NewVariableExpr("$")
+	at := NewVariableExpr("@")
+
+	testCases := []struct {
+		program  Program
+		expected string
+	}{
+		{NewProgram(ModeLax, NewIntExpr(1)), "lax 1"},
+		{NewProgram(ModeStrict, NewBinExpr(PlusBinOp, mustNumber("1.50"), NewUnaryExpr(UMinus, NewIntExpr(2)))), "strict 1.50 + -2"},
+		{NewProgram(ModeLax, NewBinExpr(TimesBinOp, NewBinExpr(MinusBinOp, NewIntExpr(1), NewIntExpr(2)), NewIntExpr(3))), "lax (1 - 2) * 3"},
+		{NewProgram(ModeLax, NewAccessExpr(dollar, NewDotAccessor("a"))), "lax $.a"},
+		{NewProgram(ModeLax, NewAccessExpr(dollar, NewDotAccessor("a b"))), "lax $.\"a b\""},
+		{NewProgram(ModeLax, NewAccessExpr(dollar, NewDotAccessor(""))), "lax $.\"\""},
+		{NewProgram(ModeLax, NewAccessExpr(dollar, NewArrayAccessor(NewSubscript(NewIntExpr(0)), NewRangeSubscript(NewIntExpr(2), LastExpr{})))), "lax $[0, 2 to last]"},
+		{NewProgram(ModeLax, NewAccessExpr(dollar, NewRecursiveWildcardAccessor(1, LastLevel))), "lax $.**{1 to last}"},
+		{NewProgram(ModeLax, NewAccessExpr(dollar, NewFuncNode(DecimalFunction, NewIntExpr(5), NewIntExpr(2)))), "lax $.decimal(5, 2)"},
+		{NewProgram(ModeLax, NewAccessExpr(dollar, NewFuncNode(DatetimeFunction, NewStringExpr("HH24:MI")))), "lax $.datetime(\"HH24:MI\")"},
+		{
+			NewProgram(ModeLax, NewAccessExpr(dollar, NewFilterNode(NewBinLogic(AndBinOp,
+				NewBinPred(GteBinOp, NewAccessExpr(at, NewDotAccessor("price")), NewIntExpr(10)),
+				NewUnaryNot(NewExistsNode(NewAccessExpr(at, NewDotAccessor("sold"))))),
+			))),
+			"lax $?(@.price >= 10 && !exists (@.sold))",
+		},
+		{
+			NewProgram(ModeLax, NewAccessExpr(dollar, NewFilterNode(NewBinLogic(OrBinOp,
+				NewStartsWithNode(at, NewStringExpr("a")),
+				NewIsUnknownNode(NewBinPred(EqBinOp, at, NewBoolExpr(true))),
+			)))),
+			"lax $?(@ starts with \"a\" || (@ == true) is unknown)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			if FormatNode(tc.program) != tc.expected {
+				t.Fatalf("expected `%s`, got `%s`", tc.expected, FormatNode(tc.program))
+			}
+			parsed, err := Parse(tc.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, tc.program) {
+				t.Fatalf("expected %#v, got %#v", tc.program, parsed)
+			}
+		})
+	}
+}
+
+func TestConstructorErrors(t *testing.T) {
+	if _, err := NewNumberExpr("1e"); err == nil {
+		t.Error("expected an invalid number to error")
+	}
+	if _, err := NewLikeRegexNode(NewVariableExpr("@"), "a", "g"); err == nil {
+		t.Error("expected an invalid flag to error")
+	}
+}
+
+func TestLikeRegexLiteral(t *testing.T) {
+	// A node built without NewLikeRegexNode compiles its pattern when it's
+	// evaluated.
+	items := NewAccessExpr(NewVariableExpr("$"), WildcardArrayAccessor{})
+	p := NewProgram(ModeLax, NewAccessExpr(items, NewFilterNode(LikeRegexNode{
+		Left:    NewVariableExpr("@"),
+		Pattern: "^A",
+		Flag:    "i",
+	})))
+	res, err := NewNaiveEvalerForProgram(p).Run([]interface{}{"abc", "bcd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, jsonSequence{"abc"}) {
+		t.Fatalf("expected [abc], got %v", res)
+	}
+}
+
+func TestNumberExprZeroValue(t *testing.T) {
+	// NumberExpr{} is taken to be 0.
+	if s := FormatNode(NumberExpr{}); s != "0" {
+		t.Fatalf("expected `0`, got `%s`", s)
+	}
+	p := NewProgram(ModeLax, NewBinExpr(PlusBinOp, NewVariableExpr("$"), NumberExpr{}))
+	if errs := Validate(p); len(errs) > 0 {
+		t.Fatal(errs[0])
+	}
+	res, err := NewNaiveEvalerForProgram(p).Run(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || fmt.Sprint(res[0]) != "1" {
+		t.Fatalf("expected [1], got %v", res)
+	}
+}
+
+func TestParenNodes(t *testing.T) {
+	at := NewVariableExpr("@")
+	testCases := []struct {
+		program  Program
+		unparen  Program
+		expected string
+	}{
+		{
+			NewProgram(ModeLax, NewBinExpr(TimesBinOp, NewParenExpr(NewBinExpr(MinusBinOp, NewVariableExpr("$"), NewIntExpr(2))), NewParenExpr(NewIntExpr(3)))),
+			NewProgram(ModeLax, NewBinExpr(TimesBinOp, NewBinExpr(MinusBinOp, NewVariableExpr("$"), NewIntExpr(2)), NewIntExpr(3))),
+			"lax ($ - 2) * 3",
+		},
+		{
+			NewProgram(ModeLax, NewAccessExpr(NewParenExpr(NewIntExpr(1)), NewDotAccessor("a"))),
+			NewProgram(ModeLax, NewAccessExpr(NewIntExpr(1), NewDotAccessor("a"))),
+			"lax 1 .a",
+		},
+		{
+			NewProgram(ModeLax, NewAccessExpr(NewVariableExpr("$"), NewFilterNode(NewParenPred(NewBinLogic(AndBinOp,
+				NewUnaryNot(NewParenPred(NewExistsNode(NewAccessExpr(at, NewDotAccessor("a"))))),
+				NewParenPred(NewBinLogic(OrBinOp, NewBinPred(EqBinOp, at, NewIntExpr(1)), NewBinPred(EqBinOp, at, NewIntExpr(2)))),
+			))))),
+			NewProgram(ModeLax, NewAccessExpr(NewVariableExpr("$"), NewFilterNode(NewBinLogic(AndBinOp,
+				NewUnaryNot(NewExistsNode(NewAccessExpr(at, NewDotAccessor("a")))),
+				NewBinLogic(OrBinOp, NewBinPred(EqBinOp, at, NewIntExpr(1)), NewBinPred(EqBinOp, at, NewIntExpr(2))),
+			)))),
+			"lax $?(!exists (@.a) && (@ == 1 || @ == 2))",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			if errs := Validate(tc.program); len(errs) > 0 {
+				t.Fatal(errs[0])
+			}
+			if FormatNode(tc.program) != tc.expected {
+				t.Fatalf("expected `%s`, got `%s`", tc.expected, FormatNode(tc.program))
+			}
+			// Normalize and Optimize remove the wrappers.
+			if res := Normalize(tc.program); !reflect.DeepEqual(res, Normalize(tc.unparen)) {
+				t.Errorf("expected Normalize to give %#v, got %#v", Normalize(tc.unparen), res)
+			}
+			if res := Optimize(tc.program); !reflect.DeepEqual(res, Optimize(tc.unparen)) {
+				t.Errorf("expected Optimize to give %#v, got %#v", Optimize(tc.unparen), res)
+			}
+			for _, doc := range []interface{}{1, 5, []interface{}{1, 2, 3}} {
+				expected, expectedErr := NewNaiveEvalerForProgram(tc.unparen).Run(doc)
+				res, err := NewNaiveEvalerForProgram(tc.program).Run(doc)
+				if fmt.Sprint(res, err) != fmt.Sprint(expected, expectedErr) {
+					t.Errorf("expected %v, %v on %v, got %v, %v", expected, expectedErr, doc, res, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package jsonpath
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The numeric conversion item methods (.double(), .bigint(), .integer(),
+// .number() and .decimal()) accept numbers and strings holding numbers, and
+// follow PostgreSQL's rules for what counts as a valid argument.
+
+var numericString = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+var nonFiniteString = regexp.MustCompile(`^(?i)[+-]?(nan|inf|infinity)$`)
+
+func convertNumeric(name string, e interface{}, convert func(numeric, string) (interface{}, error)) (interface{}, error) {
+	if n, ok := asNumeric(e); ok {
+		return convert(n, n.String())
+	}
+	if t, ok := e.(string); ok {
+		s := strings.TrimSpace(t)
+		if nonFiniteString.MatchString(s) {
+			return nil, fmt.Errorf("NaN or Infinity is not allowed for .%s()", name)
+		}
+		n, ok := parseNumeric(s)
+		if !numericString.MatchString(s) || !ok {
+			return nil, fmt.Errorf("argument %q of .%s() is not a valid number", t, name)
+		}
+		return convert(n, t)
+	}
+	return nil, fmt.Errorf(".%s() only defined on strings and numbers", name)
+}
+
+// toDouble rounds to the nearest float64, as PostgreSQL does when it
+// converts to double precision.
+func toDouble(e interface{}) (interface{}, error) {
+	return convertNumeric("double", e, func(n numeric, raw string) (interface{}, error) {
+		f, err := n.float64()
+		if err != nil {
+			return nil, fmt.Errorf("argument %q of .double() is out of range", raw)
+		}
+		return numericFromFloat(f), nil
+	})
+}
+
+func toNumber(e interface{}) (interface{}, error) {
+	return convertNumeric("number", e, func(n numeric, _ string) (interface{}, error) {
+		return n, nil
+	})
+}
+
+// toInteger converts to an integer of the given bit size. Numbers are
+// rounded half away from zero, but strings must spell out an integer.
+func toInteger(name string, bits int, e interface{}) (interface{}, error) {
+	typeName := "integer"
+	if bits == 64 {
+		typeName = "bigint"
+	}
+	if s, ok := e.(string); ok {
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, bits)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q of .%s() is invalid for type %s", s, name, typeName)
+		}
+		return numericFromInt(i), nil
+	}
+	return convertNumeric(name, e, func(n numeric, raw string) (interface{}, error) {
+		r := n.round(0)
+		i, ok := r.int64()
+		if !ok || (bits == 32 && (i < math.MinInt32 || i > math.MaxInt32)) {
+			return nil, fmt.Errorf("argument %q of .%s() is invalid for type %s", raw, name, typeName)
+		}
+		return r, nil
+	})
+}
+
+// toDecimal rounds half away from zero to scale digits after the decimal
+// point, and fails if the result needs more than precision digits.
+func toDecimal(precision, scale int, hasPrecision bool, e interface{}) (interface{}, error) {
+	return convertNumeric("decimal", e, func(n numeric, raw string) (interface{}, error) {
+		if !hasPrecision {
+			return n, nil
+		}
+		r := n.round(scale)
+		if r.digits() > precision-scale {
+			return nil, fmt.Errorf("argument %q of .decimal() is invalid for type numeric(%d,%d)", raw, precision, scale)
+		}
+		return r, nil
+	})
+}
+
+func toString(e interface{}) (interface{}, error) {
+	if n, ok := asNumeric(e); ok {
+		return n.String(), nil
+	}
+	switch t := e.(type) {
+	case string:
+		return t, nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case datetime:
+		return t.String(), nil
+	}
+	return nil, fmt.Errorf(".string() only defined on booleans, strings, numbers and datetimes")
+}
+
+// toBoolean accepts the spellings of PostgreSQL's boolean input function,
+// and integers, which are true if they are non-zero.
+func toBoolean(e interface{}) (interface{}, error) {
+	if n, ok := asNumeric(e); ok {
+		if i, ok := n.int64(); !ok || i < math.MinInt32 || i > math.MaxInt32 {
+			return nil, fmt.Errorf("argument %q of .boolean() is invalid for type boolean", n.String())
+		}
+		return n.sign() != 0, nil
+	}
+	switch t := e.(type) {
+	case bool:
+		return t, nil
+	case string:
+		if b, ok := parseBool(strings.ToLower(strings.TrimSpace(t))); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("argument %q of .boolean() is invalid for type boolean", t)
+	}
+	return nil, fmt.Errorf(".boolean() only defined on booleans, strings and numbers")
+}
+
+func parseBool(s string) (bool, bool) {
+	prefixOf := func(word string, minLen int) bool {
+		return len(s) >= minLen && strings.HasPrefix(word, s)
+	}
+	switch {
+	case s == "1":
+		return true, true
+	case s == "0":
+		return false, true
+	case prefixOf("true", 1), prefixOf("yes", 1), prefixOf("on", 2):
+		return true, true
+	case prefixOf("false", 1), prefixOf("no", 1), prefixOf("off", 2):
+		return false, true
+	}
+	return false, false
+}
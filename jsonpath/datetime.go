@@ -0,0 +1,663 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type datetimeKind int
+
+const (
+	dateKind datetimeKind = iota
+	timeKind
+	timeTZKind
+	timestampKind
+	timestampTZKind
+)
+
+// datetime is the value produced by the .datetime() item method. Values
+// without a time zone are stored in UTC, values with one carry a fixed zone
+// holding the parsed offset. Times of day are stored on 0001-01-01.
+type datetime struct {
+	kind datetimeKind
+	t    time.Time
+}
+
+func (d datetime) typeName() string {
+	switch d.kind {
+	case dateKind:
+		return "date"
+	case timeKind:
+		return "time without time zone"
+	case timeTZKind:
+		return "time with time zone"
+	case timestampKind:
+		return "timestamp without time zone"
+	case timestampTZKind:
+		return "timestamp with time zone"
+	}
+	return "unknown"
+}
+
+func (d datetime) shortTypeName() string {
+	switch d.kind {
+	case dateKind:
+		return "date"
+	case timeKind:
+		return "time"
+	case timeTZKind:
+		return "timetz"
+	case timestampKind:
+		return "timestamp"
+	case timestampTZKind:
+		return "timestamptz"
+	}
+	return "unknown"
+}
+
+func (d datetime) String() string {
+	switch d.kind {
+	case dateKind:
+		return d.t.Format("2006-01-02")
+	case timeKind:
+		return d.t.Format("15:04:05.999999999")
+	case timeTZKind:
+		return d.t.Format("15:04:05.999999999-07:00")
+	case timestampKind:
+		return d.t.Format("2006-01-02T15:04:05.999999999")
+	case timestampTZKind:
+		return d.t.Format("2006-01-02T15:04:05.999999999-07:00")
+	}
+	return d.t.String()
+}
+
+func (d datetime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func compareTimes(x, y time.Time) cmpResult {
+	switch {
+	case x.Before(y):
+		return ltResult
+	case x.After(y):
+		return gtResult
+	}
+	return eqResult
+}
+
+func (k datetimeKind) hasDate() bool {
+	return k == dateKind || k == timestampKind || k == timestampTZKind
+}
+
+func (k datetimeKind) hasTZ() bool {
+	return k == timeTZKind || k == timestampTZKind
+}
+
+// compareDatetimes compares two datetime values, following SQL/JSON. Dates
+// and timestamps are comparable with each other, as are times, but a date
+// and a time are not and compare as unknown. Values of different kinds are
+// cast to a common kind first, which needs loc if only one has a time zone.
+func compareDatetimes(x, y datetime, loc *time.Location) (cmpResult, error) {
+	if x.kind.hasDate() != y.kind.hasDate() {
+		return unknownResult, nil
+	}
+	common := x.kind
+	switch {
+	case x.kind == y.kind:
+	case x.kind == timestampTZKind || y.kind == timestampTZKind:
+		common = timestampTZKind
+	case x.kind.hasDate():
+		common = timestampKind
+	default:
+		common = timeTZKind
+	}
+	x, err := castDatetime(x, common, loc)
+	if err != nil {
+		return 0, err
+	}
+	y, err = castDatetime(y, common, loc)
+	if err != nil {
+		return 0, err
+	}
+	result := compareTimes(x.t, y.t)
+	if result == eqResult && common == timeTZKind {
+		// Like PostgreSQL, only consider times with time zone equal if
+		// their offsets are too; the one further east sorts first.
+		_, xOffset := x.t.Zone()
+		_, yOffset := y.t.Zone()
+		switch {
+		case xOffset > yOffset:
+			return ltResult, nil
+		case xOffset < yOffset:
+			return gtResult, nil
+		}
+	}
+	return result, nil
+}
+
+// castDatetime converts d to the given kind. Conversions between a value
+// with a time zone and one without express the value in loc, and fail if it
+// is nil.
+func castDatetime(d datetime, kind datetimeKind, loc *time.Location) (datetime, error) {
+	if d.kind == kind {
+		return d, nil
+	}
+	target := datetime{kind: kind}
+	if !d.kind.hasDate() && kind.hasDate() || d.kind == dateKind && !kind.hasDate() {
+		return datetime{}, fmt.Errorf("cannot convert value from %s to %s", d.shortTypeName(), target.shortTypeName())
+	}
+	if d.kind.hasTZ() != kind.hasTZ() && loc == nil {
+		return datetime{}, fmt.Errorf("cannot convert value from %s to %s without time zone usage", d.shortTypeName(), target.shortTypeName())
+	}
+
+	t := d.t
+	if d.kind.hasTZ() != kind.hasTZ() {
+		if d.kind.hasDate() {
+			year, month, day := t.Date()
+			if d.kind.hasTZ() {
+				t = t.In(loc)
+			} else {
+				t = time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+			}
+		} else {
+			// A time of day has no date to find the offset at, so use the
+			// offset in effect now, as PostgreSQL does.
+			_, offset := time.Now().In(loc).Zone()
+			if d.kind.hasTZ() {
+				t = t.In(time.FixedZone("", offset))
+			} else {
+				t = time.Date(1, time.January, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.FixedZone("", offset))
+			}
+		}
+	}
+
+	year, month, day := t.Date()
+	zone := time.UTC
+	if kind.hasTZ() {
+		_, offset := t.Zone()
+		zone = time.FixedZone("", offset)
+	}
+	switch kind {
+	case dateKind:
+		target.t = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	case timeKind, timeTZKind:
+		target.t = time.Date(1, time.January, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone)
+	case timestampKind, timestampTZKind:
+		target.t = time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone)
+	}
+	return target, nil
+}
+
+// round rounds the fractional seconds of d to the given number of digits.
+func (d datetime) round(precision int) datetime {
+	unit := time.Duration(1)
+	for i := precision; i < 9; i++ {
+		unit *= 10
+	}
+	if d.kind != dateKind {
+		d.t = d.t.Round(unit)
+	}
+	return d
+}
+
+// convertDatetime implements the .date(), .time(), .time_tz(), .timestamp()
+// and .timestamp_tz() item methods. A negative precision leaves fractional
+// seconds alone.
+func convertDatetime(name string, kind datetimeKind, precision int, loc *time.Location, e interface{}) (interface{}, error) {
+	var d datetime
+	switch t := e.(type) {
+	case string:
+		parsed, err := parseDatetime(t)
+		if err != nil {
+			return nil, err
+		}
+		d = parsed
+	case datetime:
+		d = t
+	default:
+		return nil, fmt.Errorf(".%s() only defined on strings and datetimes", name)
+	}
+	d, err := castDatetime(d, kind, loc)
+	if err != nil {
+		return nil, err
+	}
+	if precision >= 0 {
+		d = d.round(precision)
+	}
+	return d, nil
+}
+
+type datetimeField int
+
+const (
+	dtLiteral datetimeField = iota
+	dtYear
+	dtYear3
+	dtYear2
+	dtYear1
+	dtRoundedYear
+	dtRoundedYear2
+	dtMonth
+	dtDayOfYear
+	dtDay
+	dtHour24
+	dtHour12
+	dtMinute
+	dtSecondOfDay
+	dtSecond
+	dtFraction
+	dtMeridian
+	dtTZHour
+	dtTZMinute
+)
+
+// datetimeTemplateFields lists the template elements of the SQL/JSON
+// datetime template language. Elements sharing a prefix must be listed
+// longest first.
+var datetimeTemplateFields = []struct {
+	name  string
+	field datetimeField
+	width int
+}{
+	{"YYYY", dtYear, 4},
+	{"YYY", dtYear3, 3},
+	{"YY", dtYear2, 2},
+	{"Y", dtYear1, 1},
+	{"RRRR", dtRoundedYear, 4},
+	{"RR", dtRoundedYear2, 2},
+	{"MM", dtMonth, 2},
+	{"DDD", dtDayOfYear, 3},
+	{"DD", dtDay, 2},
+	{"HH24", dtHour24, 2},
+	{"HH12", dtHour12, 2},
+	{"HH", dtHour12, 2},
+	{"MI", dtMinute, 2},
+	{"SSSSS", dtSecondOfDay, 5},
+	{"SS", dtSecond, 2},
+	{"FF1", dtFraction, 1},
+	{"FF2", dtFraction, 2},
+	{"FF3", dtFraction, 3},
+	{"FF4", dtFraction, 4},
+	{"FF5", dtFraction, 5},
+	{"FF6", dtFraction, 6},
+	{"FF7", dtFraction, 7},
+	{"FF8", dtFraction, 8},
+	{"FF9", dtFraction, 9},
+	{"MS", dtFraction, 3},
+	{"US", dtFraction, 6},
+	{"A.M.", dtMeridian, 4},
+	{"P.M.", dtMeridian, 4},
+	{"AM", dtMeridian, 2},
+	{"PM", dtMeridian, 2},
+	{"TZH", dtTZHour, 2},
+	{"TZM", dtTZMinute, 2},
+}
+
+func datetimeSeparator(r rune) bool {
+	return strings.ContainsRune("-./,';: ", r)
+}
+
+type datetimeItem struct {
+	field datetimeField
+	name  string
+	width int
+}
+
+type datetimeTemplate struct {
+	raw   string
+	items []datetimeItem
+	kind  datetimeKind
+}
+
+// isoDatetimeTemplates are tried in order by .datetime() without an
+// argument, matching the formats PostgreSQL recognises.
+var isoDatetimeTemplates = func() []*datetimeTemplate {
+	formats := []string{
+		"YYYY-MM-DD",
+		"HH24:MI:SS.USTZH:TZM",
+		"HH24:MI:SS.USTZH",
+		"HH24:MI:SSTZH:TZM",
+		"HH24:MI:SSTZH",
+		"HH24:MI:SS.US",
+		"HH24:MI:SS",
+		"YYYY-MM-DD HH24:MI:SS.USTZH:TZM",
+		"YYYY-MM-DD HH24:MI:SS.USTZH",
+		"YYYY-MM-DD HH24:MI:SSTZH:TZM",
+		"YYYY-MM-DD HH24:MI:SSTZH",
+		`YYYY-MM-DD"T"HH24:MI:SS.USTZH:TZM`,
+		`YYYY-MM-DD"T"HH24:MI:SS.USTZH`,
+		`YYYY-MM-DD"T"HH24:MI:SSTZH:TZM`,
+		`YYYY-MM-DD"T"HH24:MI:SSTZH`,
+		"YYYY-MM-DD HH24:MI:SS.US",
+		"YYYY-MM-DD HH24:MI:SS",
+		`YYYY-MM-DD"T"HH24:MI:SS.US`,
+		`YYYY-MM-DD"T"HH24:MI:SS`,
+	}
+	result := make([]*datetimeTemplate, len(formats))
+	for i, f := range formats {
+		t, err := compileDatetimeTemplate(f)
+		if err != nil {
+			panic(err)
+		}
+		result[i] = t
+	}
+	return result
+}()
+
+func compileDatetimeTemplate(tmpl string) (*datetimeTemplate, error) {
+	result := &datetimeTemplate{raw: tmpl}
+	seen := make(map[datetimeField]string)
+	runes := []rune(tmpl)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		if datetimeSeparator(r) {
+			result.items = append(result.items, datetimeItem{field: dtLiteral, name: string(r)})
+			i++
+			continue
+		}
+		if r == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quoted text in datetime template %q", tmpl)
+			}
+			result.items = append(result.items, datetimeItem{field: dtLiteral, name: string(runes[i+1 : end])})
+			i = end + 1
+			continue
+		}
+		rest := strings.ToUpper(string(runes[i:]))
+		matched := false
+		for _, f := range datetimeTemplateFields {
+			if !strings.HasPrefix(rest, f.name) {
+				continue
+			}
+			if prev, ok := seen[f.field]; ok {
+				return nil, fmt.Errorf("datetime template element %q conflicts with %q", f.name, prev)
+			}
+			seen[f.field] = f.name
+			result.items = append(result.items, datetimeItem{field: f.field, name: f.name, width: f.width})
+			i += len(f.name)
+			matched = true
+			break
+		}
+		if !matched {
+			return nil, fmt.Errorf("invalid datetime template element at %q", string(runes[i:]))
+		}
+	}
+
+	years := 0
+	hasDate, hasTime, hasTZ := false, false, false
+	for field, name := range seen {
+		switch field {
+		case dtYear, dtYear3, dtYear2, dtYear1, dtRoundedYear, dtRoundedYear2:
+			years++
+			hasDate = true
+		case dtMonth, dtDay, dtDayOfYear:
+			hasDate = true
+		case dtHour24, dtHour12, dtMinute, dtSecond, dtSecondOfDay, dtFraction, dtMeridian:
+			hasTime = true
+		case dtTZHour, dtTZMinute:
+			hasTZ = true
+		default:
+			return nil, fmt.Errorf("unexpected datetime template element %q", name)
+		}
+	}
+	if years > 1 {
+		return nil, fmt.Errorf("datetime template %q specifies the year more than once", tmpl)
+	}
+	if _, ok := seen[dtDayOfYear]; ok {
+		if _, ok := seen[dtMonth]; ok {
+			return nil, fmt.Errorf("datetime template element \"DDD\" conflicts with \"MM\"")
+		}
+		if _, ok := seen[dtDay]; ok {
+			return nil, fmt.Errorf("datetime template element \"DDD\" conflicts with \"DD\"")
+		}
+	}
+	if _, ok := seen[dtSecondOfDay]; ok {
+		for _, f := range []datetimeField{dtHour24, dtHour12, dtMinute, dtSecond} {
+			if name, ok := seen[f]; ok {
+				return nil, fmt.Errorf("datetime template element \"SSSSS\" conflicts with %q", name)
+			}
+		}
+	}
+	if _, ok := seen[dtHour24]; ok {
+		if name, ok := seen[dtHour12]; ok {
+			return nil, fmt.Errorf("datetime template element \"HH24\" conflicts with %q", name)
+		}
+		if name, ok := seen[dtMeridian]; ok {
+			return nil, fmt.Errorf("datetime template element \"HH24\" conflicts with %q", name)
+		}
+	}
+
+	switch {
+	case !hasDate && !hasTime && !hasTZ:
+		return nil, fmt.Errorf("datetime template %q contains no date or time fields", tmpl)
+	case hasDate && !hasTime && !hasTZ:
+		result.kind = dateKind
+	case !hasDate && hasTime:
+		if hasTZ {
+			result.kind = timeTZKind
+		} else {
+			result.kind = timeKind
+		}
+	case hasTZ:
+		result.kind = timestampTZKind
+	default:
+		result.kind = timestampKind
+	}
+	return result, nil
+}
+
+// datetimeFields accumulates the values read from an input string.
+type datetimeFields struct {
+	year, month, day, dayOfYear int
+	hour, minute, second, nanos int
+	secondOfDay                 int
+	pm                          bool
+	tzSign, tzHour, tzMinute    int
+	set                         map[datetimeField]bool
+}
+
+func readDigits(s []rune, pos, width int) (int, int) {
+	val := 0
+	end := pos
+	for end < len(s) && end-pos < width && '0' <= s[end] && s[end] <= '9' {
+		val = val*10 + int(s[end]-'0')
+		end++
+	}
+	return val, end
+}
+
+func (t *datetimeTemplate) parse(input string) (datetime, error) {
+	s := []rune(input)
+	pos := 0
+	f := datetimeFields{month: 1, day: 1, tzSign: 1, set: make(map[datetimeField]bool)}
+	for _, item := range t.items {
+		switch item.field {
+		case dtLiteral:
+			if item.name == " " {
+				if pos >= len(s) || !unicode.IsSpace(s[pos]) {
+					return datetime{}, fmt.Errorf("unmatched datetime template character \" \" in %q", input)
+				}
+				for pos < len(s) && unicode.IsSpace(s[pos]) {
+					pos++
+				}
+				continue
+			}
+			lit := []rune(item.name)
+			if pos+len(lit) > len(s) || !strings.EqualFold(string(s[pos:pos+len(lit)]), item.name) {
+				return datetime{}, fmt.Errorf("unmatched datetime template text %q in %q", item.name, input)
+			}
+			pos += len(lit)
+			continue
+		case dtMeridian:
+			rest := strings.ToUpper(string(s[pos:]))
+			matched := false
+			for _, m := range []string{"A.M.", "P.M.", "AM", "PM"} {
+				if strings.HasPrefix(rest, m) && len(m) == item.width {
+					f.pm = m[0] == 'P'
+					pos += len(m)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return datetime{}, fmt.Errorf("invalid value %q for %q", string(s[pos:]), item.name)
+			}
+			f.set[item.field] = true
+			continue
+		case dtTZHour:
+			if pos < len(s) && (s[pos] == '+' || s[pos] == '-') {
+				if s[pos] == '-' {
+					f.tzSign = -1
+				}
+				pos++
+			}
+		}
+
+		val, end := readDigits(s, pos, item.width)
+		if end == pos {
+			return datetime{}, fmt.Errorf("invalid value %q for %q", string(s[pos:]), item.name)
+		}
+		digits := end - pos
+		pos = end
+		f.set[item.field] = true
+
+		switch item.field {
+		case dtYear:
+			f.year = val
+		case dtYear3:
+			if val < 520 {
+				f.year = val + 2000
+			} else {
+				f.year = val + 1000
+			}
+		case dtYear2, dtRoundedYear2:
+			if val < 70 {
+				f.year = val + 2000
+			} else {
+				f.year = val + 1900
+			}
+		case dtRoundedYear:
+			f.year = val
+			if digits <= 2 {
+				if val < 70 {
+					f.year = val + 2000
+				} else {
+					f.year = val + 1900
+				}
+			}
+		case dtYear1:
+			f.year = val + 2000
+		case dtMonth:
+			f.month = val
+		case dtDay:
+			f.day = val
+		case dtDayOfYear:
+			f.dayOfYear = val
+		case dtHour24, dtHour12:
+			f.hour = val
+		case dtMinute:
+			f.minute = val
+		case dtSecond:
+			f.second = val
+		case dtSecondOfDay:
+			f.secondOfDay = val
+		case dtFraction:
+			for i := digits; i < 9; i++ {
+				val *= 10
+			}
+			f.nanos = val
+		case dtTZHour:
+			f.tzHour = val
+		case dtTZMinute:
+			f.tzMinute = val
+		}
+	}
+	if pos < len(s) {
+		return datetime{}, fmt.Errorf("trailing characters remain in input string %q after datetime template %q", input, t.raw)
+	}
+	return f.build(t.kind, input)
+}
+
+func (f *datetimeFields) build(kind datetimeKind, input string) (datetime, error) {
+	outOfRange := fmt.Errorf("date/time field value out of range: %q", input)
+
+	year := 1
+	if f.set[dtYear] || f.set[dtYear3] || f.set[dtYear2] || f.set[dtYear1] || f.set[dtRoundedYear] || f.set[dtRoundedYear2] {
+		year = f.year
+	}
+	if f.month < 1 || f.month > 12 {
+		return datetime{}, outOfRange
+	}
+	month := time.Month(f.month)
+	day := f.day
+	if f.set[dtDayOfYear] {
+		daysInYear := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		if f.dayOfYear < 1 || f.dayOfYear > daysInYear {
+			return datetime{}, outOfRange
+		}
+		d := time.Date(year, time.January, f.dayOfYear, 0, 0, 0, 0, time.UTC)
+		month, day = d.Month(), d.Day()
+	}
+	if day < 1 || day > time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day() {
+		return datetime{}, outOfRange
+	}
+
+	hour, minute, second := f.hour, f.minute, f.second
+	if f.set[dtSecondOfDay] {
+		if f.secondOfDay > 86399 {
+			return datetime{}, outOfRange
+		}
+		hour, minute, second = f.secondOfDay/3600, f.secondOfDay/60%60, f.secondOfDay%60
+	}
+	if f.set[dtHour12] {
+		if hour < 1 || hour > 12 {
+			return datetime{}, outOfRange
+		}
+		if hour == 12 {
+			hour = 0
+		}
+		if f.pm {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 || second > 59 {
+		return datetime{}, outOfRange
+	}
+	if f.tzHour > 15 || f.tzMinute > 59 {
+		return datetime{}, outOfRange
+	}
+
+	loc := time.UTC
+	if kind == timeTZKind || kind == timestampTZKind {
+		offset := f.tzSign * (f.tzHour*3600 + f.tzMinute*60)
+		loc = time.FixedZone("", offset)
+	}
+	if kind == timeKind || kind == timeTZKind {
+		year, month, day = 1, time.January, 1
+	}
+	if kind == dateKind {
+		hour, minute, second, f.nanos = 0, 0, 0, 0
+	}
+	return datetime{
+		kind: kind,
+		t:    time.Date(year, month, day, hour, minute, second, f.nanos, loc),
+	}, nil
+}
+
+// parseDatetime recognises a datetime string in one of the ISO 8601 forms
+// accepted by .datetime() when no template is given.
+func parseDatetime(s string) (datetime, error) {
+	for _, t := range isoDatetimeTemplates {
+		if d, err := t.parse(s); err == nil {
+			return d, nil
+		}
+	}
+	return datetime{}, fmt.Errorf("datetime format is not recognized: %q", s)
+}
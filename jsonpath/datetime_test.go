@@ -0,0 +1,82 @@
+package jsonpath
+
+import "testing"
+
+func TestDatetimeTemplate(t *testing.T) {
+	testCases := []struct {
+		template string
+		input    string
+		expected string
+		kind     datetimeKind
+	}{
+		{"YYYY-MM-DD", "2017-03-10", "2017-03-10", dateKind},
+		{"YYYY-MM-DD", "2017-3-1", "2017-03-01", dateKind},
+		{"yyyy-mm-dd", "2017-03-10", "2017-03-10", dateKind},
+		{"YYYYMMDD", "20170310", "2017-03-10", dateKind},
+		{"DD.MM.YY", "10.03.17", "2017-03-10", dateKind},
+		{"DD.MM.YY", "10.03.87", "1987-03-10", dateKind},
+		{"DD.MM.RR", "10.03.87", "1987-03-10", dateKind},
+		{"YYYY DDD", "2016 366", "2016-12-31", dateKind},
+		{"MM/DD", "03/10", "0001-03-10", dateKind},
+		{"HH24:MI", "23:59", "23:59:00", timeKind},
+		{"HH:MI P.M.", "12:30 a.m.", "00:30:00", timeKind},
+		{"HH12:MI PM", "12:30 PM", "12:30:00", timeKind},
+		{"SSSSS", "3661", "01:01:01", timeKind},
+		{"HH24:MI:SS.FF1", "01:02:03.4", "01:02:03.4", timeKind},
+		{"HH24:MI:SS.FF9", "01:02:03.000000005", "01:02:03.000000005", timeKind},
+		{"HH24:MI:SS.MS", "01:02:03.12", "01:02:03.12", timeKind},
+		{"HH24:MI TZH", "01:02 -03", "01:02:00-03:00", timeTZKind},
+		{"HH24:MI TZH:TZM", "01:02 +05:45", "01:02:00+05:45", timeTZKind},
+		{`YYYY-MM-DD"T"HH24:MI:SS`, "2017-03-10T01:02:03", "2017-03-10T01:02:03", timestampKind},
+		{`YYYY-MM-DD"T"HH24:MI:SS`, "2017-03-10t01:02:03", "2017-03-10T01:02:03", timestampKind},
+		{"YYYY-MM-DD TZH", "2017-03-10 +02", "2017-03-10T00:00:00+02:00", timestampTZKind},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.template+"/"+tc.input, func(t *testing.T) {
+			tmpl, err := compileDatetimeTemplate(tc.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := tmpl.parse(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.kind != tc.kind {
+				t.Errorf("expected kind %s, got %s", datetime{kind: tc.kind}.typeName(), d.typeName())
+			}
+			if d.String() != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, d.String())
+			}
+		})
+	}
+}
+
+func TestDatetimeTemplateErrors(t *testing.T) {
+	testCases := []struct {
+		template string
+		errMsg   string
+	}{
+		{"", `datetime template "" contains no date or time fields`},
+		{`"T"`, `datetime template "\"T\"" contains no date or time fields`},
+		{"YYYY-MM-DD\"T", `unterminated quoted text in datetime template "YYYY-MM-DD\"T"`},
+		{"YYYY-MM-DDTHH24", `invalid datetime template element at "THH24"`},
+		{"YYYY-MM-MM", `datetime template element "MM" conflicts with "MM"`},
+		{"YYYY-YY", `datetime template "YYYY-YY" specifies the year more than once`},
+		{"DDD MM", `datetime template element "DDD" conflicts with "MM"`},
+		{"SSSSS MI", `datetime template element "SSSSS" conflicts with "MI"`},
+		{"HH24 HH12", `datetime template element "HH24" conflicts with "HH12"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.template, func(t *testing.T) {
+			_, err := compileDatetimeTemplate(tc.template)
+			if err == nil {
+				t.Fatalf("expected %q to error with %q, but no error occurred", tc.template, tc.errMsg)
+			}
+			if err.Error() != tc.errMsg {
+				t.Fatalf("expected %q to error with %q, but error was %q", tc.template, tc.errMsg, err.Error())
+			}
+		})
+	}
+}
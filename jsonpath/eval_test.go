@@ -5,7 +5,7 @@ import "testing"
 func TestEval(t *testing.T) {
 	testCases := []struct {
 		input  string
-		result jsonPathNode
+		result Node
 	}{}
 
 	for _, tc := range testCases {
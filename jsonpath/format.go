@@ -3,110 +3,175 @@ package jsonpath
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
-func FormatNode(n jsonPathNode) string {
+// FormatNode writes n as a jsonpath, with only the parentheses which
+// precedence requires. For any tree which Validate accepts, parsing the result
+// (in the program's mode, if it was implicit) gives back an equal tree.
+func FormatNode(n Node) string {
 	b := bytes.NewBuffer(nil)
 	n.Format(b)
 	return b.String()
 }
 
 func (s Program) Format(b *bytes.Buffer) {
-	if s.mode == modeLax {
-		b.WriteString("lax ")
-	}
-	if s.mode == modeStrict {
-		b.WriteString("strict ")
+	if !s.Implicit || s.PrintImplicitMode {
+		if s.Mode == ModeLax {
+			b.WriteString("lax ")
+		}
+		if s.Mode == ModeStrict {
+			b.WriteString("strict ")
+		}
 	}
-	s.root.Format(b)
+	s.Root.Format(b)
 }
 
 func (s NumberExpr) Format(b *bytes.Buffer) {
-	b.WriteString(fmt.Sprintf("%v", s.val))
+	b.WriteString(s.val.String())
+}
+
+// The precedence of expressions and predicates, from loosest to tightest.
+// Every binary operator groups to the left, so a right operand needs
+// parentheses even when it binds only as tightly as its operator.
+const (
+	precOr = iota + 1
+	precAnd
+	precNot
+)
+
+const (
+	precAdd = iota + 1
+	precMul
+	precUnary
+	precPrimary
+)
+
+// unparen returns e without the ParenExprs around it, which the formatter
+// leaves out in favour of its own parentheses.
+func unparen(e Expr) Expr {
+	for {
+		p, ok := e.(ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.Expr
+	}
+}
+
+// unparenPred returns p without the ParenPreds around it.
+func unparenPred(p Pred) Pred {
+	for {
+		paren, ok := p.(ParenPred)
+		if !ok {
+			return p
+		}
+		p = paren.Pred
+	}
+}
+
+func exprPrec(e Expr) int {
+	switch t := unparen(e).(type) {
+	case BinExpr:
+		if t.Op == PlusBinOp || t.Op == MinusBinOp {
+			return precAdd
+		}
+		return precMul
+	case UnaryExpr:
+		return precUnary
+	}
+	return precPrimary
+}
+
+func predPrec(p Pred) int {
+	if t, ok := unparenPred(p).(BinLogic); ok {
+		if t.Op == OrBinOp {
+			return precOr
+		}
+		return precAnd
+	}
+	return precNot
+}
+
+// formatExpr writes e, in parentheses if it binds more loosely than prec.
+func formatExpr(b *bytes.Buffer, e Expr, prec int) {
+	if exprPrec(e) < prec {
+		b.WriteByte('(')
+		e.Format(b)
+		b.WriteByte(')')
+	} else {
+		e.Format(b)
+	}
+}
+
+// formatPred writes p, in parentheses if it binds more loosely than prec.
+func formatPred(b *bytes.Buffer, p Pred, prec int) {
+	if predPrec(p) < prec {
+		b.WriteByte('(')
+		p.Format(b)
+		b.WriteByte(')')
+	} else {
+		p.Format(b)
+	}
 }
 
 func (s BinExpr) Format(b *bytes.Buffer) {
-	s.left.Format(b)
+	prec := exprPrec(s)
+	formatExpr(b, s.Left, prec)
 	b.WriteByte(' ')
-	switch s.t {
-	case plusBinOp:
-		b.WriteByte('+')
-	case minusBinOp:
-		b.WriteByte('-')
-	case timesBinOp:
-		b.WriteByte('*')
-	case divBinOp:
-		b.WriteByte('/')
-	case modBinOp:
-		b.WriteByte('%')
-	}
+	b.WriteString(s.Op.String())
 	b.WriteByte(' ')
-	s.right.Format(b)
+	formatExpr(b, s.Right, prec+1)
 }
 
 func (s BinPred) Format(b *bytes.Buffer) {
-	s.left.Format(b)
+	s.Left.Format(b)
 	b.WriteByte(' ')
-	switch s.t {
-	case eqBinOp:
-		b.WriteString("==")
-	case neqBinOp:
-		b.WriteString("!=")
-	case ltBinOp:
-		b.WriteByte('<')
-	case gtBinOp:
-		b.WriteByte('>')
-	case lteBinOp:
-		b.WriteString("<=")
-	case gteBinOp:
-		b.WriteString(">=")
-	}
+	b.WriteString(s.Op.String())
 	b.WriteByte(' ')
-	s.right.Format(b)
+	s.Right.Format(b)
 }
 
 func (s BinLogic) Format(b *bytes.Buffer) {
-	s.left.Format(b)
+	prec := predPrec(s)
+	formatPred(b, s.Left, prec)
 	b.WriteByte(' ')
-	switch s.t {
-	case orBinOp:
-		b.WriteString("||")
-	case andBinOp:
-		b.WriteString("&&")
-	}
+	b.WriteString(s.Op.String())
 	b.WriteByte(' ')
-	s.right.Format(b)
+	formatPred(b, s.Right, prec+1)
 }
 
 func (s UnaryExpr) Format(b *bytes.Buffer) {
-	switch s.t {
-	case uminus:
-		b.WriteByte('-')
-	case uplus:
-		b.WriteByte('+')
-	}
-	s.expr.Format(b)
+	b.WriteString(s.Op.String())
+	formatExpr(b, s.Expr, precUnary)
 }
 
 func (s UnaryNot) Format(b *bytes.Buffer) {
 	b.WriteByte('!')
-	s.expr.Format(b)
+	switch unparenPred(s.Pred).(type) {
+	case ExistsNode, IsUnknownNode, UnaryNot:
+		s.Pred.Format(b)
+	default:
+		// The grammar would allow `!@ > 1`, but it reads too easily as
+		// (!@) > 1.
+		b.WriteByte('(')
+		s.Pred.Format(b)
+		b.WriteByte(')')
+	}
 }
 
 func (s ParenPred) Format(b *bytes.Buffer) {
-	b.WriteByte('(')
-	s.expr.Format(b)
-	b.WriteByte(')')
+	s.Pred.Format(b)
 }
 
 func (s ParenExpr) Format(b *bytes.Buffer) {
-	b.WriteByte('(')
-	s.expr.Format(b)
-	b.WriteByte(')')
+	s.Expr.Format(b)
 }
 
 func (s VariableExpr) Format(b *bytes.Buffer) {
-	b.WriteString(s.name)
+	b.WriteString(s.Name)
 }
 
 func (s LastExpr) Format(b *bytes.Buffer) {
@@ -114,7 +179,7 @@ func (s LastExpr) Format(b *bytes.Buffer) {
 }
 
 func (s BoolExpr) Format(b *bytes.Buffer) {
-	if s.val {
+	if s.Value {
 		b.WriteString("true")
 	} else {
 		b.WriteString("false")
@@ -126,20 +191,31 @@ func (s NullExpr) Format(b *bytes.Buffer) {
 }
 
 func (s StringExpr) Format(b *bytes.Buffer) {
-	b.WriteString(fmt.Sprintf("%#v", s.val))
+	b.WriteString(quoteString(s.Value))
 }
 
 func (s AccessExpr) Format(b *bytes.Buffer) {
-	s.left.Format(b)
-	s.right.Format(b)
+	formatAccessed(b, s.Left)
+	s.Right.Format(b)
+}
+
+// formatAccessed writes e as the left hand side of an AccessExpr.
+func formatAccessed(b *bytes.Buffer, e Expr) {
+	// Arithmetic can't be accessed, so the parentheses only make an invalid
+	// tree readable.
+	formatExpr(b, e, precPrimary)
+	if n, ok := unparen(e).(NumberExpr); ok && n.val.scale == 0 {
+		// Otherwise the lexer would take the dot as a decimal point.
+		b.WriteByte(' ')
+	}
 }
 
 func (s DotAccessor) Format(b *bytes.Buffer) {
 	b.WriteByte('.')
-	if s.quoted {
-		b.WriteString(fmt.Sprintf("%#v", s.val))
+	if s.Quoted || !isIdentifier(s.Name) {
+		b.WriteString(quoteString(s.Name))
 	} else {
-		b.WriteString(s.val)
+		b.WriteString(s.Name)
 	}
 }
 
@@ -149,7 +225,7 @@ func (s MemberWildcardAccessor) Format(b *bytes.Buffer) {
 
 func (s ArrayAccessor) Format(b *bytes.Buffer) {
 	b.WriteByte('[')
-	for i, elem := range s.subscripts {
+	for i, elem := range s.Subscripts {
 		if i != 0 {
 			b.WriteString(", ")
 		}
@@ -159,10 +235,10 @@ func (s ArrayAccessor) Format(b *bytes.Buffer) {
 }
 
 func (s RangeSubscriptNode) Format(b *bytes.Buffer) {
-	s.start.Format(b)
-	if s.end != nil {
+	s.Start.Format(b)
+	if s.End != nil {
 		b.WriteString(" to ")
-		s.end.Format(b)
+		s.End.Format(b)
 	}
 }
 
@@ -170,60 +246,140 @@ func (s WildcardArrayAccessor) Format(b *bytes.Buffer) {
 	b.WriteString("[*]")
 }
 
+func formatLevel(b *bytes.Buffer, level int) {
+	if level == LastLevel {
+		b.WriteString("last")
+	} else {
+		b.WriteString(strconv.Itoa(level))
+	}
+}
+
+func (s RecursiveWildcardAccessor) Format(b *bytes.Buffer) {
+	b.WriteString(".**")
+	if s.First == 0 && s.Last == LastLevel {
+		return
+	}
+	b.WriteByte('{')
+	formatLevel(b, s.First)
+	if s.First != s.Last {
+		b.WriteString(" to ")
+		formatLevel(b, s.Last)
+	}
+	b.WriteByte('}')
+}
+
+var functionNames = map[Function]string{
+	TypeFunction:        "type",
+	SizeFunction:        "size",
+	DoubleFunction:      "double",
+	CeilingFunction:     "ceiling",
+	FloorFunction:       "floor",
+	AbsFunction:         "abs",
+	DatetimeFunction:    "datetime",
+	KeyvalueFunction:    "keyvalue",
+	BigintFunction:      "bigint",
+	IntegerFunction:     "integer",
+	NumberFunction:      "number",
+	DecimalFunction:     "decimal",
+	StringFunction:      "string",
+	BooleanFunction:     "boolean",
+	DateFunction:        "date",
+	TimeFunction:        "time",
+	TimeTZFunction:      "time_tz",
+	TimestampFunction:   "timestamp",
+	TimestampTZFunction: "timestamp_tz",
+}
+
+// String returns the name of the item method.
+func (f Function) String() string {
+	return functionNames[f]
+}
+
 func (s FuncNode) Format(b *bytes.Buffer) {
-	switch s.f {
-	case typeFunction:
-		b.WriteString(".type()")
-	case sizeFunction:
-		b.WriteString(".size()")
-	case doubleFunction:
-		b.WriteString(".double()")
-	case ceilingFunction:
-		b.WriteString(".ceiling()")
-	case floorFunction:
-		b.WriteString(".floor()")
-	case absFunction:
-		b.WriteString(".abs()")
-	case datetimeFunction:
-		b.WriteString(".datetime(")
-		s.arg.Format(b)
-		b.WriteByte(')')
-	case keyvalueFunction:
-		b.WriteString(".keyvalue()")
+	b.WriteByte('.')
+	b.WriteString(s.Func.String())
+	b.WriteByte('(')
+	for i, a := range s.Args {
+		if i != 0 {
+			b.WriteString(", ")
+		}
+		a.Format(b)
 	}
+	b.WriteByte(')')
 }
 
 func (s FilterNode) Format(b *bytes.Buffer) {
-	b.WriteString(" ? (")
-	s.pred.Format(b)
+	b.WriteString("?(")
+	s.Pred.Format(b)
 	b.WriteByte(')')
 }
 
 func (s ExistsNode) Format(b *bytes.Buffer) {
 	b.WriteString("exists (")
-	s.expr.Format(b)
+	s.Expr.Format(b)
 	b.WriteByte(')')
 }
 
 func (s LikeRegexNode) Format(b *bytes.Buffer) {
-	s.left.Format(b)
+	s.Left.Format(b)
 	b.WriteString(" like_regex ")
-	b.WriteString(fmt.Sprintf("%#v", s.rawPattern))
-	if s.flag != nil {
+	b.WriteString(quoteString(s.Pattern))
+	if s.Flag != "" {
 		b.WriteString(" flag ")
-		b.WriteString(fmt.Sprintf("%#v", *s.flag))
+		b.WriteString(quoteString(s.Flag))
 	}
 }
 
 func (s StartsWithNode) Format(b *bytes.Buffer) {
-	s.left.Format(b)
+	s.Left.Format(b)
 	b.WriteString(" starts with ")
-	s.right.Format(b)
+	s.Right.Format(b)
 }
 
 func (s IsUnknownNode) Format(b *bytes.Buffer) {
 	b.WriteByte('(')
-	s.expr.Format(b)
+	s.Pred.Format(b)
 	b.WriteByte(')')
 	b.WriteString(" is unknown")
 }
+
+func (s BadNode) Format(b *bytes.Buffer) {
+	b.WriteString("<error>")
+}
+
+// quoteString writes s as a double-quoted jsonpath string, escaping what the
+// lexer would otherwise misread or which isn't printable.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\v':
+			b.WriteString(`\v`)
+		default:
+			if unicode.IsPrint(r) {
+				b.WriteRune(r)
+			} else if r <= 0xffff {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				fmt.Fprintf(&b, `\u{%x}`, r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,285 @@
+package jsonpath
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	one, two, three := NewIntExpr(1), NewIntExpr(2), NewIntExpr(3)
+	at := NewVariableExpr("@")
+	eq := func(i int64) BinPred { return NewBinPred(EqBinOp, at, NewIntExpr(i)) }
+	filter := func(p Pred) Expr { return NewAccessExpr(NewVariableExpr("$"), NewFilterNode(p)) }
+
+	testCases := []struct {
+		root     Expr
+		expected string
+	}{
+		{NewBinExpr(TimesBinOp, NewBinExpr(PlusBinOp, one, two), three), "(1 + 2) * 3"},
+		{NewBinExpr(PlusBinOp, one, NewBinExpr(TimesBinOp, two, three)), "1 + 2 * 3"},
+		{NewBinExpr(MinusBinOp, NewBinExpr(MinusBinOp, one, two), three), "1 - 2 - 3"},
+		{NewBinExpr(MinusBinOp, one, NewBinExpr(MinusBinOp, two, three)), "1 - (2 - 3)"},
+		{NewBinExpr(PlusBinOp, one, NewBinExpr(PlusBinOp, two, three)), "1 + (2 + 3)"},
+		{NewBinExpr(DivBinOp, one, NewBinExpr(ModBinOp, two, three)), "1 / (2 % 3)"},
+		{NewUnaryExpr(UMinus, NewBinExpr(PlusBinOp, one, two)), "-(1 + 2)"},
+		{NewUnaryExpr(UMinus, NewUnaryExpr(UMinus, one)), "--1"},
+		{NewBinExpr(TimesBinOp, NewUnaryExpr(UPlus, one), NewUnaryExpr(UMinus, two)), "+1 * -2"},
+		{NewAccessExpr(one, NewDotAccessor("a")), "1 .a"},
+		{NewAccessExpr(mustParseNumber(t, "1.5"), NewDotAccessor("a")), "1.5.a"},
+		{NewAccessExpr(NewVariableExpr("$"), DotAccessor{Name: "a b", Quoted: true}), "$.\"a b\""},
+		{NewAccessExpr(NewVariableExpr("$"), NewDotAccessor("é\n\"")), "$.\"é\\n\\\"\""},
+		{filter(NewBinLogic(AndBinOp, NewBinLogic(OrBinOp, eq(1), eq(2)), eq(3))), "$?((@ == 1 || @ == 2) && @ == 3)"},
+		{filter(NewBinLogic(OrBinOp, eq(1), NewBinLogic(AndBinOp, eq(2), eq(3)))), "$?(@ == 1 || @ == 2 && @ == 3)"},
+		{filter(NewBinLogic(OrBinOp, eq(1), NewBinLogic(OrBinOp, eq(2), eq(3)))), "$?(@ == 1 || (@ == 2 || @ == 3))"},
+		{filter(NewUnaryNot(NewBinLogic(AndBinOp, eq(1), eq(2)))), "$?(!(@ == 1 && @ == 2))"},
+		{filter(NewUnaryNot(eq(1))), "$?(!(@ == 1))"},
+		{filter(NewUnaryNot(NewUnaryNot(NewExistsNode(at)))), "$?(!!exists (@))"},
+		{filter(NewIsUnknownNode(NewBinLogic(OrBinOp, eq(1), eq(2)))), "$?((@ == 1 || @ == 2) is unknown)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			p := NewProgram(ModeStrict, tc.root)
+			p.Implicit = true
+			if FormatNode(p) != tc.expected {
+				t.Fatalf("expected `%s`, got `%s`", tc.expected, FormatNode(p))
+			}
+			parsed, err := ParseWithOptions(tc.expected, ParseOptions{Mode: ModeStrict})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, p) {
+				t.Fatalf("expected %#v, got %#v", p, parsed)
+			}
+		})
+	}
+}
+
+func TestFormatDropsRedundantParens(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"lax 1 - ((((1 + 2))))", "lax 1 - (1 + 2)"},
+		{"lax (1 * 2) + (3)", "lax 1 * 2 + 3"},
+		{"lax -(1)", "lax -1"},
+		{"lax $ ? ((1 != 1) || 1 == 1)", "lax $?(1 != 1 || 1 == 1)"},
+		{"lax $ ? ((1 == 1))", "lax $?(1 == 1)"},
+		{"lax $ ? (!@ > 1)", "lax $?(!(@ > 1))"},
+		{"lax $ ? (!(exists (@)))", "lax $?(!exists (@))"},
+	}
+	for _, tc := range testCases {
+		p, err := Parse(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if FormatNode(p) != tc.expected {
+			t.Errorf("expected `%s`, got `%s`", tc.expected, FormatNode(p))
+		}
+	}
+}
+
+func TestFormatRadixLiterals(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"lax 0x0", "lax 0"},
+		{"lax 0o0", "lax 0"},
+		{"lax 0b0", "lax 0"},
+		{"lax 0x00", "lax 0"},
+		{"lax 0x1F", "lax 31"},
+		{"lax -0b101", "lax -5"},
+	}
+	for _, tc := range testCases {
+		p, err := Parse(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if FormatNode(p) != tc.expected {
+			t.Errorf("expected `%s`, got `%s`", tc.expected, FormatNode(p))
+		}
+		parsed, err := Parse(FormatNode(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parsed, p) {
+			t.Errorf("%s: expected %#v, got %#v", tc.input, p, parsed)
+		}
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		g := &astGenerator{r: r}
+		p := NewProgram(Mode(r.Intn(2)), g.expr(4))
+		p.Implicit = r.Intn(2) == 0
+		if errs := Validate(p); len(errs) > 0 {
+			t.Fatalf("generated an invalid tree `%s`: %v", FormatNode(p), errs)
+		}
+		text := FormatNode(p)
+		parsed, err := parse(text, ParseOptions{Mode: p.Mode})
+		if err != nil {
+			t.Fatalf("could not parse `%s`: %v", text, err)
+		}
+		if !reflect.DeepEqual(parsed, p) {
+			t.Fatalf("`%s` parsed as `%s`:\nexpected %#v\ngot      %#v", text, FormatNode(parsed), p, parsed)
+		}
+	}
+}
+
+func mustParseNumber(t *testing.T, s string) NumberExpr {
+	n, err := NewNumberExpr(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// astGenerator generates random trees which Validate accepts.
+type astGenerator struct {
+	r           *rand.Rand
+	inFilter    bool
+	inSubscript bool
+}
+
+var (
+	genNumbers = []string{"0", "1", "2.50", "1000", "0.001", "12345678901234567890"}
+	genStrings = []string{"", "a", "a b", "\"", "\\", "\n\t", "\x01", "é", "😀", "$x", "type"}
+	genNames   = []string{"a", "b_c", "a b", "", "type", "true", "last", "$x", "é", "1"}
+)
+
+func (g *astGenerator) pick(s []string) string {
+	return s[g.r.Intn(len(s))]
+}
+
+func (g *astGenerator) number() NumberExpr {
+	n, _ := NewNumberExpr(g.pick(genNumbers))
+	return n
+}
+
+func (g *astGenerator) primary() Expr {
+	switch g.r.Intn(8) {
+	case 0:
+		return g.number()
+	case 1:
+		return NewStringExpr(g.pick(genStrings))
+	case 2:
+		return NewBoolExpr(g.r.Intn(2) == 0)
+	case 3:
+		return NullExpr{}
+	case 4:
+		return NewVariableExpr("$x")
+	case 5:
+		if g.inSubscript {
+			return LastExpr{}
+		}
+	case 6:
+		if g.inFilter {
+			return NewVariableExpr("@")
+		}
+	}
+	return NewVariableExpr("$")
+}
+
+func (g *astGenerator) expr(depth int) Expr {
+	if depth <= 0 {
+		return g.primary()
+	}
+	switch g.r.Intn(6) {
+	case 0:
+		return NewBinExpr(BinExprType(g.r.Intn(5)), g.expr(depth-1), g.expr(depth-1))
+	case 1:
+		return NewUnaryExpr(UnaryExprType(g.r.Intn(2)), g.expr(depth-1))
+	case 2, 3:
+		e := g.primary()
+		for n := g.r.Intn(3) + 1; n > 0; n-- {
+			e = NewAccessExpr(e, g.accessor(depth-1))
+		}
+		return e
+	}
+	return g.primary()
+}
+
+func (g *astGenerator) accessor(depth int) Accessor {
+	switch g.r.Intn(8) {
+	case 0:
+		d := NewDotAccessor(g.pick(genNames))
+		d.Quoted = d.Quoted || g.r.Intn(2) == 0
+		return d
+	case 1:
+		return MemberWildcardAccessor{}
+	case 2:
+		return WildcardArrayAccessor{}
+	case 3:
+		levels := [][2]int{{0, LastLevel}, {1, 1}, {1, LastLevel}, {2, 3}, {LastLevel, LastLevel}}
+		l := levels[g.r.Intn(len(levels))]
+		return NewRecursiveWildcardAccessor(l[0], l[1])
+	case 4:
+		inSubscript := g.inSubscript
+		g.inSubscript = true
+		defer func() { g.inSubscript = inSubscript }()
+		subscripts := make([]RangeSubscriptNode, g.r.Intn(3)+1)
+		for i := range subscripts {
+			subscripts[i] = NewSubscript(g.expr(depth - 1))
+			if g.r.Intn(2) == 0 {
+				subscripts[i].End = g.expr(depth - 1)
+			}
+		}
+		return NewArrayAccessor(subscripts...)
+	case 5:
+		return g.method()
+	}
+	inFilter := g.inFilter
+	g.inFilter = true
+	defer func() { g.inFilter = inFilter }()
+	return NewFilterNode(g.pred(depth - 1))
+}
+
+func (g *astGenerator) method() FuncNode {
+	f := Function(g.r.Intn(len(functionNames)))
+	var args []Node
+	switch {
+	case f == DatetimeFunction:
+		if g.r.Intn(2) == 0 {
+			args = []Node{NewStringExpr("HH24:MI")}
+		}
+	case f == DecimalFunction:
+		precision, _ := NewNumberExpr("10")
+		scale, _ := NewNumberExpr("-2")
+		args = []Node{precision, scale}[:g.r.Intn(3)]
+	default:
+		if _, ok := datetimeMethodKinds[f]; ok && f != DateFunction && g.r.Intn(2) == 0 {
+			precision, _ := NewNumberExpr("3")
+			args = []Node{precision}
+		}
+	}
+	if len(args) == 0 {
+		args = nil
+	}
+	return NewFuncNode(f, args...)
+}
+
+func (g *astGenerator) pred(depth int) Pred {
+	if depth <= 0 {
+		return NewBinPred(BinPredType(g.r.Intn(6)), g.primary(), g.primary())
+	}
+	switch g.r.Intn(8) {
+	case 0, 1:
+		return NewBinLogic(BinLogicType(g.r.Intn(2)), g.pred(depth-1), g.pred(depth-1))
+	case 2:
+		return NewUnaryNot(g.pred(depth - 1))
+	case 3:
+		return NewExistsNode(g.expr(depth - 1))
+	case 4:
+		n, _ := NewLikeRegexNode(g.expr(depth-1), "^a.*b$", []string{"", "i", "sq"}[g.r.Intn(3)])
+		return n
+	case 5:
+		return NewStartsWithNode(g.expr(depth-1), g.expr(depth-1))
+	case 6:
+		return NewIsUnknownNode(g.pred(depth - 1))
+	}
+	return NewBinPred(BinPredType(g.r.Intn(6)), g.expr(depth-1), g.expr(depth-1))
+}
@@ -3,6 +3,7 @@ package jsonpath
 
 import (
   "fmt"
+  "math"
   "regexp"
 )
 
@@ -13,21 +14,27 @@ type jsonpathSymUnion struct {
 %}
 
 %union {
-  expr jsonPathExpr
-  pred jsonPathPred
-  vals []jsonPathNode
+  expr Expr
+  pred Pred
+  vals []Node
   regexp *regexp.Regexp
   ranges []RangeSubscriptNode
   rangeNode RangeSubscriptNode
-  accessor accessor
+  accessor Accessor
   str string
+  level int
+  // pos is the span of a token or of the tokens a rule matched.
+  pos span
 }
 
-%token <val> AND
+%token <val> AND ANY
 %token <val> EQ EXISTS
 %token <val> FALSE FLAG
 %token <val> FUNC_DATETIME FUNC_KEYVALUE
 %token <val> FUNC_TYPE FUNC_SIZE FUNC_DOUBLE FUNC_CEILING FUNC_FLOOR FUNC_ABS
+%token <val> FUNC_BIGINT FUNC_INTEGER FUNC_NUMBER FUNC_DECIMAL
+%token <val> FUNC_STRING FUNC_BOOLEAN
+%token <val> FUNC_DATE FUNC_TIME FUNC_TIME_TZ FUNC_TIMESTAMP FUNC_TIMESTAMP_TZ
 %token <val> GTE
 %token <str> IDENT IS
 %token <val> LAST LAX LTE LIKE_REGEX
@@ -54,6 +61,10 @@ type jsonpathSymUnion struct {
 %type <ranges> subscript_list
 %type <rangeNode> subscript
 %type <accessor> wildcard_array_accessor
+%type <accessor> recursive_wildcard_accessor
+%type <level> level
+%type <expr> int_literal
+%type <vals> opt_precision
 %type <accessor> item_method
 %type <accessor> method
 %type <accessor> filter_expression
@@ -81,51 +92,65 @@ type jsonpathSymUnion struct {
 root:
     LAX expr
     {
-      yylex.(*tokenStream).root = Program{
-        mode: modeLax,
-        root: $2,
-      }
+      yylex.(*tokenStream).program($2)
     }
     | STRICT expr
     {
-      yylex.(*tokenStream).root = Program{
-        mode: modeStrict,
-        root: $2,
-      }
+      yylex.(*tokenStream).program($2)
+    }
+    | expr
+    {
+      yylex.(*tokenStream).program($1)
+    }
+    | LAX error
+    {
+      yylex.(*tokenStream).program(BadNode{})
+    }
+    | STRICT error
+    {
+      yylex.(*tokenStream).program(BadNode{})
     }
 
 expr:
     '(' expr ')'
     {
-      $$ = ParenExpr{$2}
+      $$ = $2
+      $<pos>$ = span{$<pos>1.begin, $<pos>3.end}
     }
     | expr '+' expr
     {
-      $$ = BinExpr{t: plusBinOp, left: $1, right: $3}
+      $$ = BinExpr{Op: PlusBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | expr '-' expr
     {
-      $$ = BinExpr{t: minusBinOp, left: $1, right: $3}
+      $$ = BinExpr{Op: MinusBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | expr '*' expr
     {
-      $$ = BinExpr{t: timesBinOp, left: $1, right: $3}
+      $$ = BinExpr{Op: TimesBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | expr '/' expr
     {
-      $$ = BinExpr{t: divBinOp, left: $1, right: $3}
+      $$ = BinExpr{Op: DivBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | expr '%' expr
     {
-      $$ = BinExpr{t: modBinOp, left: $1, right: $3}
+      $$ = BinExpr{Op: ModBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | '-' expr %prec UMINUS
     {
-      $$ = UnaryExpr{t: uminus, expr: $2}
+      $$ = UnaryExpr{Op: UMinus, Expr: $2}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2)
     }
     | '+' expr %prec UMINUS
     {
-      $$ = UnaryExpr{t: uplus, expr: $2}
+      $$ = UnaryExpr{Op: UPlus, Expr: $2}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2)
     }
     | accessor_expr
 
@@ -136,27 +161,29 @@ primary:
 
 /* 6.9.1 */
 literal:
-     NUMBER
-    | TRUE { $$ = BoolExpr{val: true} }
-    | FALSE { $$ = BoolExpr{val: false} }
-    | NULL { $$ = NullExpr{} }
-    | STR { $$ = StringExpr{$1} }
+     NUMBER { $$ = $1; yylex.(*tokenStream).built($<pos>1, $<pos>1) }
+    | TRUE { $$ = BoolExpr{Value: true}; yylex.(*tokenStream).built($<pos>1, $<pos>1) }
+    | FALSE { $$ = BoolExpr{Value: false}; yylex.(*tokenStream).built($<pos>1, $<pos>1) }
+    | NULL { $$ = NullExpr{}; yylex.(*tokenStream).built($<pos>1, $<pos>1) }
+    | STR { $$ = StringExpr{$1}; yylex.(*tokenStream).built($<pos>1, $<pos>1) }
 
 /* 6.9.2 */
 variable:
-    IDENT  { $$ = VariableExpr{name: $1} }
+    IDENT  { $$ = VariableExpr{Name: $1}; yylex.(*tokenStream).built($<pos>1, $<pos>1) }
     | '@' 
     {
-      $$ = VariableExpr{name: "@"}
+      $$ = VariableExpr{Name: "@"}
+      yylex.(*tokenStream).built($<pos>1, $<pos>1)
     }
-    | LAST { $$ = LastExpr{} }
+    | LAST { $$ = LastExpr{}; yylex.(*tokenStream).built($<pos>1, $<pos>1) }
 
 /* 6.10 */
 accessor_expr:
         primary
       | accessor_expr accessor
       {
-        $$ = AccessExpr{ left: $1, right: $2 }
+        $$ = AccessExpr{ Left: $1, Right: $2 }
+        $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2)
       }
 
 accessor:
@@ -164,23 +191,25 @@ accessor:
       | member_accessor_wildcard
       | array_accessor
       | wildcard_array_accessor
+      | recursive_wildcard_accessor
       | filter_expression
       | item_method
 
 /* 6.10.1 */
 member_accessor:
-           '.' IDENT { $$ = DotAccessor{val: $2} }
-           | '.' STR { $$ = DotAccessor{val: $2, quoted: true} }
+           '.' IDENT { $$ = DotAccessor{Name: $2}; $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2) }
+           | '.' STR { $$ = DotAccessor{Name: $2, Quoted: true}; $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2) }
 
 /* 6.10.2 */
 member_accessor_wildcard:
-           '.' '*' { $$ = MemberWildcardAccessor{} }
+           '.' '*' { $$ = MemberWildcardAccessor{}; $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2) }
 
 /* 6.10.3 */
 array_accessor:
         '[' subscript_list ']'
         {
-          $$ = ArrayAccessor{subscripts: $2}
+          $$ = ArrayAccessor{Subscripts: $2}
+          $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
         }
 
 subscript_list:
@@ -196,11 +225,17 @@ subscript_list:
 subscript:
      expr
     {
-      $$ = RangeSubscriptNode{start: $1, end: nil}
+      $$ = RangeSubscriptNode{Start: $1, End: nil}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>1)
     }
     | expr TO expr
     {
-      $$ = RangeSubscriptNode{start: $1, end: $3}
+      $$ = RangeSubscriptNode{Start: $1, End: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
+    }
+    | error
+    {
+      $$ = RangeSubscriptNode{Start: BadNode{}, End: nil}
     }
 
 /* 6.10.4 */
@@ -208,6 +243,44 @@ wildcard_array_accessor:
   '[' '*' ']'
   {
     $$ = WildcardArrayAccessor{}
+    $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
+  }
+
+/* PostgreSQL extension */
+recursive_wildcard_accessor:
+  '.' ANY
+  {
+    $$ = RecursiveWildcardAccessor{First: 0, Last: LastLevel}
+    $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2)
+  }
+  | '.' ANY '{' level '}'
+  {
+    $$ = RecursiveWildcardAccessor{First: $4, Last: $4}
+    $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>5)
+  }
+  | '.' ANY '{' level TO level '}'
+  {
+    $$ = RecursiveWildcardAccessor{First: $4, Last: $6}
+    $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>7)
+  }
+
+level:
+  NUMBER
+  {
+    n := $1.(NumberExpr).val
+    i, ok := n.int64()
+    if !ok || i < 0 || i > math.MaxInt32 {
+      msg := fmt.Sprintf("recursive wildcard level must be a non-negative integer, but found %v", n)
+      if yylex.(*tokenStream).reportAt(msg, $<pos>1) {
+        return 1
+      }
+      i = 0
+    }
+    $$ = int(i)
+  }
+  | LAST
+  {
+    $$ = LastLevel
   }
 
 /* 6.11 */
@@ -215,41 +288,122 @@ item_method:
     '.' method
     {
       $$ = $2
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2)
     }
 
 method:
-      FUNC_TYPE '(' ')' { $$ = FuncNode{typeFunction, nil} }
-      | FUNC_SIZE '(' ')' { $$ = FuncNode{sizeFunction, nil} }
-      | FUNC_DOUBLE '(' ')' { $$ = FuncNode{doubleFunction, nil} }
-      | FUNC_CEILING '(' ')' { $$ = FuncNode{ceilingFunction, nil} }
-      | FUNC_FLOOR '(' ')' { $$ = FuncNode{floorFunction, nil} }
-      | FUNC_ABS '(' ')' { $$ = FuncNode{absFunction, nil} }
-      | FUNC_DATETIME '(' STR ')' { $$ = FuncNode{datetimeFunction, StringExpr{$3}} }
-      | FUNC_KEYVALUE '(' ')' { $$ = FuncNode{keyvalueFunction, nil} }
+      FUNC_TYPE '(' ')' { $$ = FuncNode{Func: TypeFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_SIZE '(' ')' { $$ = FuncNode{Func: SizeFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_DOUBLE '(' ')' { $$ = FuncNode{Func: DoubleFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_CEILING '(' ')' { $$ = FuncNode{Func: CeilingFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_FLOOR '(' ')' { $$ = FuncNode{Func: FloorFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_ABS '(' ')' { $$ = FuncNode{Func: AbsFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_DATETIME '(' ')' { $$ = FuncNode{Func: DatetimeFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_DATETIME '(' STR ')'
+      {
+        $$ = NewFuncNode(DatetimeFunction, StringExpr{$3})
+        yylex.(*tokenStream).built($<pos>3, $<pos>3)
+        $<pos>$ = span{$<pos>1.begin, $<pos>4.end}
+      }
+      | FUNC_KEYVALUE '(' ')' { $$ = FuncNode{Func: KeyvalueFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_BIGINT '(' ')' { $$ = FuncNode{Func: BigintFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_INTEGER '(' ')' { $$ = FuncNode{Func: IntegerFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_NUMBER '(' ')' { $$ = FuncNode{Func: NumberFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_DECIMAL '(' ')' { $$ = FuncNode{Func: DecimalFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_DECIMAL '(' int_literal ')'
+      {
+        $$ = FuncNode{Func: DecimalFunction, Args: []Node{$3}}
+        $<pos>$ = span{$<pos>1.begin, $<pos>4.end}
+      }
+      | FUNC_DECIMAL '(' int_literal ',' int_literal ')'
+      {
+        $$ = FuncNode{Func: DecimalFunction, Args: []Node{$3, $5}}
+        $<pos>$ = span{$<pos>1.begin, $<pos>6.end}
+      }
+      | FUNC_STRING '(' ')' { $$ = FuncNode{Func: StringFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_BOOLEAN '(' ')' { $$ = FuncNode{Func: BooleanFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_DATE '(' ')' { $$ = FuncNode{Func: DateFunction}; $<pos>$ = span{$<pos>1.begin, $<pos>3.end} }
+      | FUNC_TIME '(' opt_precision ')' { $$ = FuncNode{Func: TimeFunction, Args: $3}; $<pos>$ = span{$<pos>1.begin, $<pos>4.end} }
+      | FUNC_TIME_TZ '(' opt_precision ')' { $$ = FuncNode{Func: TimeTZFunction, Args: $3}; $<pos>$ = span{$<pos>1.begin, $<pos>4.end} }
+      | FUNC_TIMESTAMP '(' opt_precision ')' { $$ = FuncNode{Func: TimestampFunction, Args: $3}; $<pos>$ = span{$<pos>1.begin, $<pos>4.end} }
+      | FUNC_TIMESTAMP_TZ '(' opt_precision ')' { $$ = FuncNode{Func: TimestampTZFunction, Args: $3}; $<pos>$ = span{$<pos>1.begin, $<pos>4.end} }
+
+opt_precision:
+      /* empty */ { $$ = nil }
+      | int_literal { $$ = []Node{$1} }
+
+int_literal:
+      NUMBER
+      {
+        $$ = $1
+        if n := $1.(NumberExpr).val; !n.isInteger() {
+          if yylex.(*tokenStream).reportAt(fmt.Sprintf("expected an integer, but found %v", n), $<pos>1) {
+            return 1
+          }
+          $$ = BadNode{}
+        }
+        yylex.(*tokenStream).built($<pos>1, $<pos>1)
+      }
+      | '-' NUMBER
+      {
+        n := $2.(NumberExpr).val
+        $$ = NumberExpr{val: n.neg()}
+        if !n.isInteger() {
+          if yylex.(*tokenStream).reportAt(fmt.Sprintf("expected an integer, but found -%v", n), span{$<pos>1.begin, $<pos>2.end}) {
+            return 1
+          }
+          $$ = BadNode{}
+        }
+        $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2)
+      }
+      | '+' NUMBER
+      {
+        $$ = $2
+        if n := $2.(NumberExpr).val; !n.isInteger() {
+          if yylex.(*tokenStream).reportAt(fmt.Sprintf("expected an integer, but found +%v", n), span{$<pos>1.begin, $<pos>2.end}) {
+            return 1
+          }
+          $$ = BadNode{}
+        }
+        $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2)
+      }
 
 /* 6.13 */
 filter_expression:
    '?' '(' predicate_primary ')'
     {
-      $$ = FilterNode{pred: $3}
+      $$ = FilterNode{Pred: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>4)
     }
   | '?' '(' expr ')'
     {
       n := FormatNode($3)
-      yylex.(*tokenStream).err = fmt.Errorf("filter expressions cannot be raw json values - if you expect `%s` to be boolean true, write `%s == true`", n, n)
-      return 0
+      msg := fmt.Sprintf("filter expressions cannot be raw json values - if you expect `%s` to be boolean true, write `%s == true`", n, n)
+      if _, ok := $3.(AccessExpr); ok {
+        // Other dialects test for existence this way.
+        msg += fmt.Sprintf(", or to test that it exists, write `exists (%s)`", n)
+      }
+      if yylex.(*tokenStream).reportAt(msg, span{$<pos>3.begin, $<pos>4.begin}) {
+        return 1
+      }
+      $$ = FilterNode{Pred: BadNode{}}
     }
 
 
 predicate_primary:
     delimited_predicate
   | non_delimited_predicate
+  | error
+  {
+    $$ = BadNode{}
+  }
 
 delimited_predicate:
   exists_pred
   | '(' predicate_primary ')'
   {
-    $$ = ParenPred{$2}
+    $$ = $2
+    $<pos>$ = span{$<pos>1.begin, $<pos>3.end}
   }
 
 non_delimited_predicate:
@@ -261,65 +415,87 @@ non_delimited_predicate:
 exists_pred:
   EXISTS '(' expr ')'
   {
-    $$ = ExistsNode{expr: $3}
+    $$ = ExistsNode{Expr: $3}
+    $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>4)
+  }
+  | EXISTS '(' error ')'
+  {
+    $$ = ExistsNode{Expr: BadNode{}}
   }
 
 comparison_pred:
     expr EQ expr
     {
-      $$ = BinPred{t: eqBinOp, left: $1, right: $3}
+      $$ = BinPred{Op: EqBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | expr NEQ expr
     {
-      $$ = BinPred{t: neqBinOp, left: $1, right: $3}
+      $$ = BinPred{Op: NeqBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | expr '>' expr
     {
-      $$ = BinPred{t: gtBinOp, left: $1, right: $3}
+      $$ = BinPred{Op: GtBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | expr '<' expr
     {
-      $$ = BinPred{t: ltBinOp, left: $1, right: $3}
+      $$ = BinPred{Op: LtBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | expr GTE expr
     {
-      $$ = BinPred{t: gteBinOp, left: $1, right: $3}
+      $$ = BinPred{Op: GteBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | expr LTE expr
     {
-      $$ = BinPred{t: lteBinOp, left: $1, right: $3}
+      $$ = BinPred{Op: LteBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | predicate_primary AND predicate_primary
     {
-      $$ = BinLogic{t: andBinOp, left: $1, right: $3}
+      $$ = BinLogic{Op: AndBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | predicate_primary OR predicate_primary
     {
-      $$ = BinLogic{t: orBinOp, left: $1, right: $3}
+      $$ = BinLogic{Op: OrBinOp, Left: $1, Right: $3}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
     }
     | UNOT predicate_primary %prec UMINUS
     {
-      $$ = UnaryNot{expr: $2}
+      $$ = UnaryNot{Pred: $2}
+      $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>2)
     }
 
 like_regex_pred:
   expr LIKE_REGEX like_regex_pattern FLAG like_regex_flag
   {
-    pattern, err := regexp.Compile($3)
+    pattern, err := compileXQueryRegex($3, $5)
     if err != nil {
-      yylex.(*tokenStream).err = err
-      return 1
+      if yylex.(*tokenStream).reportAt(err.Error(), span{$<pos>3.begin, $<pos>5.end}) {
+        return 1
+      }
+      $$ = BadNode{}
+    } else {
+      $$ = LikeRegexNode{Left: $1, Pattern: $3, Flag: $5, regex: pattern}
     }
-    $$ = LikeRegexNode{left: $1, rawPattern: $3, pattern: pattern, flag: &$5}
+    $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>5)
   }
   | expr LIKE_REGEX like_regex_pattern
   {
-    pattern, err := regexp.Compile($3)
+    pattern, err := compileXQueryRegex($3, "")
     if err != nil {
-      yylex.(*tokenStream).err = err
-      return 1
+      if yylex.(*tokenStream).reportAt(err.Error(), $<pos>3) {
+        return 1
+      }
+      $$ = BadNode{}
+    } else {
+      $$ = LikeRegexNode{Left: $1, Pattern: $3, regex: pattern}
     }
-    $$ = LikeRegexNode{left: $1, pattern: pattern, rawPattern: $3}
+    $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>3)
   }
 
 like_regex_pattern:
@@ -330,13 +506,15 @@ like_regex_flag: STR
 starts_with_pred:
   expr STARTS WITH expr
   {
-    $$ = StartsWithNode{left: $1, right: $4}
+    $$ = StartsWithNode{Left: $1, Right: $4}
+    $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>4)
   }
 
 is_unknown_pred:
   '(' predicate_primary ')' IS UNKNOWN
   {
-    $$ = IsUnknownNode{expr: $2}
+    $$ = IsUnknownNode{Pred: $2}
+    $<pos>$ = yylex.(*tokenStream).built($<pos>1, $<pos>5)
   }
 
 %%
@@ -2,9 +2,10 @@ package jsonpath
 
 import (
 	"fmt"
-	"strconv"
+	"math/big"
 	"strings"
 	"unicode"
+	"unicode/utf16"
 )
 
 // https://talks.golang.org/2011/lex.slide
@@ -13,8 +14,17 @@ type lexer struct {
 	input   []rune
 	start   int
 	pos     int
-	items   chan jsonpathSym
+	state   stateFn
+	pending []lexedSym
 	lastSym jsonpathSym
+	// begin and end are the span of the token most recently returned by
+	// next, as rune offsets into input.
+	begin, end int
+}
+
+type lexedSym struct {
+	sym        jsonpathSym
+	begin, end int
 }
 
 type jsonpathSym interface {
@@ -24,7 +34,7 @@ type jsonpathSym interface {
 
 type singleCh struct{ ch int }
 type ident struct{ val string }
-type number struct{ val float64 }
+type number struct{ val numeric }
 type str struct{ val string }
 
 type lte struct{}
@@ -34,6 +44,7 @@ type neq struct{}
 type and struct{}
 type or struct{}
 type not struct{}
+type starStar struct{}
 
 type keyword struct{ which int }
 
@@ -41,11 +52,13 @@ type errSym struct {
 	msg   string
 	begin int
 	end   int
+	// hint suggests a fix, if one is likely.
+	hint string
 }
 
-func (s singleCh) Lexeme() string { return string(s.ch) }
+func (s singleCh) Lexeme() string { return string(rune(s.ch)) }
 func (s ident) Lexeme() string    { return s.val }
-func (s number) Lexeme() string   { return fmt.Sprintf("%v", s.val) }
+func (s number) Lexeme() string   { return s.val.String() }
 func (s str) Lexeme() string      { return fmt.Sprintf("'%v'", s.val) }
 
 func (s lte) Lexeme() string { return "<=" }
@@ -56,6 +69,8 @@ func (s and) Lexeme() string { return "&&" }
 func (s or) Lexeme() string  { return "||" }
 func (s not) Lexeme() string { return "!" }
 
+func (s starStar) Lexeme() string { return "**" }
+
 func (s keyword) Lexeme() string { return invertedKeywords[s.which] }
 
 func (s errSym) Lexeme() string { return s.msg }
@@ -73,6 +88,8 @@ func (s and) identifier() int { return AND }
 func (s or) identifier() int  { return OR }
 func (s not) identifier() int { return UNOT }
 
+func (s starStar) identifier() int { return ANY }
+
 func (s keyword) identifier() int { return s.which }
 
 func (s errSym) identifier() int { return -1 }
@@ -101,6 +118,13 @@ func (l *lexer) peek() rune {
 	return l.input[l.pos]
 }
 
+func (l *lexer) peekAhead(i int) rune {
+	if l.pos+i >= len(l.input) {
+		return eof
+	}
+	return l.input[l.pos+i]
+}
+
 func (l *lexer) peekBack() rune {
 	if l.pos-1 < 0 {
 		return eof
@@ -124,21 +148,40 @@ func (l *lexer) gobble(i int) {
 	l.start = l.pos
 }
 
-func (l *lexer) run() {
-	for state := startState; state != nil; {
-		state = state(l)
+// next runs the state machine until it emits a token, and returns false once
+// the input is exhausted or an error has been emitted.
+func (l *lexer) next() (jsonpathSym, bool) {
+	for len(l.pending) == 0 {
+		if l.state == nil {
+			l.begin, l.end = len(l.input), len(l.input)
+			return nil, false
+		}
+		l.state = l.state(l)
 	}
-	close(l.items)
+	next := l.pending[0]
+	// Shift rather than reslice, so the buffer is reused for the next token.
+	l.pending = append(l.pending[:0], l.pending[1:]...)
+	l.begin, l.end = next.begin, next.end
+	return next.sym, true
 }
 
 func (l *lexer) emit(sym jsonpathSym) {
+	begin, end := l.start, l.pos
+	if e, ok := sym.(errSym); ok {
+		begin, end = e.begin, e.end
+	}
+	l.pending = append(l.pending, lexedSym{sym, begin, end})
 	l.start = l.pos
 	l.lastSym = sym
-	l.items <- sym
 }
 
 func (l *lexer) err(msg string, args ...interface{}) {
-	l.emit(errSym{fmt.Sprintf(msg, args...), l.start, l.pos})
+	l.emit(errSym{fmt.Sprintf(msg, args...), l.start, l.pos, ""})
+}
+
+// errHint is err with a hint at how to fix the problem.
+func (l *lexer) errHint(hint string, msg string, args ...interface{}) {
+	l.emit(errSym{fmt.Sprintf(msg, args...), l.start, l.pos, hint})
 }
 
 func (l *lexer) current() string {
@@ -168,6 +211,8 @@ var opChars = map[rune]struct{}{
 	']': struct{}{},
 	'(': struct{}{},
 	')': struct{}{},
+	'{': struct{}{},
+	'}': struct{}{},
 }
 
 func startState(l *lexer) stateFn {
@@ -184,7 +229,7 @@ func startState(l *lexer) stateFn {
 			return identifierFollowingDotState
 		}
 		return keywordState
-	case unicode.IsDigit(ch):
+	case isDecimalDigit(ch), ch == '.' && isDecimalDigit(l.peekAhead(1)):
 		return numberState
 	case ch == '\'':
 		parseString(l, '\'')
@@ -197,89 +242,287 @@ func startState(l *lexer) stateFn {
 	if _, ok := opChars[ch]; ok {
 		return opState
 	}
+	if ch == eof {
+		return nil
+	}
 
-	return nil
+	l.advance(1)
+	l.err("unexpected character %q", ch)
+	return startState
 }
 
-func escapable(r rune) bool {
-	switch r {
-	case 'n':
-	default:
-		return false
+var simpleEscapes = map[rune]rune{
+	'b':  '\b',
+	'f':  '\f',
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'v':  '\v',
+	'\\': '\\',
+	'/':  '/',
+	'"':  '"',
+	'\'': '\'',
+}
+
+// hexValue returns the value of a hex digit, or -1.
+func hexValue(r rune) rune {
+	switch {
+	case '0' <= r && r <= '9':
+		return r - '0'
+	case 'a' <= r && r <= 'f':
+		return r - 'a' + 10
+	case 'A' <= r && r <= 'F':
+		return r - 'A' + 10
+	}
+	return -1
+}
+
+// hexDigits consumes up to max hex digits and returns their value and how
+// many there were.
+func (l *lexer) hexDigits(max int) (rune, int) {
+	var r rune
+	n := 0
+	for ; n < max && hexValue(l.peek()) >= 0; n++ {
+		r = r*16 + hexValue(l.peek())
+		l.advance(1)
 	}
-	return true
+	return r, n
 }
 
-func reescape(s string, quoteChar rune) string {
-	// Overestimate.
-	result := make([]rune, 0, len(s))
-	// TODO: this conversion should be unnecessary
-	runes := []rune(s)
+// unicodeEscape decodes the rest of a \u escape: either four hex digits or
+// up to six inside braces.
+func (l *lexer) unicodeEscape() (rune, bool) {
+	if l.peek() == '{' {
+		l.advance(1)
+		r, n := l.hexDigits(6)
+		if n == 0 || l.peek() != '}' || r > unicode.MaxRune {
+			return 0, false
+		}
+		l.advance(1)
+		return r, true
+	}
+	r, n := l.hexDigits(4)
+	return r, n == 4
+}
 
-	for i := 0; i < len(runes); i++ {
-		if runes[i] == '\\' {
-			i++
-			switch runes[i] {
-			case 'n':
-				result = append(result, '\n')
-			case quoteChar:
-				result = append(result, quoteChar)
+// escape decodes the escape sequence following a backslash, which starts at
+// pos, and returns the error message for an invalid one.
+func (l *lexer) escape(pos int) (rune, string) {
+	ch := l.peek()
+	l.advance(1)
+	if r, ok := simpleEscapes[ch]; ok {
+		return r, ""
+	}
+	invalid := func(what string) (rune, string) {
+		return 0, fmt.Sprintf("invalid %s \"%s\"", what, string(l.input[pos:l.pos]))
+	}
+	switch ch {
+	case 'x':
+		r, n := l.hexDigits(2)
+		if n != 2 {
+			return invalid("hexadecimal escape sequence")
+		}
+		return r, ""
+	case 'u':
+		r, ok := l.unicodeEscape()
+		if !ok {
+			return invalid("Unicode escape sequence")
+		}
+		if utf16.IsSurrogate(r) {
+			// A high surrogate must be followed by an escaped low surrogate.
+			if r >= 0xdc00 || l.peek() != '\\' {
+				return invalid("Unicode surrogate pair")
 			}
-		} else {
-			result = append(result, runes[i])
+			l.advance(1)
+			if l.peek() != 'u' {
+				return invalid("Unicode surrogate pair")
+			}
+			l.advance(1)
+			low, ok := l.unicodeEscape()
+			if !ok || !utf16.IsSurrogate(low) || low < 0xdc00 {
+				return invalid("Unicode surrogate pair")
+			}
+			return utf16.DecodeRune(r, low), ""
 		}
+		return r, ""
 	}
-	return string(result)
+	return invalid("escape sequence")
 }
 
+// parseString lexes a quoted string, decoding the escape sequences of JSON
+// and ECMAScript strings as PostgreSQL does.
 func parseString(l *lexer, quoteChar rune) stateFn {
+	subscript := l.lastSym == singleCh{'['}
 	l.advance(1)
-	ch := l.peek()
-	for ch != quoteChar {
-		if ch == eof {
+	var b strings.Builder
+	for {
+		ch := l.peek()
+		switch ch {
+		case eof:
 			l.err("unterminated string")
+			l.emit(str{b.String()})
 			return nil
-		}
-		if ch == '\\' {
+		case quoteChar:
+			l.advance(1)
+			// Other dialects access members as $['name'], which would only
+			// fail once evaluated.
+			if quoteChar == '\'' && subscript && l.peekPastSpace() == ']' {
+				start := l.start
+				hint := fmt.Sprintf("members are written .%s, with a dot and double quotes, rather than [%s]", quoteString(b.String()), l.current())
+				l.errHint(hint, "array index must be a number, but found %s", l.current())
+				l.start = start
+			}
+			l.emit(str{b.String()})
+			return startState
+		case '\\':
+			pos := l.pos
 			l.advance(1)
-			if l.peek() != quoteChar && !escapable(l.peek()) {
-				l.err("invalid escape sequence \"\\%s\"", string(l.peek()))
-				return nil
+			if l.peek() == eof {
+				continue
+			}
+			r, msg := l.escape(pos)
+			if msg != "" {
+				// Carry on to the end of the string, so that lexing can
+				// resume after it.
+				start := l.start
+				l.emit(errSym{msg, pos, l.pos, ""})
+				l.start = start
+				continue
 			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune(ch)
+			l.advance(1)
+		}
+	}
+}
+
+// peekPastSpace returns the next character which isn't whitespace, without
+// consuming anything.
+func (l *lexer) peekPastSpace() rune {
+	i := 0
+	for unicode.IsSpace(l.peekAhead(i)) {
+		i++
+	}
+	return l.peekAhead(i)
+}
+
+func isDecimalDigit(r rune) bool { return '0' <= r && r <= '9' }
+func isOctalDigit(r rune) bool   { return '0' <= r && r <= '7' }
+func isBinaryDigit(r rune) bool  { return r == '0' || r == '1' }
+func isHexDigit(r rune) bool     { return hexValue(r) >= 0 }
+
+var radixPrefixes = map[rune]struct {
+	base    int
+	isDigit func(rune) bool
+}{
+	'x': {16, isHexDigit},
+	'X': {16, isHexDigit},
+	'o': {8, isOctalDigit},
+	'O': {8, isOctalDigit},
+	'b': {2, isBinaryDigit},
+	'B': {2, isBinaryDigit},
+}
+
+// digits consumes a run of digits, which may be separated by single
+// underscores, and returns them without the underscores.
+func (l *lexer) digits(isDigit func(rune) bool) string {
+	var b strings.Builder
+	for {
+		ch := l.peek()
+		if isDigit(ch) {
+			b.WriteRune(ch)
+			l.advance(1)
+		} else if ch == '_' && b.Len() > 0 && isDigit(l.peekAhead(1)) {
+			l.advance(1)
+		} else {
+			return b.String()
 		}
-		l.advance(1)
-		ch = l.peek()
 	}
-	l.scooch(1)
-	l.emit(str{reescape(l.current(), quoteChar)})
-	l.gobble(1)
-	return startState
 }
 
+// numberState lexes the numeric literals of PostgreSQL 16: decimals with
+// optional fraction and exponent, and hex, octal and binary integers, all of
+// which may separate their digits with underscores.
 func numberState(l *lexer) stateFn {
-	for unicode.IsDigit(l.peek()) {
-		l.advance(1)
+	if l.peek() == '0' {
+		if radix, ok := radixPrefixes[l.peekAhead(1)]; ok {
+			l.advance(2)
+			digits := l.digits(radix.isDigit)
+			if digits == "" || validIdentifierChar(l.peek()) {
+				return numberJunk(l)
+			}
+			// Make the number just as its decimal form would be lexed, so
+			// that it's the same after formatting and parsing it again.
+			coef, _ := new(big.Int).SetString(digits, radix.base)
+			n, _ := parseNumeric(coef.String())
+			l.emit(number{n})
+			return startState
+		}
+	}
+
+	text := l.digits(isDecimalDigit)
+	if len(text) > 1 && text[0] == '0' {
+		return numberJunk(l)
 	}
 	if l.peek() == '.' {
 		l.advance(1)
-		for unicode.IsDigit(l.peek()) {
+		frac := l.digits(isDecimalDigit)
+		if text == "" && frac == "" {
+			return numberJunk(l)
+		}
+		text += "." + frac
+		if l.peek() == '.' && isDecimalDigit(l.peekAhead(1)) {
 			l.advance(1)
+			return numberJunk(l)
 		}
 	}
-	if l.peek() == 'e' {
+	if ch := l.peek(); ch == 'e' || ch == 'E' {
 		l.advance(1)
-		for unicode.IsDigit(l.peek()) {
+		text += "e"
+		if ch := l.peek(); ch == '+' || ch == '-' {
+			text += string(ch)
 			l.advance(1)
 		}
+		exp := l.digits(isDecimalDigit)
+		if exp == "" {
+			l.err("invalid numeric literal")
+			return numberPlaceholder(l)
+		}
+		text += exp
+	}
+	if validIdentifierChar(l.peek()) {
+		return numberJunk(l)
 	}
-	parsed, err := strconv.ParseFloat(l.current(), 64)
-	if err != nil {
-		panic("PANIC!!!")
+	parsed, ok := parseNumeric(text)
+	if !ok {
+		l.err("numeric literal out of range")
+		return numberPlaceholder(l)
 	}
 	l.emit(number{parsed})
 	return startState
 }
 
+// numberJunk reports a numeric literal which runs into something that can't
+// follow it, including the offending character in the error's span.
+func numberJunk(l *lexer) stateFn {
+	if l.peek() != eof {
+		l.advance(1)
+	}
+	l.err("trailing junk after numeric literal")
+	for validIdentifierChar(l.peek()) || l.peek() == '.' && isDecimalDigit(l.peekAhead(1)) {
+		l.advance(1)
+	}
+	return numberPlaceholder(l)
+}
+
+// numberPlaceholder stands a zero in for a malformed numeric literal, so
+// that a parse recovering from errors doesn't also trip over its absence.
+func numberPlaceholder(l *lexer) stateFn {
+	l.emit(number{numericFromInt(0)})
+	return startState
+}
+
 func opState(l *lexer) stateFn {
 	ch := l.peek()
 	switch ch {
@@ -298,6 +541,7 @@ func opState(l *lexer) stateFn {
 			l.emit(eq{})
 		} else {
 			l.err("use == instead of =")
+			l.emit(eq{})
 		}
 	case '<':
 		l.advance(1)
@@ -325,7 +569,15 @@ func opState(l *lexer) stateFn {
 			l.emit(and{})
 		} else {
 			l.err("& must be followed by &")
-			return nil
+			l.emit(and{})
+		}
+	case '*':
+		l.advance(1)
+		if l.peek() == '*' {
+			l.advance(1)
+			l.emit(starStar{})
+		} else {
+			l.emit(singleCh{'*'})
 		}
 	case '|':
 		l.advance(1)
@@ -334,7 +586,7 @@ func opState(l *lexer) stateFn {
 			l.emit(or{})
 		} else {
 			l.err("| must be followed by |")
-			return nil
+			l.emit(or{})
 		}
 	default:
 		l.advance(1)
@@ -361,14 +613,25 @@ var keywords = map[string]int{
 }
 
 var funcs = map[string]int{
-	"type":     FUNC_TYPE,
-	"size":     FUNC_SIZE,
-	"double":   FUNC_DOUBLE,
-	"ceiling":  FUNC_CEILING,
-	"floor":    FUNC_FLOOR,
-	"abs":      FUNC_ABS,
-	"datetime": FUNC_DATETIME,
-	"keyvalue": FUNC_KEYVALUE,
+	"type":         FUNC_TYPE,
+	"size":         FUNC_SIZE,
+	"double":       FUNC_DOUBLE,
+	"ceiling":      FUNC_CEILING,
+	"floor":        FUNC_FLOOR,
+	"abs":          FUNC_ABS,
+	"datetime":     FUNC_DATETIME,
+	"keyvalue":     FUNC_KEYVALUE,
+	"bigint":       FUNC_BIGINT,
+	"integer":      FUNC_INTEGER,
+	"number":       FUNC_NUMBER,
+	"decimal":      FUNC_DECIMAL,
+	"string":       FUNC_STRING,
+	"boolean":      FUNC_BOOLEAN,
+	"date":         FUNC_DATE,
+	"time":         FUNC_TIME,
+	"time_tz":      FUNC_TIME_TZ,
+	"timestamp":    FUNC_TIMESTAMP,
+	"timestamp_tz": FUNC_TIMESTAMP_TZ,
 }
 
 var invertedKeywords = map[int]string{}
@@ -389,7 +652,7 @@ func keywordState(l *lexer) stateFn {
 	if sym, ok := keywords[l.current()]; ok {
 		l.emit(keyword{sym})
 	} else {
-		l.err("unrecognized keyword \"%s\"", l.current())
+		l.errHint(keywordHint(l.current()), "unrecognized keyword \"%s\"", l.current())
 	}
 	return startState
 }
@@ -406,45 +669,146 @@ func identifierFollowingDotState(l *lexer) stateFn {
 	for validIdentifierChar(l.peek()) {
 		l.advance(1)
 	}
+	name := l.current()
 	for unicode.IsSpace(l.peek()) {
 		l.advance(1)
 	}
 	if l.peek() != '(' {
-		l.emit(ident{l.current()})
+		l.emit(ident{name})
 	} else {
-		name := strings.TrimRight(l.current(), " ")
 		if n, ok := funcs[name]; ok {
 			l.emit(keyword{n})
 		} else {
-			l.err("invalid function \"%s\"", name)
+			l.errHint(functionHint(name), "invalid function \"%s\"", name)
 		}
 	}
 	return startState
 }
 
-type executionMode int
+// Mode is whether a path is evaluated in lax or strict mode, which decides
+// how structural errors, such as accessing a member of an array, are
+// handled.
+type Mode int
 
 const (
-	modeLax executionMode = iota
-	modeStrict
+	ModeLax Mode = iota
+	ModeStrict
 )
 
 type tokenStream struct {
 	root  Program
-	mode  executionMode
-	items chan jsonpathSym
 	err   error
 	lexer *lexer
+	opts  ParseOptions
+	// mode is the mode of the path being parsed, and implicit is set if it
+	// wasn't written, both of which are known once started is set.
+	mode     Mode
+	implicit bool
+	started  bool
+
+	// recover is set when parsing carries on past errors, collecting them
+	// all in diagnostics, rather than stopping at the first.
+	recover     bool
+	diagnostics []error
+	// afterLexErr is set when the lexer reported an error just before the
+	// most recent token, which explains any parse error at that token.
+	afterLexErr bool
+	// lastTok and prevTok are the two most recent tokens returned.
+	lastTok, prevTok int
+	brackets         []openBracket
+	// spans holds the span of each node built so far, in the order they
+	// were built. The parser builds a node's children before it, left to
+	// right, so this is the order in which Walk leaves the nodes.
+	spans []span
+}
+
+// program sets the result of the parse to root, in the path's mode.
+func (t *tokenStream) program(root Expr) {
+	t.root = Program{Mode: t.mode, Root: root, Implicit: t.implicit}
+	t.spans = append(t.spans, span{0, len(t.lexer.input)})
+}
+
+// built records that a node was built from the tokens from first to last,
+// and returns their span.
+func (t *tokenStream) built(first, last span) span {
+	s := span{first.begin, last.end}
+	t.spans = append(t.spans, s)
+	return s
+}
+
+// openBracket is a '(', '[' or '{' which hasn't been closed yet.
+type openBracket struct {
+	ch         rune
+	begin, end int
+	// exists is set for the '(' of an exists predicate.
+	exists bool
+}
+
+var closingBrackets = map[rune]rune{'(': ')', '[': ']', '{': '}'}
+
+// report records an error, and reports whether parsing should stop.
+func (t *tokenStream) report(err error) bool {
+	if t.err == nil {
+		t.err = err
+	}
+	t.diagnostics = append(t.diagnostics, err)
+	return !t.recover
+}
+
+// span is the position of some tokens within the input, as indexes of its
+// runes.
+type span struct {
+	begin, end int
+}
+
+// reportAt reports a syntax error in the tokens at s, and reports whether
+// parsing should stop.
+func (t *tokenStream) reportAt(msg string, s span) bool {
+	return t.report(t.errorAt(msg, s))
+}
+
+// errorAt returns a syntax error in the tokens at s.
+func (t *tokenStream) errorAt(msg string, s span) *SyntaxError {
+	for s.end > s.begin && unicode.IsSpace(t.lexer.input[s.end-1]) {
+		s.end--
+	}
+	return newSyntaxError(t.lexer.input, msg, s.begin, s.end, nil)
+}
+
+// next returns the next token, reporting and skipping over lexer errors.
+func (t *tokenStream) next() (jsonpathSym, bool) {
+	t.afterLexErr = false
+	for {
+		next, ok := t.lexer.next()
+		if e, isErr := next.(errSym); ok && isErr {
+			t.afterLexErr = true
+			err := newSyntaxError(t.lexer.input, e.msg, e.begin, e.end, nil)
+			err.Hint = e.hint
+			if t.report(err) {
+				return nil, false
+			}
+			continue
+		}
+		return next, ok
+	}
 }
 
 func (t *tokenStream) Lex(lval *yySymType) int {
-	next := <-t.items
-	if next == nil {
+	if t.err != nil && !t.recover {
+		return 0
+	}
+	next, ok := t.next()
+	if !t.started {
+		t.start(next)
+	}
+	if !ok {
 		return 0
 	}
+	t.prevTok, t.lastTok = t.lastTok, next.identifier()
+	lval.pos = span{t.lexer.begin, t.lexer.end}
 	switch n := next.(type) {
 	case singleCh:
-		return n.ch
+		t.track(rune(n.ch))
 	case number:
 		lval.expr = NumberExpr{val: n.val}
 	case ident:
@@ -452,29 +816,86 @@ func (t *tokenStream) Lex(lval *yySymType) int {
 	case str:
 		lval.str = n.val
 	}
-	return next.identifier()
+	return t.lastTok
+}
+
+// start works out the mode of the path from its first token, which is nil
+// for empty input.
+func (t *tokenStream) start(first jsonpathSym) {
+	t.started = true
+	t.mode, t.implicit = t.opts.Mode, true
+	if first == nil {
+		return
+	}
+	var written Mode
+	switch first.identifier() {
+	case LAX:
+		written = ModeLax
+	case STRICT:
+		written = ModeStrict
+	default:
+		return
+	}
+	t.implicit = false
+	if !t.opts.ForceMode {
+		t.mode = written
+	}
+}
+
+// track keeps the stack of open brackets up to date, so that running out of
+// input can be blamed on the bracket left open.
+func (t *tokenStream) track(ch rune) {
+	if _, ok := closingBrackets[ch]; ok {
+		t.brackets = append(t.brackets, openBracket{ch, t.lexer.begin, t.lexer.end, ch == '(' && t.prevTok == EXISTS})
+		return
+	}
+	if n := len(t.brackets); n > 0 && closingBrackets[t.brackets[n-1].ch] == ch {
+		t.brackets = t.brackets[:n-1]
+	}
 }
 
 func (t *tokenStream) Error(e string) {
-	t.err = fmt.Errorf(e)
+	// A lexer error is more specific than the parser's complaint about the
+	// token which follows it.
+	if t.afterLexErr {
+		return
+	}
+	msg, expected := parseParserError(e)
+	atEnd := t.lexer.begin == len(t.lexer.input)
+	if n := len(t.brackets); n > 0 && atEnd {
+		open := t.brackets[n-1]
+		at := newSyntaxError(t.lexer.input, "", open.begin, open.end, nil)
+		if open.exists {
+			msg = fmt.Sprintf("missing ')' to close \"exists (\" at line %d, column %d", at.Line, at.Column)
+		} else {
+			msg = fmt.Sprintf("missing '%c' to close the '%c' at line %d, column %d", closingBrackets[open.ch], open.ch, at.Line, at.Column)
+		}
+	}
+	err := newSyntaxError(t.lexer.input, msg, t.lexer.begin, t.lexer.end, expected)
+	if !atEnd {
+		err.Hint = dialectHints[[2]int{t.prevTok, t.lastTok}]
+	}
+	t.report(err)
+}
+
+// dialectHints explain what to write instead of the syntax of other JSONPath
+// dialects, keyed by the token before a syntax error and the token at it.
+var dialectHints = map[[2]int]string{
+	{'.', '.'}: "recursive descent is written .** rather than .., as in $.**.name",
+	{'[', '?'}: "filters follow the path rather than going in brackets, as in $.items ? (@.price > 10)",
 }
 
 func tokens(input string) *tokenStream {
-	lexer, items := lex(input)
 	return &tokenStream{
-		lexer: lexer,
-		items: items,
+		lexer: lex(input),
 	}
 }
 
-func lex(input string) (*lexer, chan jsonpathSym) {
-	c := make(chan jsonpathSym)
-	l := lexer{
+func lex(input string) *lexer {
+	return &lexer{
 		input: []rune(input),
 		start: 0,
 		pos:   0,
-		items: c,
+		state: startState,
 	}
-	go l.run()
-	return &l, c
 }
@@ -27,6 +27,7 @@ func TestLex(t *testing.T) {
 		{"$foo", []string{"$foo"}, []int{IDENT}},
 		{"$foo.bar", []string{"$foo", ".", "bar"}, []int{IDENT, '.', IDENT}},
 		{"$foo   .   bar", []string{"$foo", ".", "bar"}, []int{IDENT, '.', IDENT}},
+		{"$.bar > 1", []string{"$", ".", "bar", ">", "1"}, []int{IDENT, '.', IDENT, '>', NUMBER}},
 		{"$.foo.bar", []string{"$", ".", "foo", ".", "bar"}, []int{IDENT, '.', IDENT, '.', IDENT}},
 		{"[$foo]", []string{"[", "$foo", "]"}, []int{'[', IDENT, ']'}},
 		{"[()]", []string{"[", "(", ")", "]"}, []int{'[', '(', ')', ']'}},
@@ -34,6 +35,18 @@ func TestLex(t *testing.T) {
 		{"1.1", []string{"1.1"}, []int{NUMBER}},
 		{"123.123", []string{"123.123"}, []int{NUMBER}},
 		{"12.3e0", []string{"12.3"}, []int{NUMBER}},
+		{"1e-5", []string{"0.00001"}, []int{NUMBER}},
+		{"1E+5", []string{"100000"}, []int{NUMBER}},
+		{".5", []string{"0.5"}, []int{NUMBER}},
+		{"5.", []string{"5"}, []int{NUMBER}},
+		{"0x1F", []string{"31"}, []int{NUMBER}},
+		{"0XdeAD_beef", []string{"3735928559"}, []int{NUMBER}},
+		{"0o17", []string{"15"}, []int{NUMBER}},
+		{"0b101", []string{"5"}, []int{NUMBER}},
+		{"1_000_000", []string{"1000000"}, []int{NUMBER}},
+		{"1_0.0_1e1_0", []string{"100100000000"}, []int{NUMBER}},
+		{"1.2.type()", []string{"1.2", ".", "type", "(", ")"}, []int{NUMBER, '.', FUNC_TYPE, '(', ')'}},
+		{"$[.5]", []string{"$", "[", "0.5", "]"}, []int{IDENT, '[', NUMBER, ']'}},
 		{"true false null", []string{"true", "false", "null"}, []int{TRUE, FALSE, NULL}},
 		{"1 == 2", []string{"1", "==", "2"}, []int{NUMBER, EQ, NUMBER}},
 		{"1 < 2", []string{"1", "<", "2"}, []int{NUMBER, '<', NUMBER}},
@@ -51,8 +64,12 @@ func TestLex(t *testing.T) {
 		{"\"hello world\"", []string{"'hello world'"}, []int{STR}},
 		{"'hi \\'foo\\''", []string{"'hi 'foo''"}, []int{STR}},
 		{"'hi\\nthere'", []string{"'hi\nthere'"}, []int{STR}},
+		{`"\b\f\r\t\v\\\/\"\'"`, []string{"'\b\f\r\t\v\\/\"''"}, []int{STR}},
+		{`"\x41\u0042\u{43}\u{1F600}\uD83D\uDE00"`, []string{"'ABC😀😀'"}, []int{STR}},
+		{`"é"`, []string{"'é'"}, []int{STR}},
 		{"strict lax", []string{"strict", "lax"}, []int{STRICT, LAX}},
 		{"to", []string{"to"}, []int{TO}},
+		{"$.**{1 to last}", []string{"$", ".", "**", "{", "1", "to", "last", "}"}, []int{IDENT, '.', ANY, '{', NUMBER, TO, LAST, '}'}},
 		{"[1, 2]", []string{"[", "1", ",", "2", "]"}, []int{'[', NUMBER, ',', NUMBER, ']'}},
 
 		{"$.type()", []string{"$", ".", "type", "(", ")"}, []int{IDENT, '.', FUNC_TYPE, '(', ')'}},
@@ -61,11 +78,11 @@ func TestLex(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.input, func(t *testing.T) {
-			_, c := lex(tc.input)
+			l := lex(tc.input)
 			result := make([]string, 0)
 			resultIdents := make([]int, 0)
 
-			for elem := range c {
+			for elem, ok := l.next(); ok; elem, ok = l.next() {
 				result = append(result, elem.Lexeme())
 				resultIdents = append(resultIdents, elem.identifier())
 			}
@@ -92,15 +109,34 @@ func TestLexErrors(t *testing.T) {
 		{"1 | 1", "| must be followed by |", 2, 2},
 		{"foo", "unrecognized keyword \"foo\"", 0, 2},
 		{"\"hello", "unterminated string", 0, 5},
-		{"\"\\y\"", "invalid escape sequence \"\\y\"", 2, 2},
+		{"\"\\y\"", "invalid escape sequence \"\\y\"", 1, 3},
+		{`"\x4"`, `invalid hexadecimal escape sequence "\x4"`, 1, 3},
+		{`"\u12"`, `invalid Unicode escape sequence "\u12"`, 1, 4},
+		{`"\u{}"`, `invalid Unicode escape sequence "\u{"`, 1, 3},
+		{`"\u{110000}"`, `invalid Unicode escape sequence "\u{110000"`, 1, 9},
+		{`"\uD800"`, `invalid Unicode surrogate pair "\uD800"`, 1, 6},
+		{`"\uDE00\uD83D"`, `invalid Unicode surrogate pair "\uDE00"`, 1, 6},
+		{`"\uD83D\u0041"`, `invalid Unicode surrogate pair "\uD83D\u0041"`, 1, 12},
+		{`"\`, "unterminated string", 1, 2},
 		{"$.bar()", "invalid function \"bar\"", 2, 4},
+		{"1.2.3", "trailing junk after numeric literal", 0, 4},
+		{"1e", "invalid numeric literal", 0, 2},
+		{"1e+", "invalid numeric literal", 0, 3},
+		{"12abc", "trailing junk after numeric literal", 0, 3},
+		{"1.a", "trailing junk after numeric literal", 0, 3},
+		{"01", "trailing junk after numeric literal", 0, 2},
+		{"0x", "trailing junk after numeric literal", 0, 2},
+		{"0b102", "trailing junk after numeric literal", 0, 5},
+		{"1__0", "trailing junk after numeric literal", 0, 2},
+		{"1_", "trailing junk after numeric literal", 0, 2},
+		{"1e1001", "numeric literal out of range", 0, 6},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.input, func(t *testing.T) {
-			_, c := lex(tc.input)
+			l := lex(tc.input)
 
-			for elem := range c {
+			for elem, ok := l.next(); ok; elem, ok = l.next() {
 				if err, ok := elem.(errSym); ok {
 					if err.msg != tc.expectedError {
 						t.Fatalf("expected \"%s\", got \"%s\"", tc.expectedError, err.msg)
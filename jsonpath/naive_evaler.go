@@ -4,174 +4,160 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
-	"strconv"
 	"strings"
+	"time"
 )
 
 // This implementation of eval uses Go's builtin encoding/decoding of json.
 type NaiveEvaler struct {
-	program jsonPathExpr
+	program Program
+	// optimized is program as Optimize leaves it, with the invariant
+	// expressions of its filters marked, which is what's evaluated.
+	optimized Program
+	// invariants is the number of invariant expressions in optimized.
+	invariants int
+	// vars holds the names of the variables program references, each of
+	// which must be bound when it's run.
+	vars []string
 }
 
 type naiveEvalContext struct {
 	dollar                 jsonValue
-	containingArrayLengths []float64
+	vars                   map[string]interface{}
+	timeZone               *time.Location
+	containingArrayLengths []int
 	atSigns                []jsonValue
-	mode                   executionMode
+	mode                   Mode
+	// ignoreStructuralErrors is set while evaluating the accessors that
+	// follow a `.**`, which would otherwise fail in strict mode on the
+	// scalars it produces.
+	ignoreStructuralErrors bool
+	// invariants holds the value of each invariant expression, once it's
+	// been evaluated.
+	invariants []invariantResult
+}
+
+// raiseStructuralErrors reports whether accessing a missing member or
+// indexing a non-array should be an error rather than produce nothing.
+func (ctx *naiveEvalContext) raiseStructuralErrors() bool {
+	return ctx.mode == ModeStrict && !ctx.ignoreStructuralErrors
 }
 
 type jsonValue interface{}
 type jsonSequence []jsonValue
 
 func (n NaiveEvaler) Run(dollar jsonValue) (jsonSequence, error) {
-	return n.program.naiveEval(&naiveEvalContext{
-		dollar:                 dollar,
-		containingArrayLengths: make([]float64, 0, 10),
-		mode: modeLax,
-	})
+	return n.RunWithVars(dollar, nil)
 }
 
-func NewNaiveEvaler(program string) (*NaiveEvaler, error) {
-	p, err := Parse(program)
-	if err != nil {
-		return nil, err
-	}
-	return &NaiveEvaler{
-		program: p,
-	}, nil
+// RunWithVars evaluates the program against dollar, binding each named
+// variable `$name` in the program to vars["name"].
+func (n NaiveEvaler) RunWithVars(dollar jsonValue, vars map[string]interface{}) (jsonSequence, error) {
+	return n.RunWithOptions(dollar, RunOptions{Vars: vars})
 }
 
-func (p Program) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
-	ctx.mode = p.mode
-	return p.root.naiveEval(ctx)
+// RunOptions configures a single evaluation of a program.
+type RunOptions struct {
+	// Vars binds each named variable `$name` in the program to Vars["name"].
+	Vars map[string]interface{}
+	// TimeZone is the IANA name of the time zone used to convert between
+	// datetime values with and without a time zone, as PostgreSQL's `_tz`
+	// functions do. If it is empty, such conversions are errors.
+	TimeZone string
 }
 
-type cmpResult int
-
-const (
-	ltResult cmpResult = 1 << iota
-	eqResult
-	gtResult
-	unknownResult
-)
-
-func compare(x interface{}, y interface{}) cmpResult {
-	if _, ok := x.(map[string]interface{}); ok {
-		return unknownResult
-	}
-	if _, ok := y.(map[string]interface{}); ok {
-		return unknownResult
-	}
-	if _, ok := x.([]interface{}); ok {
-		return unknownResult
-	}
-	if _, ok := y.([]interface{}); ok {
-		return unknownResult
+// RunWithOptions evaluates the program against dollar using opts.
+func (n NaiveEvaler) RunWithOptions(dollar jsonValue, opts RunOptions) (jsonSequence, error) {
+	// A filter would make a missing variable unknown, rather than fail.
+	for _, name := range n.vars {
+		if _, ok := opts.Vars[name]; !ok {
+			return nil, fmt.Errorf("could not find jsonpath variable %q", name)
+		}
 	}
-	if x == nil || y == nil {
-		return eqResult
+	ctx := &naiveEvalContext{
+		dollar:                 dollar,
+		vars:                   opts.Vars,
+		containingArrayLengths: make([]int, 0, 10),
+		mode:                   ModeLax,
+		invariants:             make([]invariantResult, n.invariants),
 	}
-	switch xx := x.(type) {
-	case string:
-		yy, ok := y.(string)
-		if !ok {
-			return unknownResult
-		}
-		cmp := strings.Compare(xx, yy)
-		switch cmp {
-		case -1:
-			return ltResult
-		case 0:
-			return eqResult
-		case 1:
-			return gtResult
-		}
-	case float64:
-		yy, ok := y.(float64)
-		if !ok {
-			return unknownResult
-		}
-		switch {
-		case xx < yy:
-			return ltResult
-		case xx == yy:
-			return eqResult
-		case xx > yy:
-			return gtResult
-		}
-	case bool:
-		yy, ok := y.(bool)
-		if !ok {
-			return unknownResult
-		}
-		if xx == yy {
-			return eqResult
-		}
-		if xx == false {
-			return ltResult
+	if opts.TimeZone != "" {
+		loc, err := loadLocation(opts.TimeZone)
+		if err != nil {
+			return nil, err
 		}
-		return gtResult
+		ctx.timeZone = loc
 	}
-	return -1
+	return n.optimized.naiveEval(ctx)
 }
 
-func performCmp(leftVal, rightVal jsonSequence, acceptedResult cmpResult) sqlJsonBool {
-	seenTrue := false
-	for _, l := range leftVal {
-		for _, r := range rightVal {
-			result := compare(l, r)
+// Variables returns the sorted names, without the leading `$`, of the named
+// variables referenced by the program.
+func (n NaiveEvaler) Variables() []string {
+	return Variables(n.program)
+}
 
-			if result == unknownResult {
-				return sqlJsonUnknown
-			}
-			if (result & acceptedResult) != 0 {
-				seenTrue = true
-			}
-		}
+func NewNaiveEvaler(program string) (*NaiveEvaler, error) {
+	p, err := Parse(program)
+	if err != nil {
+		return nil, err
 	}
-	if seenTrue {
-		return sqlJsonTrue
+	return NewNaiveEvalerForProgram(p), nil
+}
+
+// NewNaiveEvalerForProgram evaluates a program which has already been parsed,
+// or built from the AST's constructors.
+func NewNaiveEvalerForProgram(p Program) *NaiveEvaler {
+	n := &NaiveEvaler{
+		program: p,
+		vars:    Variables(p),
 	}
-	return sqlJsonFalse
+	n.optimized, n.invariants = hoistInvariants(Optimize(p))
+	return n
+}
+
+func (p Program) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
+	ctx.mode = p.Mode
+	return p.Root.naiveEval(ctx)
 }
 
 func (n BinPred) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
-	leftVal, err := n.left.naiveEval(ctx)
+	leftVal, err := n.Left.naiveEval(ctx)
 	if err != nil {
 		return sqlJsonUnknown, nil
 	}
-	rightVal, err := n.right.naiveEval(ctx)
+	rightVal, err := n.Right.naiveEval(ctx)
 	if err != nil {
 		return sqlJsonUnknown, nil
 	}
-	switch n.t {
-	case eqBinOp:
-		return performCmp(leftVal, rightVal, eqResult), nil
-	case ltBinOp:
-		return performCmp(leftVal, rightVal, ltResult), nil
-	case lteBinOp:
-		return performCmp(leftVal, rightVal, eqResult|ltResult), nil
-	case gtBinOp:
-		return performCmp(leftVal, rightVal, gtResult), nil
-	case gteBinOp:
-		return performCmp(leftVal, rightVal, eqResult|gtResult), nil
-	case neqBinOp:
-		return performCmp(leftVal, rightVal, ltResult|gtResult), nil
+	switch n.Op {
+	case EqBinOp:
+		return performCmp(ctx, leftVal, rightVal, eqResult)
+	case LtBinOp:
+		return performCmp(ctx, leftVal, rightVal, ltResult)
+	case LteBinOp:
+		return performCmp(ctx, leftVal, rightVal, eqResult|ltResult)
+	case GtBinOp:
+		return performCmp(ctx, leftVal, rightVal, gtResult)
+	case GteBinOp:
+		return performCmp(ctx, leftVal, rightVal, eqResult|gtResult)
+	case NeqBinOp:
+		return performCmp(ctx, leftVal, rightVal, ltResult|gtResult|unorderedResult)
 	}
 	return 0, fmt.Errorf("unknown op")
 }
 
 func (n BinLogic) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
-	left, err := n.left.naivePredEval(ctx)
+	left, err := n.Left.naivePredEval(ctx)
 	if err != nil {
 		return 0, err
 	}
-	right, err := n.right.naivePredEval(ctx)
+	right, err := n.Right.naivePredEval(ctx)
 	if err != nil {
 		return 0, err
 	}
-	switch n.t {
-	case orBinOp:
+	switch n.Op {
+	case OrBinOp:
 		if left == sqlJsonFalse {
 			return right, nil
 		}
@@ -182,7 +168,7 @@ func (n BinLogic) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
 			return sqlJsonTrue, nil
 		}
 		return sqlJsonUnknown, nil
-	case andBinOp:
+	case AndBinOp:
 		if left == sqlJsonTrue {
 			return right, nil
 		}
@@ -198,7 +184,7 @@ func (n BinLogic) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
 }
 
 func (n BinExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
-	leftVal, err := n.left.naiveEval(ctx)
+	leftVal, err := n.Left.naiveEval(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -206,7 +192,7 @@ func (n BinExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
 		return nil, fmt.Errorf("binary operators can only operate on single values")
 	}
 	left := leftVal[0]
-	rightVal, err := n.right.naiveEval(ctx)
+	rightVal, err := n.Right.naiveEval(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -214,19 +200,27 @@ func (n BinExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
 		return nil, fmt.Errorf("binary operators can only operate on single values")
 	}
 	right := rightVal[0]
-	if l, ok := left.(float64); ok {
-		if r, ok := right.(float64); ok {
-			switch n.t {
-			case plusBinOp:
-				return jsonSequence{l + r}, nil
-			case minusBinOp:
-				return jsonSequence{l - r}, nil
-			case timesBinOp:
-				return jsonSequence{l * r}, nil
-			case divBinOp:
-				return jsonSequence{l / r}, nil
-			case modBinOp:
-				return jsonSequence{float64(int(l) % int(r))}, nil
+	if l, ok := asNumeric(left); ok {
+		if r, ok := asNumeric(right); ok {
+			switch n.Op {
+			case PlusBinOp:
+				return jsonSequence{l.add(r)}, nil
+			case MinusBinOp:
+				return jsonSequence{l.sub(r)}, nil
+			case TimesBinOp:
+				return jsonSequence{l.mul(r)}, nil
+			case DivBinOp:
+				q, err := l.div(r)
+				if err != nil {
+					return nil, err
+				}
+				return jsonSequence{q}, nil
+			case ModBinOp:
+				m, err := l.mod(r)
+				if err != nil {
+					return nil, err
+				}
+				return jsonSequence{m}, nil
 			}
 		}
 	}
@@ -238,17 +232,17 @@ func (n NumberExpr) naiveEval(_ *naiveEvalContext) (jsonSequence, error) {
 }
 
 func (n UnaryExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
-	expr, err := n.expr.naiveEval(ctx)
+	expr, err := n.Expr.naiveEval(ctx)
 	if err != nil {
 		return nil, err
 	}
-	switch n.t {
-	case uminus:
+	switch n.Op {
+	case UMinus:
 		result := make(jsonSequence, 0, len(expr))
 		for _, e := range expr {
 			if err := iter(ctx, e, func(e interface{}) error {
-				if num, ok := e.(float64); ok {
-					result = append(result, -num)
+				if num, ok := asNumeric(e); ok {
+					result = append(result, num.neg())
 				} else {
 					return fmt.Errorf("unary minus can only accept numbers")
 				}
@@ -258,11 +252,11 @@ func (n UnaryExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
 			}
 		}
 		return result, nil
-	case uplus:
+	case UPlus:
 		result := make(jsonSequence, 0, len(expr))
 		for _, e := range expr {
 			if err := iter(ctx, e, func(e interface{}) error {
-				if num, ok := e.(float64); ok {
+				if num, ok := asNumeric(e); ok {
 					result = append(result, num)
 				} else {
 					return fmt.Errorf("unary plus can only accept numbers")
@@ -278,7 +272,7 @@ func (n UnaryExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
 }
 
 func (n UnaryNot) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
-	expr, err := n.expr.naivePredEval(ctx)
+	expr, err := n.Pred.naivePredEval(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -292,29 +286,32 @@ func (n UnaryNot) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
 }
 
 func (n ParenPred) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
-	return n.expr.naivePredEval(ctx)
+	return n.Pred.naivePredEval(ctx)
 }
 
 func (n ParenExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
-	return n.expr.naiveEval(ctx)
+	return n.Expr.naiveEval(ctx)
 }
 
 func (n VariableExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
-	switch n.name {
+	switch n.Name {
 	case "$":
 		return jsonSequence{ctx.dollar}, nil
 	case "@":
 		return jsonSequence{ctx.atSigns[len(ctx.atSigns)-1]}, nil
 	}
-	return nil, fmt.Errorf(":(")
+	if v, ok := ctx.vars[n.Name[1:]]; ok {
+		return jsonSequence{v}, nil
+	}
+	return nil, fmt.Errorf("could not find jsonpath variable %q", n.Name[1:])
 }
 
 func (n LastExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
-	return jsonSequence{ctx.containingArrayLengths[len(ctx.containingArrayLengths)-1]}, nil
+	return jsonSequence{numericFromInt(int64(ctx.containingArrayLengths[len(ctx.containingArrayLengths)-1]))}, nil
 }
 
 func (n BoolExpr) naiveEval(_ *naiveEvalContext) (jsonSequence, error) {
-	return jsonSequence{n.val}, nil
+	return jsonSequence{n.Value}, nil
 }
 
 func (n NullExpr) naiveEval(_ *naiveEvalContext) (jsonSequence, error) {
@@ -322,15 +319,35 @@ func (n NullExpr) naiveEval(_ *naiveEvalContext) (jsonSequence, error) {
 }
 
 func (n StringExpr) naiveEval(_ *naiveEvalContext) (jsonSequence, error) {
-	return jsonSequence{n.val}, nil
+	return jsonSequence{n.Value}, nil
 }
 
 func (n AccessExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
-	left, err := n.left.naiveEval(ctx)
+	left, err := n.Left.naiveEval(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return n.right.naiveAccess(ctx, left)
+	if !ctx.ignoreStructuralErrors && followsRecursiveWildcard(n.Left) {
+		ctx.ignoreStructuralErrors = true
+		defer func() { ctx.ignoreStructuralErrors = false }()
+	}
+	return n.Right.naiveAccess(ctx, left)
+}
+
+func followsRecursiveWildcard(e Expr) bool {
+	for {
+		if inv, ok := e.(invariantExpr); ok {
+			e = inv.expr
+		}
+		access, ok := unparen(e).(AccessExpr)
+		if !ok {
+			return false
+		}
+		if _, ok := access.Right.(RecursiveWildcardAccessor); ok {
+			return true
+		}
+		e = access.Left
+	}
 }
 
 func (n DotAccessor) naiveAccess(ctx *naiveEvalContext, node jsonSequence) (jsonSequence, error) {
@@ -338,21 +355,21 @@ func (n DotAccessor) naiveAccess(ctx *naiveEvalContext, node jsonSequence) (json
 	for _, e := range node {
 		if err := iter(ctx, e, func(elem interface{}) error {
 			if obj, ok := elem.(map[string]interface{}); ok {
-				if v, ok := obj[n.val]; ok {
+				if v, ok := obj[n.Name]; ok {
 					result = append(result, v)
-				} else if ctx.mode == modeStrict {
+				} else if ctx.raiseStructuralErrors() {
 					s, err := json.Marshal(obj)
 					if err != nil {
 						return err
 					}
-					return fmt.Errorf("object %s missing `%s` field", s, n.val)
+					return fmt.Errorf("object %s missing `%s` field", s, n.Name)
 				}
-			} else {
+			} else if ctx.raiseStructuralErrors() {
 				s, err := json.Marshal(elem)
 				if err != nil {
 					return err
 				}
-				return fmt.Errorf("cannot access field `%s` on non-object %s", n.val, s)
+				return fmt.Errorf("cannot access field `%s` on non-object %s", n.Name, s)
 			}
 			return nil
 		}); err != nil {
@@ -371,7 +388,7 @@ func (n MemberWildcardAccessor) naiveAccess(ctx *naiveEvalContext, s jsonSequenc
 				for _, v := range obj {
 					result = append(result, v)
 				}
-			} else if ctx.mode == modeStrict {
+			} else if ctx.raiseStructuralErrors() {
 				s, err := json.Marshal(e)
 				if err != nil {
 					return err
@@ -393,8 +410,10 @@ func (n ArrayAccessor) naiveAccess(ctx *naiveEvalContext, val jsonSequence) (jso
 	ctx.containingArrayLengths = append(ctx.containingArrayLengths, 0)
 	for _, e := range val {
 		if _, ok := e.([]interface{}); !ok {
-			if ctx.mode == modeLax {
+			if ctx.mode == ModeLax {
 				e = []interface{}{e}
+			} else if ctx.ignoreStructuralErrors {
+				continue
 			} else {
 				s, err := json.Marshal(e)
 				if err != nil {
@@ -404,9 +423,9 @@ func (n ArrayAccessor) naiveAccess(ctx *naiveEvalContext, val jsonSequence) (jso
 			}
 		}
 		if ary, ok := e.([]interface{}); ok {
-			ctx.containingArrayLengths[len(ctx.containingArrayLengths)-1] = float64(len(ary) - 1)
-			for _, s := range n.subscripts {
-				start, err := s.start.naiveEval(ctx)
+			ctx.containingArrayLengths[len(ctx.containingArrayLengths)-1] = len(ary) - 1
+			for _, s := range n.Subscripts {
+				start, err := s.Start.naiveEval(ctx)
 				if err != nil {
 					return nil, err
 				}
@@ -415,17 +434,17 @@ func (n ArrayAccessor) naiveAccess(ctx *naiveEvalContext, val jsonSequence) (jso
 					return nil, fmt.Errorf("indexes must return single value")
 				}
 				i := start[0]
-				if idx, ok := i.(float64); ok {
-					if s.end == nil {
-						if int(idx) < 0 || int(idx) >= len(ary) {
-							if ctx.mode == modeStrict {
-								return nil, fmt.Errorf("array index %d out of bounds", int(idx))
+				if idx, ok := arrayIndex(i); ok {
+					if s.End == nil {
+						if idx < 0 || idx >= len(ary) {
+							if ctx.raiseStructuralErrors() {
+								return nil, fmt.Errorf("array index %d out of bounds", idx)
 							}
 						} else {
-							result = append(result, ary[int(idx)])
+							result = append(result, ary[idx])
 						}
 					} else {
-						end, err := s.end.naiveEval(ctx)
+						end, err := s.End.naiveEval(ctx)
 						if err != nil {
 							return nil, err
 						}
@@ -433,23 +452,29 @@ func (n ArrayAccessor) naiveAccess(ctx *naiveEvalContext, val jsonSequence) (jso
 							return nil, fmt.Errorf("indexes must return single value")
 						}
 						j := end[0]
-						if idxEnd, ok := j.(float64); ok {
-							if idxEnd < idx && ctx.mode == modeStrict {
+						if idxEnd, ok := arrayIndex(j); ok {
+							if idxEnd < idx && ctx.mode == ModeStrict {
 								return nil, fmt.Errorf("the end of a range can't come before the beginning")
 							}
+							if idx <= idxEnd && (idx < 0 || idxEnd >= len(ary)) && ctx.raiseStructuralErrors() {
+								return nil, fmt.Errorf("array index out of bounds")
+							}
+							if idx < 0 {
+								idx = 0
+							}
+							if idxEnd >= len(ary) {
+								idxEnd = len(ary) - 1
+							}
 							for i := idx; i <= idxEnd; i++ {
-								if int(i) < 0 || int(i) >= len(ary) {
-									if ctx.mode == modeStrict {
-										return nil, fmt.Errorf("array index out of bounds")
-									}
-								} else {
-									result = append(result, ary[int(i)])
-								}
+								result = append(result, ary[i])
 							}
 						} else {
 							return nil, fmt.Errorf("array index must be a number, but found %#v", j)
 						}
 					}
+				} else if str, ok := s.Start.(StringExpr); ok && s.End == nil {
+					// Other dialects access members this way.
+					return nil, fmt.Errorf("array index must be a number, but found %#v; to access a member, write .%s", i, quoteString(str.Value))
 				} else {
 					//TODO improve error message
 					return nil, fmt.Errorf("array index must be a number, but found %#v", i)
@@ -477,8 +502,73 @@ func (n WildcardArrayAccessor) naiveAccess(ctx *naiveEvalContext, val jsonSequen
 	return result, nil
 }
 
+func (n RecursiveWildcardAccessor) naiveAccess(ctx *naiveEvalContext, val jsonSequence) (jsonSequence, error) {
+	bound := func(level int) int {
+		if level == LastLevel {
+			return math.MaxInt32
+		}
+		return level
+	}
+	first, last := bound(n.First), bound(n.Last)
+	// `.**{last}` selects only the leaves of the document.
+	leavesOnly := n.First == LastLevel && n.Last == LastLevel
+
+	result := make(jsonSequence, 0, len(val))
+	var descend func(e interface{}, level int)
+	visit := func(child interface{}, level int) {
+		_, isObj := child.(map[string]interface{})
+		_, isAry := child.([]interface{})
+		if level >= first || (leavesOnly && !isObj && !isAry) {
+			result = append(result, child)
+		}
+		if level < last && (isObj || isAry) {
+			descend(child, level+1)
+		}
+	}
+	descend = func(e interface{}, level int) {
+		switch t := e.(type) {
+		case map[string]interface{}:
+			for _, child := range t {
+				visit(child, level)
+			}
+		case []interface{}:
+			for _, child := range t {
+				visit(child, level)
+			}
+		}
+	}
+
+	for _, e := range val {
+		if first == 0 {
+			result = append(result, e)
+		}
+		if last > 0 {
+			descend(e, 1)
+		}
+	}
+	return result, nil
+}
+
+// mapItems applies f to each item of val, unwrapping arrays in lax mode.
+func mapItems(ctx *naiveEvalContext, val jsonSequence, f func(interface{}) (interface{}, error)) (jsonSequence, error) {
+	result := make(jsonSequence, 0, len(val))
+	for _, e := range val {
+		if err := iter(ctx, e, func(e interface{}) error {
+			r, err := f(e)
+			if err != nil {
+				return err
+			}
+			result = append(result, r)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
 func iter(ctx *naiveEvalContext, e interface{}, f func(interface{}) error) error {
-	if ary, ok := e.([]interface{}); ok && ctx.mode == modeLax {
+	if ary, ok := e.([]interface{}); ok && ctx.mode == ModeLax {
 		for _, elem := range ary {
 			if err := f(elem); err != nil {
 				return err
@@ -493,71 +583,82 @@ func iter(ctx *naiveEvalContext, e interface{}, f func(interface{}) error) error
 }
 
 func (n FuncNode) naiveAccess(ctx *naiveEvalContext, val jsonSequence) (jsonSequence, error) {
-	switch n.f {
-	case typeFunction:
+	switch n.Func {
+	case TypeFunction:
 		result := make(jsonSequence, len(val))
 		for i, e := range val {
-			switch e.(type) {
-			case nil:
-				result[i] = "null"
-			case bool:
-				result[i] = "boolean"
-			case float64:
-				result[i] = "number"
-			case string:
-				result[i] = "string"
-			case []interface{}:
-				result[i] = "array"
-			case map[string]interface{}:
-				result[i] = "object"
-			default:
-				return nil, fmt.Errorf("unknown elem type %T", e)
+			k, err := kindOf(e)
+			if err != nil {
+				return nil, err
 			}
-		}
-		return result, nil
-	case sizeFunction:
-		result := make(jsonSequence, len(val))
-		for i, e := range val {
-			if ary, ok := e.([]interface{}); ok {
-				result[i] = len(ary)
+			if d, ok := e.(datetime); ok {
+				result[i] = d.typeName()
 			} else {
-				result[i] = 1
+				result[i] = valueKindNames[k]
 			}
 		}
 		return result, nil
-	case doubleFunction:
+	case SizeFunction:
 		result := make(jsonSequence, len(val))
 		for i, e := range val {
-			switch t := e.(type) {
-			case float64:
-				result[i] = t
-			case string:
-				n, err := strconv.Atoi(t)
-				if err != nil {
-					return nil, err
-				}
-				result[i] = n
-			default:
-				return nil, fmt.Errorf(".double() only defined on strings and numbers")
+			if ary, ok := e.([]interface{}); ok {
+				result[i] = numericFromInt(int64(len(ary)))
+			} else {
+				result[i] = numericFromInt(1)
 			}
 		}
 		return result, nil
-	case ceilingFunction:
+	case DoubleFunction:
+		return mapItems(ctx, val, toDouble)
+	case BigintFunction:
+		return mapItems(ctx, val, func(e interface{}) (interface{}, error) {
+			return toInteger("bigint", 64, e)
+		})
+	case IntegerFunction:
+		return mapItems(ctx, val, func(e interface{}) (interface{}, error) {
+			return toInteger("integer", 32, e)
+		})
+	case NumberFunction:
+		return mapItems(ctx, val, toNumber)
+	case DateFunction, TimeFunction, TimeTZFunction, TimestampFunction, TimestampTZFunction:
+		precision := -1
+		if len(n.Args) > 0 {
+			precision = intArg(n, 0)
+		}
+		return mapItems(ctx, val, func(e interface{}) (interface{}, error) {
+			return convertDatetime(functionNames[n.Func], datetimeMethodKinds[n.Func], precision, ctx.timeZone, e)
+		})
+	case StringFunction:
+		return mapItems(ctx, val, toString)
+	case BooleanFunction:
+		return mapItems(ctx, val, toBoolean)
+	case DecimalFunction:
+		precision, scale := 0, 0
+		if len(n.Args) > 0 {
+			precision = intArg(n, 0)
+		}
+		if len(n.Args) > 1 {
+			scale = intArg(n, 1)
+		}
+		return mapItems(ctx, val, func(e interface{}) (interface{}, error) {
+			return toDecimal(precision, scale, len(n.Args) > 0, e)
+		})
+	case CeilingFunction:
 		result := make(jsonSequence, len(val))
 		for i, e := range val {
-			if num, ok := e.(float64); ok {
-				result[i] = math.Ceil(num)
+			if num, ok := asNumeric(e); ok {
+				result[i] = num.ceil()
 			} else {
 				return nil, fmt.Errorf(".ceiling() only defined on numbers")
 			}
 		}
 		return result, nil
-	case floorFunction:
+	case FloorFunction:
 		result := make(jsonSequence, 0, len(val))
 		for _, e := range val {
 			if err := iter(ctx, e, func(e interface{}) error {
-				if num, ok := e.(float64); ok {
-					result = append(result, math.Floor(num))
+				if num, ok := asNumeric(e); ok {
+					result = append(result, num.floor())
 				} else {
 					return fmt.Errorf(".floor() only defined on numbers")
 				}
@@ -567,17 +668,51 @@ func (n FuncNode) naiveAccess(ctx *naiveEvalContext, val jsonSequence) (jsonSequ
 			}
 		}
 		return result, nil
-	case absFunction:
+	case AbsFunction:
 		result := make(jsonSequence, len(val))
 		for i, e := range val {
-			if num, ok := e.(float64); ok {
-				result[i] = math.Abs(num)
+			if num, ok := asNumeric(e); ok {
+				result[i] = num.abs()
 			} else {
 				return nil, fmt.Errorf(".abs() only defined on numbers")
 			}
 		}
 		return result, nil
-	case keyvalueFunction:
+	case DatetimeFunction:
+		tmpl := n.template
+		if tmpl == nil && len(n.Args) > 0 {
+			// The node was built as a literal rather than by NewFuncNode.
+			t, err := compileDatetimeTemplate(n.Args[0].(StringExpr).Value)
+			if err != nil {
+				return nil, err
+			}
+			tmpl = t
+		}
+		result := make(jsonSequence, 0, len(val))
+		for _, e := range val {
+			if err := iter(ctx, e, func(e interface{}) error {
+				s, ok := e.(string)
+				if !ok {
+					return fmt.Errorf(".datetime() only defined on strings")
+				}
+				var d datetime
+				var err error
+				if tmpl == nil {
+					d, err = parseDatetime(s)
+				} else {
+					d, err = tmpl.parse(s)
+				}
+				if err != nil {
+					return err
+				}
+				result = append(result, d)
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case KeyvalueFunction:
 		result := make(jsonSequence, 0)
 		i := 0
 		for _, e := range val {
@@ -587,7 +722,7 @@ func (n FuncNode) naiveAccess(ctx *naiveEvalContext, val jsonSequence) (jsonSequ
 						result = append(result, map[string]interface{}{
 							"name":  k,
 							"value": v,
-							"id":    i,
+							"id":    numericFromInt(int64(i)),
 						})
 					}
 				} else {
@@ -608,7 +743,7 @@ func (n FilterNode) naiveAccess(ctx *naiveEvalContext, val jsonSequence) (jsonSe
 	result := make(jsonSequence, 0, len(val))
 	for _, e := range val {
 		ctx.atSigns = append(ctx.atSigns, e)
-		pass, err := n.pred.naivePredEval(ctx)
+		pass, err := n.Pred.naivePredEval(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -621,7 +756,7 @@ func (n FilterNode) naiveAccess(ctx *naiveEvalContext, val jsonSequence) (jsonSe
 }
 
 func (n ExistsNode) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
-	e, err := n.expr.naiveEval(ctx)
+	e, err := n.Expr.naiveEval(ctx)
 	if err != nil {
 		return sqlJsonUnknown, nil
 	}
@@ -632,13 +767,21 @@ func (n ExistsNode) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
 }
 
 func (n LikeRegexNode) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
-	exprs, err := n.left.naiveEval(ctx)
+	re := n.regex
+	if re == nil {
+		// The node was built as a literal rather than by NewLikeRegexNode.
+		var err error
+		if re, err = compileXQueryRegex(n.Pattern, n.Flag); err != nil {
+			return 0, err
+		}
+	}
+	exprs, err := n.Left.naiveEval(ctx)
 	if err != nil {
 		return 0, err
 	}
 	for _, e := range exprs {
 		if s, ok := e.(string); ok {
-			if n.pattern.Match([]byte(s)) {
+			if re.Match([]byte(s)) {
 				return sqlJsonTrue, nil
 			}
 		}
@@ -647,11 +790,11 @@ func (n LikeRegexNode) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error)
 }
 
 func (n StartsWithNode) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
-	left, err := n.left.naiveEval(ctx)
+	left, err := n.Left.naiveEval(ctx)
 	if err != nil {
 		return 0, err
 	}
-	right, err := n.right.naiveEval(ctx)
+	right, err := n.Right.naiveEval(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -674,7 +817,7 @@ func (n StartsWithNode) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error
 }
 
 func (n IsUnknownNode) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error) {
-	e, err := n.expr.naivePredEval(ctx)
+	e, err := n.Pred.naivePredEval(ctx)
 	if err != nil {
 		return 0, err
 	}
@@ -683,3 +826,41 @@ func (n IsUnknownNode) naivePredEval(ctx *naiveEvalContext) (sqlJsonBool, error)
 	}
 	return sqlJsonFalse, nil
 }
+
+var errBadNode = fmt.Errorf("cannot evaluate a jsonpath containing syntax errors")
+
+func (n BadNode) naiveEval(*naiveEvalContext) (jsonSequence, error) {
+	return nil, errBadNode
+}
+
+func (n BadNode) naivePredEval(*naiveEvalContext) (sqlJsonBool, error) {
+	return sqlJsonUnknown, errBadNode
+}
+
+func (n BadNode) naiveAccess(*naiveEvalContext, jsonSequence) (jsonSequence, error) {
+	return nil, errBadNode
+}
+
+// intArg returns the i'th argument of n, which the grammar and validation
+// have already checked is a small integer.
+func intArg(n FuncNode, i int) int {
+	v, _ := n.Args[i].(NumberExpr).val.int64()
+	return int(v)
+}
+
+// arrayIndex truncates a numeric subscript to an int, clamping values too
+// large to ever be in bounds.
+func arrayIndex(v interface{}) (int, bool) {
+	n, ok := asNumeric(v)
+	if !ok {
+		return 0, false
+	}
+	t := n.trunc()
+	if i, ok := t.int64(); ok && i >= math.MinInt32 && i <= math.MaxInt32 {
+		return int(i), true
+	}
+	if t.sign() < 0 {
+		return math.MinInt32, true
+	}
+	return math.MaxInt32, true
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -16,14 +17,26 @@ func TestNaiveEval(t *testing.T) {
 		{"lax 1 + 1", "{}", []string{"2"}},
 		{"lax 1 - 1", "{}", []string{"0"}},
 		{"lax 2 * 3", "{}", []string{"6"}},
-		{"lax 6 / 2", "{}", []string{"3"}},
+		{"lax 6 / 2", "{}", []string{"3.0000000000000000"}},
+		{"lax 1 / 3", "{}", []string{"0.33333333333333333333"}},
 		{"lax 6 % 4", "{}", []string{"2"}},
+		{"lax -7 % 3", "{}", []string{"-1"}},
+		{"lax 7.5 % 2", "{}", []string{"1.5"}},
+		{"lax 0.1 + 0.2", "{}", []string{"0.3"}},
+		{"lax 1.10 * 3", "{}", []string{"3.30"}},
+		{"lax $ ? (0.1 + 0.2 == 0.3)", "1", []string{"1"}},
+		{"lax $ + 1", "9007199254740992", []string{"9007199254740993"}},
+		{"lax 1e3", "{}", []string{"1000"}},
+		{"lax 1e-3 + .5", "{}", []string{"0.501"}},
+		{"lax 0x1F + 0o17 + 0b101 + 1_000_000", "{}", []string{"1000051"}},
+		{"lax $.size() + 1", "[1, 2]", []string{"3"}},
 		{"lax 2 * 3 + 3", "{}", []string{"9"}},
 
 		{"lax $.foo", `{"foo": 1}`, []string{"1"}},
 		{"lax $.foo", `{}`, []string{}},
 		{"lax $.foo", `[{"foo": 1}, {"foo": 2}]`, []string{"1", "2"}},
 		{"lax $.foo", `[{"foo": 1}, {"bar": 2}]`, []string{"1"}},
+		{"$.foo", `[{"foo": 1}, {"foo": 2}]`, []string{"1", "2"}},
 		{"lax $.foo.bar", `{"foo": {"bar": 2}}`, []string{"2"}},
 		{"strict $.phones[*] ? (exists (@.type)).type",
 			`{ "phones": [
@@ -50,6 +63,20 @@ func TestNaiveEval(t *testing.T) {
 		{"lax $[*]", `[1, 2, [1, 2, 3]]`, []string{"1", "2", "[1,2,3]"}},
 		{"lax $[*][*]", `[1, 2, [1, 2, 3]]`, []string{"1", "1", "2", "2", "3"}},
 
+		{"lax $.**", `{"a": {"b": 1}, "c": [2]}`, []string{`{"a":{"b":1},"c":[2]}`, `{"b":1}`, "1", "[2]", "2"}},
+		{"lax $.**{0}", `{"a": {"b": 1}, "c": [2]}`, []string{`{"a":{"b":1},"c":[2]}`}},
+		{"lax $.**{1}", `{"a": {"b": 1}, "c": [2]}`, []string{`{"b":1}`, "[2]"}},
+		{"lax $.**{2}", `{"a": {"b": 1}, "c": [2]}`, []string{"1", "2"}},
+		{"lax $.**{1 to last}", `{"a": {"b": 1}, "c": [2]}`, []string{`{"b":1}`, "1", "[2]", "2"}},
+		{"lax $.**{last}", `{"a": {"b": 1}, "c": [[2]]}`, []string{"1", "2"}},
+		{"lax $.**{5}", `{"a": {"b": 1}}`, []string{}},
+		{"lax $.**", `1`, []string{"1"}},
+		{"lax $.**.b", `{"a": {"b": 1}, "c": [{"b": 2}]}`, []string{"1", "2", "2"}},
+		{"strict $.**.b", `{"a": {"b": 1}, "c": [{"b": 2}]}`, []string{"1", "2"}},
+		{"strict $.**[0]", `{"a": [1, [2]]}`, []string{"1", "2"}},
+		{"strict $.** ? (@.b == 1)", `{"a": {"b": 1}, "c": 3}`, []string{`{"b":1}`}},
+		{"lax $.foo", `"wahoo"`, []string{}},
+
 		// 6.10.5
 		{"lax $.*[1 to last]", `{"x":[12,30],"y":[8],"z":["a","b","c"]}`, []string{"30", "\"b\"", "\"c\""}},
 
@@ -73,14 +100,68 @@ func TestNaiveEval(t *testing.T) {
 		// the spec seems unclear on if .double() should error on non string-or-number values
 		{"lax $.double()", "3", []string{"3"}},
 		{"lax $.double()", "\"3\"", []string{"3"}},
+		{"lax $.double()", "\"3.5\"", []string{"3.5"}},
+		{"lax $.double()", "\" -1.5e3 \"", []string{"-1500"}},
+		{"lax $.double()", "[\"1\", 2]", []string{"1", "2"}},
+		{"lax $.bigint()", "\"12\"", []string{"12"}},
+		{"lax $.bigint()", "12.5", []string{"13"}},
+		{"lax $.bigint()", "-12.5", []string{"-13"}},
+		{"lax $.bigint()", "[1.4, \"2\"]", []string{"1", "2"}},
+		{"lax $.integer()", "2147483647", []string{"2147483647"}},
+		{"lax $.integer()", "\"-2147483648\"", []string{"-2147483648"}},
+		{"lax $.number()", "\"1.25\"", []string{"1.25"}},
+		{"lax $.number()", "1.25", []string{"1.25"}},
+		{"lax $.decimal()", "\"1.25\"", []string{"1.25"}},
+		{"lax $.decimal(4, 1)", "\"1.25\"", []string{"1.3"}},
+		{"lax $.decimal(4, 1)", "-1.25", []string{"-1.3"}},
+		{"lax $.decimal(3)", "123.4", []string{"123"}},
+		{"lax $.decimal(4, -2)", "1234", []string{"1200"}},
+		{"lax $.string()", `"foo"`, []string{`"foo"`}},
+		{"lax $.string()", `1.5`, []string{`"1.5"`}},
+		{"lax $.string()", `1e21`, []string{`"1000000000000000000000"`}},
+		{"lax $.string()", `true`, []string{`"true"`}},
+		{"lax $.string()", `[1, false]`, []string{`"1"`, `"false"`}},
+		{"lax $.datetime().string()", `"2017-03-10 12:34:56.5"`, []string{`"2017-03-10T12:34:56.5"`}},
+		{"lax $.string().type()", `2`, []string{`"string"`}},
+		{"lax $.boolean()", `true`, []string{"true"}},
+		{"lax $.boolean()", `0`, []string{"false"}},
+		{"lax $.boolean()", `-7`, []string{"true"}},
+		{"lax $[*].boolean()", `["t", "yes", "on", "1", " TRUE ", "tr", "y"]`, []string{"true", "true", "true", "true", "true", "true", "true"}},
+		{"lax $[*].boolean()", `["f", "no", "off", "0", "False", "of", "n"]`, []string{"false", "false", "false", "false", "false", "false", "false"}},
+		{"lax $.boolean()", `[1, "f"]`, []string{"true", "false"}},
 
 		{"lax $.ceiling()", "3.3", []string{"4"}},
 		{"lax $.floor()", "3.3", []string{"3"}},
 		{"lax $.abs()", "-3.3", []string{"3.3"}},
 
-		// .... fair
 		// 6.11.4
-		// {"$.datetime()", "-3.3", []string{"3.3"}},
+		{"lax $.datetime()", `"2017-03-10"`, []string{`"2017-03-10"`}},
+		{"lax $.datetime()", `"12:34:56"`, []string{`"12:34:56"`}},
+		{"lax $.datetime()", `"12:34:56.789+05:30"`, []string{`"12:34:56.789+05:30"`}},
+		{"lax $.datetime()", `"2017-03-10 12:34:56"`, []string{`"2017-03-10T12:34:56"`}},
+		{"lax $.datetime()", `"2017-03-10T12:34:56-08"`, []string{`"2017-03-10T12:34:56-08:00"`}},
+		{"lax $.datetime()", `["2017-03-10", "12:34:56"]`, []string{`"2017-03-10"`, `"12:34:56"`}},
+		{"lax $.datetime().type()", `"2017-03-10"`, []string{`"date"`}},
+		{"lax $.datetime().type()", `"12:34:56+01"`, []string{`"time with time zone"`}},
+		{"lax $.datetime().type()", `"2017-03-10 12:34:56"`, []string{`"timestamp without time zone"`}},
+		{"lax $.datetime(\"DD/MM/YYYY HH24:MI\")", `"10/03/2017 12:34"`, []string{`"2017-03-10T12:34:00"`}},
+		{"lax $.datetime(\"HH12:MI am\")", `"03:04 PM"`, []string{`"15:04:00"`}},
+		{"lax $.datetime(\"YYYY-MM-DD\\\"T\\\"HH24:MI:SS.FF3TZH:TZM\")", `"2017-03-10T12:34:56.5-03:30"`, []string{`"2017-03-10T12:34:56.5-03:30"`}},
+		{"lax $[*] ? (@.datetime() > \"2017-03-10\".datetime())", `["2017-03-09", "2017-03-11"]`, []string{`"2017-03-11"`}},
+		{"lax $[*] ? (@.datetime() < \"2017-03-10 12:00:00\".datetime())", `["2017-03-09", "2017-03-11"]`, []string{`"2017-03-09"`}},
+		{"lax $[*] ? (@.datetime() == \"12:00:00+01\".datetime())", `["11:00:00+00", "12:00:00+01"]`, []string{`"12:00:00+01"`}},
+		{"lax $[*] ? (@.datetime() < \"12:00:00+01\".datetime())", `["11:00:00+00", "10:00:00+00"]`, []string{`"10:00:00+00"`}},
+		{"lax $[*] ? ((@.datetime() == \"12:00:00\".datetime()) is unknown)", `["2017-03-10"]`, []string{`"2017-03-10"`}},
+		{"lax $.date()", `"2017-03-10 12:34:56"`, []string{`"2017-03-10"`}},
+		{"lax $.time()", `"2017-03-10 12:34:56.789"`, []string{`"12:34:56.789"`}},
+		{"lax $.time(1)", `"12:34:56.789"`, []string{`"12:34:56.8"`}},
+		{"lax $.time(0)", `"12:34:56.5"`, []string{`"12:34:57"`}},
+		{"lax $.time_tz()", `"2017-03-10 12:34:56+05:30"`, []string{`"12:34:56+05:30"`}},
+		{"lax $.timestamp()", `"2017-03-10"`, []string{`"2017-03-10T00:00:00"`}},
+		{"lax $.timestamp(2)", `"2017-03-10 12:34:56.789"`, []string{`"2017-03-10T12:34:56.79"`}},
+		{"lax $.timestamp_tz()", `"2017-03-10 12:34:56-03"`, []string{`"2017-03-10T12:34:56-03:00"`}},
+		{"lax $.datetime().date()", `"2017-03-10"`, []string{`"2017-03-10"`}},
+		{"lax $[*].time()", `["12:00:00", "13:00:00"]`, []string{`"12:00:00"`, `"13:00:00"`}},
 
 		// 6.11.5
 		{"lax $.keyvalue()", `{"foo":1, "bar":2}`, []string{`{"id":0,"name":"bar","value":2}`, `{"id":0,"name":"foo","value":1}`}},
@@ -112,11 +193,36 @@ func TestNaiveEval(t *testing.T) {
 		{"lax 1 ? (true <= false)", `{}`, []string{}},
 		{"lax 1 ? (false <= true)", `{}`, []string{`1`}},
 		{"lax 1 ? (false != true)", `{}`, []string{`1`}},
-		{"lax 1 ? ($[0] == $[1])", `[[1, 2], [2, 3]]`, []string{}},
+		{"lax 1 ? ($[0] == $[1])", `[[1, 2], [2, 3]]`, []string{`1`}},
+		{"strict 1 ? ($[0] == $[1])", `[[1, 2], [2, 3]]`, []string{}},
+		{`lax $."a\\b"`, `{"a\\b": 1, "ab": 2}`, []string{`1`}},
+		{`lax $."tab\there"`, `{"tab\there": 1}`, []string{`1`}},
+		{`lax $[*] ? (@ == "\u00e9\x41")`, `["éA", "e"]`, []string{`"éA"`}},
+		{"lax $[*] ? (@ == null)", `[null, 1, "a", false]`, []string{`null`}},
+		{"lax $[*] ? (@ != null)", `[null, 1, "a", false]`, []string{`1`, `"a"`, `false`}},
+		{"lax $[*] ? (@ < null || @ >= null)", `[null, 1, "a"]`, []string{`null`}},
+		{"lax 1 ? ((null == 1) is unknown)", `{}`, []string{}},
+		{"lax 1 ? ((\"a\" == 1) is unknown)", `{}`, []string{`1`}},
+		{"lax $ ? (@ + \"a\" > 1)", `1`, []string{}},
+		{"lax $ ? ((\"a\".ceiling() == 1) is unknown)", `1`, []string{`1`}},
+		{"lax $ ? (exists (\"a\".ceiling()))", `1`, []string{}},
+		{"lax $ ? (@.a == 1)", `{"a": [1]}`, []string{`{"a":[1]}`}},
+		{"strict $ ? (@.a == 1)", `{"a": [1]}`, []string{}},
+		{"lax $ ? (@.a[*] == 1)", `{"a": ["x", 1]}`, []string{`{"a":["x",1]}`}},
+		{"strict $ ? (@.a[*] == 1)", `{"a": ["x", 1]}`, []string{}},
+		{"strict $ ? ((@.a[*] == 1) is unknown)", `{"a": ["x", 1]}`, []string{`{"a":["x",1]}`}},
+		{"lax $ ? ((@.a[*] == 1) is unknown)", `{"a": ["x", 2]}`, []string{`{"a":["x",2]}`}},
+		{"lax 1 ? ($[0] == $[1])", `[[1, 2], [3, 4]]`, []string{}},
 		{"lax $[*] ? (@[*] == 2)", `[[1, 2, 3]]`, []string{`[1,2,3]`}},
+		{"lax $[*] ? (@ > $[0] + 1)", `[1, 2, 3]`, []string{`3`}},
+		{"lax $[*] ? (@[last] == $[0][last])", `[[1, 2], [3, 2], [2]]`, []string{`[1,2]`, `[3,2]`, `[2]`}},
+		{"strict $[*] ? (@ == $.**.b)", `[{"b": 1}, 1, 2]`, []string{`1`}},
 
 		// 6.13.6
 		{"lax $[*] ? (@ like_regex 'foo')", `["foo", "bar", "afoob"]`, []string{"\"foo\"", "\"afoob\""}},
+		{"lax $[*] ? (@ like_regex '^fo+$' flag 'i')", `["foo", "FOO", "afoob"]`, []string{"\"foo\"", "\"FOO\""}},
+		{"lax $[*] ? (@ like_regex '^[a-z-[aeiou]]+$')", `["xyz", "abc"]`, []string{"\"xyz\""}},
+		{"lax $[*] ? (@ like_regex 'a.c' flag 'q')", `["abc", "a.c"]`, []string{"\"a.c\""}},
 
 		// 6.13.7
 		{"lax $[*] ? (@ starts with 'foo')", `["foo", "bar", "afoob"]`, []string{"\"foo\""}},
@@ -180,8 +286,8 @@ func TestNaiveEvalErrors(t *testing.T) {
 		expectedError string
 	}{
 		// TODO: include the object in the error
-		{"strict $['hello']", `[1, 2, 3]`, "array index must be a number, but found \"hello\""},
-		{"lax $['hello']", `[1, 2, 3]`, "array index must be a number, but found \"hello\""},
+		{"strict $[\"hello\"]", `[1, 2, 3]`, "array index must be a number, but found \"hello\"; to access a member, write .\"hello\""},
+		{"lax $[\"hello\"]", `[1, 2, 3]`, "array index must be a number, but found \"hello\"; to access a member, write .\"hello\""},
 		{"lax $[1 to 'z']", `[1, 2, 3]`, "array index must be a number, but found \"z\""},
 		{"lax $['a' to 1]", `[1, 2, 3]`, "array index must be a number, but found \"a\""},
 		{"strict $[0 to 100]", `[1, 2, 3]`, "array index out of bounds"},
@@ -200,6 +306,55 @@ func TestNaiveEvalErrors(t *testing.T) {
 		// {"$[1 to 0]", `[1, 2, 3]`, "the end of a range can't come before the beginning"},
 		{"lax -$[*]", `[1, "foo"]`, "unary minus can only accept numbers"},
 		{"lax +$[*]", `[1, "foo"]`, "unary plus can only accept numbers"},
+
+		{"lax $.datetime()", `"foo"`, `datetime format is not recognized: "foo"`},
+		{"lax $.datetime()", `1`, ".datetime() only defined on strings"},
+		{"lax $.datetime(\"YYYY-MM-DD\")", `"2017/03/10"`, `unmatched datetime template text "-" in "2017/03/10"`},
+		{"lax $.datetime(\"YYYY-MM-DD\")", `"2017-02-30"`, `date/time field value out of range: "2017-02-30"`},
+		{"lax $.datetime(\"YYYY-MM-DD\")", `"٢٠١٧-03-10"`, `invalid value "٢٠١٧-03-10" for "YYYY"`},
+		{"lax $.datetime(\"YYYY-MM-DD\")", `"2017-02-03 04:05"`, `trailing characters remain in input string "2017-02-03 04:05" after datetime template "YYYY-MM-DD"`},
+
+		{"lax $.date()", `"12:00:00"`, "cannot convert value from time to date"},
+		{"lax $.time()", `"2017-03-10"`, "cannot convert value from date to time"},
+		{"lax $.date()", `1`, ".date() only defined on strings and datetimes"},
+		{"lax $.timestamp_tz()", `"2017-03-10 12:00:00"`, "cannot convert value from timestamp to timestamptz without time zone usage"},
+		{"lax $.timestamp()", `"2017-03-10 12:00:00+01"`, "cannot convert value from timestamptz to timestamp without time zone usage"},
+		{"lax $.time_tz()", `"12:00:00"`, "cannot convert value from time to timetz without time zone usage"},
+		{"lax $.date()", `"2017-03-10T12:34:56+05"`, "cannot convert value from timestamptz to date without time zone usage"},
+		{"lax $ ? (@.datetime() < \"2017-03-10 12:00:00+01\".datetime())", `"2017-03-10"`, "cannot convert value from date to timestamptz without time zone usage"},
+
+		{"lax 1 / 0", `{}`, "division by zero"},
+		{"lax $ / 0.0", `1.5`, "division by zero"},
+		{"lax 5 % 0", `{}`, "division by zero"},
+
+		{"lax $foo", `{}`, `could not find jsonpath variable "foo"`},
+
+		{"lax $.double()", `"foo"`, `argument "foo" of .double() is not a valid number`},
+		{"lax $.double()", `"0x1p3"`, `argument "0x1p3" of .double() is not a valid number`},
+		{"lax $.double()", `"NaN"`, "NaN or Infinity is not allowed for .double()"},
+		{"lax $.double()", `"-inf"`, "NaN or Infinity is not allowed for .double()"},
+		{"lax $.double()", `"1e400"`, `argument "1e400" of .double() is out of range`},
+		{"lax $.double()", `true`, ".double() only defined on strings and numbers"},
+		{"strict $.double()", `[1]`, ".double() only defined on strings and numbers"},
+		{"lax $.bigint()", `"1.5"`, `argument "1.5" of .bigint() is invalid for type bigint`},
+		{"lax $.bigint()", `"9223372036854775808"`, `argument "9223372036854775808" of .bigint() is invalid for type bigint`},
+		{"lax $.bigint()", `1e19`, `argument "10000000000000000000" of .bigint() is invalid for type bigint`},
+		{"lax $.bigint()", `"Infinity"`, `argument "Infinity" of .bigint() is invalid for type bigint`},
+		{"lax $.integer()", `2147483648`, `argument "2147483648" of .integer() is invalid for type integer`},
+		{"lax $.integer()", `"abc"`, `argument "abc" of .integer() is invalid for type integer`},
+		{"lax $.integer()", `null`, ".integer() only defined on strings and numbers"},
+		{"lax $.number()", `"nan"`, "NaN or Infinity is not allowed for .number()"},
+		{"lax $.number()", `"1.2.3"`, `argument "1.2.3" of .number() is not a valid number`},
+		{"lax $.decimal(3, 1)", `123.4`, `argument "123.4" of .decimal() is invalid for type numeric(3,1)`},
+		{"lax $.decimal()", `{}`, ".decimal() only defined on strings and numbers"},
+		{"lax $.string()", `null`, ".string() only defined on booleans, strings, numbers and datetimes"},
+		{"lax $.string()", `{}`, ".string() only defined on booleans, strings, numbers and datetimes"},
+		{"strict $.string()", `[1]`, ".string() only defined on booleans, strings, numbers and datetimes"},
+		{"lax $.boolean()", `"o"`, `argument "o" of .boolean() is invalid for type boolean`},
+		{"lax $.boolean()", `"maybe"`, `argument "maybe" of .boolean() is invalid for type boolean`},
+		{"lax $.boolean()", `1.5`, `argument "1.5" of .boolean() is invalid for type boolean`},
+		{"lax $.boolean()", `null`, ".boolean() only defined on booleans, strings and numbers"},
+		{"strict $.boolean()", `[true]`, ".boolean() only defined on booleans, strings and numbers"},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.input+"/"+tc.expectedError, func(t *testing.T) {
@@ -224,3 +379,222 @@ func TestNaiveEvalErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestNaiveEvalUseNumber(t *testing.T) {
+	testCases := []struct {
+		input    string
+		context  string
+		expected []string
+	}{
+		{"lax $.id", `{"id": 9007199254740993}`, []string{"9007199254740993"}},
+		{"lax $.id + 1", `{"id": 9007199254740993}`, []string{"9007199254740994"}},
+		{"lax $[*] ? (@ == 9007199254740993)", `[9007199254740992, 9007199254740993]`, []string{"9007199254740993"}},
+		{"lax $[*] ? (@ > 0.1)", `[0.1, 0.10000000000000001]`, []string{"0.10000000000000001"}},
+		{"lax $.a + $.b", `{"a": 0.1, "b": 0.2}`, []string{"0.3"}},
+		{"lax $.a / $.b", `{"a": 1.0, "b": 8}`, []string{"0.12500000000000000000"}},
+		{"lax $.a[$.i]", `{"a": [1, 2, 3], "i": 1.9}`, []string{"2"}},
+		{"lax $.type()", `1.5`, []string{`"number"`}},
+		{"lax $.floor()", `-1.5`, []string{"-2"}},
+		{"lax $.number()", `123456789012345678901234567890`, []string{"123456789012345678901234567890"}},
+		{"lax $.decimal(4, 2)", `"12.345"`, []string{"12.35"}},
+		{"lax $.double()", `9007199254740993`, []string{"9007199254740992"}},
+		{"lax $.bigint()", `"9223372036854775807"`, []string{"9223372036854775807"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			evaler, err := NewNaiveEvaler(tc.input)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			var dollar interface{}
+			d := json.NewDecoder(strings.NewReader(tc.context))
+			d.UseNumber()
+			if err := d.Decode(&dollar); err != nil {
+				t.Fatalf("couldn't decode %s: %s", tc.context, err)
+			}
+
+			result, err := evaler.Run(dollar)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			stringResult := make([]string, len(result))
+			for i, v := range result {
+				s, err := json.Marshal(v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stringResult[i] = string(s)
+			}
+
+			if !reflect.DeepEqual(tc.expected, stringResult) {
+				t.Fatalf("expected %#v, got %#v", tc.expected, stringResult)
+			}
+		})
+	}
+}
+
+func TestNaiveEvalVars(t *testing.T) {
+	testCases := []struct {
+		input    string
+		context  string
+		vars     string
+		expected []string
+		errMsg   string
+	}{
+		{"lax $foo", `{}`, `{"foo": 1}`, []string{"1"}, ""},
+		{"lax $foo + $bar", `{}`, `{"foo": 1, "bar": 2}`, []string{"3"}, ""},
+		{"lax $foo.a", `{}`, `{"foo": {"a": "b"}}`, []string{`"b"`}, ""},
+		{"lax $foo[*]", `{}`, `{"foo": [1, 2]}`, []string{"1", "2"}, ""},
+		{"lax $.items[*] ? (@.price > $min).name", `{"items": [{"name": "a", "price": 5}, {"name": "b", "price": 15}]}`, `{"min": 10}`, []string{`"b"`}, ""},
+		{"lax $[*] ? (@ == $s)", `["x", "' || true"]`, `{"s": "' || true"}`, []string{`"' || true"`}, ""},
+		{"lax $[*] ? (@.a[*] ? (@ == $x + 1) == $x + 1)", `[{"a": [1, 2]}, {"a": [3]}]`, `{"x": 1}`, []string{`{"a":[1,2]}`}, ""},
+		{"lax $[*] ? (@ > $min)", `[1, 2]`, `{}`, nil, `could not find jsonpath variable "min"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			evaler, err := NewNaiveEvaler(tc.input)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			var dollar interface{}
+			if err := json.Unmarshal([]byte(tc.context), &dollar); err != nil {
+				t.Fatalf("couldn't decode %s: %s", tc.context, err)
+			}
+			var vars map[string]interface{}
+			if err := json.Unmarshal([]byte(tc.vars), &vars); err != nil {
+				t.Fatalf("couldn't decode %s: %s", tc.vars, err)
+			}
+
+			result, err := evaler.RunWithVars(dollar, vars)
+			if tc.errMsg != "" {
+				if err == nil || err.Error() != tc.errMsg {
+					t.Fatalf("expected error %q, got %v", tc.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			stringResult := make([]string, len(result))
+			for i, v := range result {
+				s, err := json.Marshal(v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stringResult[i] = string(s)
+			}
+			sort.Strings(tc.expected)
+			sort.Strings(stringResult)
+
+			if !reflect.DeepEqual(tc.expected, stringResult) {
+				t.Fatalf("expected %#v, got %#v", tc.expected, stringResult)
+			}
+		})
+	}
+}
+
+func TestNaiveEvalInvariantsPerRun(t *testing.T) {
+	// `$x + 1` is evaluated once for each run, not once for the evaler.
+	evaler, err := NewNaiveEvaler("lax $[*] ? (@ == $x + 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []int{1, 2} {
+		res, err := evaler.RunWithVars([]interface{}{2, 3}, map[string]interface{}{"x": x})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res, jsonSequence{x + 1}) {
+			t.Fatalf("expected [%d] for $x = %d, got %v", x+1, x, res)
+		}
+	}
+}
+
+func TestNaiveEvalTimeZone(t *testing.T) {
+	testCases := []struct {
+		input    string
+		context  string
+		expected []string
+	}{
+		{"lax $.timestamp_tz()", `"2017-03-10 12:00:00"`, []string{`"2017-03-10T12:00:00+05:30"`}},
+		{"lax $.timestamp()", `"2017-03-10 12:00:00+00"`, []string{`"2017-03-10T17:30:00"`}},
+		{"lax $.time_tz()", `"12:00:00"`, []string{`"12:00:00+05:30"`}},
+		{"lax $.time()", `"12:00:00+00"`, []string{`"17:30:00"`}},
+		{"lax $.date()", `"2017-03-10 20:00:00+00"`, []string{`"2017-03-11"`}},
+		{"lax $.timestamp_tz()", `"2017-03-10"`, []string{`"2017-03-10T00:00:00+05:30"`}},
+		{"lax $[*] ? (@.datetime() == \"2017-03-10 06:30:00+00\".datetime())", `["2017-03-10 12:00:00", "2017-03-10 06:30:00"]`, []string{`"2017-03-10 12:00:00"`}},
+		{"lax $[*] ? (@.datetime() < \"2017-03-10T00:00:00+00\".datetime())", `["2017-03-10", "2017-03-11"]`, []string{`"2017-03-10"`}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			evaler, err := NewNaiveEvaler(tc.input)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+
+			var dollar interface{}
+			if err := json.Unmarshal([]byte(tc.context), &dollar); err != nil {
+				t.Fatalf("couldn't decode %s: %s", tc.context, err)
+			}
+
+			result, err := evaler.RunWithOptions(dollar, RunOptions{TimeZone: "Asia/Kolkata"})
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			stringResult := make([]string, len(result))
+			for i, v := range result {
+				s, err := json.Marshal(v)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stringResult[i] = string(s)
+			}
+
+			if !reflect.DeepEqual(tc.expected, stringResult) {
+				t.Fatalf("expected %#v, got %#v", tc.expected, stringResult)
+			}
+		})
+	}
+
+	evaler, err := NewNaiveEvaler("lax $")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = evaler.RunWithOptions(nil, RunOptions{TimeZone: "Mars/Olympus_Mons"})
+	if err == nil || err.Error() != `unknown time zone "Mars/Olympus_Mons"` {
+		t.Fatalf("expected unknown time zone error, got %v", err)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []string
+	}{
+		{"lax $", []string{}},
+		{"lax $ ? (@ == 1)", []string{}},
+		{"lax $foo", []string{"foo"}},
+		{"lax $foo + $bar + $foo", []string{"bar", "foo"}},
+		{"lax $.items[$i to $j] ? (@.price > $min && exists (@.tags ? (@ == $tag)))", []string{"i", "j", "min", "tag"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			evaler, err := NewNaiveEvaler(tc.input)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			if vars := evaler.Variables(); !reflect.DeepEqual(vars, tc.expected) {
+				t.Fatalf("expected %#v, got %#v", tc.expected, vars)
+			}
+		})
+	}
+}
@@ -5,14 +5,18 @@ import (
 	"regexp"
 )
 
-type jsonPathNode interface {
+// Node is any node of a jsonpath's AST. Expr, Pred and Accessor narrow it
+// down to the nodes which can appear in each position, and can only be
+// implemented by this package's types.
+type Node interface {
 	Format(*bytes.Buffer)
-	Walk(visitor)
+	Walk(Visitor)
 }
 
-type jsonPathExpr interface {
+// Expr is a node which evaluates to a sequence of JSON values.
+type Expr interface {
 	Format(*bytes.Buffer)
-	Walk(visitor)
+	Walk(Visitor)
 
 	naiveEval(*naiveEvalContext) (jsonSequence, error)
 }
@@ -25,170 +29,261 @@ const (
 	sqlJsonUnknown
 )
 
-type jsonPathPred interface {
+// Pred is a node which evaluates to true, false or unknown, as the filter
+// of a FilterNode.
+type Pred interface {
 	Format(*bytes.Buffer)
-	Walk(visitor)
+	Walk(Visitor)
 
 	naivePredEval(*naiveEvalContext) (sqlJsonBool, error)
 }
 
-type accessor interface {
+// Accessor is a node which maps each value of a sequence to zero or more
+// values, as the right hand side of an AccessExpr.
+type Accessor interface {
 	Format(*bytes.Buffer)
-	Walk(visitor)
+	Walk(Visitor)
 
 	naiveAccess(*naiveEvalContext, jsonSequence) (jsonSequence, error)
 }
 
+// Program is a whole jsonpath, as returned by Parse.
 type Program struct {
-	mode executionMode
-	root jsonPathExpr
+	Mode Mode
+	Root Expr
+	// Implicit is set when the path didn't begin with strict or lax, so its
+	// mode came from ParseOptions.
+	Implicit bool
+	// PrintImplicitMode makes Format write the mode of a path even when it
+	// was implicit, rather than leaving it out as the input did.
+	PrintImplicitMode bool
 }
 
-type binExprType int
+// BinExprType is the operator of a BinExpr.
+type BinExprType int
 
 const (
-	plusBinOp binExprType = iota
-	minusBinOp
-	timesBinOp
-	divBinOp
-	modBinOp
+	PlusBinOp BinExprType = iota
+	MinusBinOp
+	TimesBinOp
+	DivBinOp
+	ModBinOp
 )
 
 type BinExpr struct {
-	t     binExprType
-	left  jsonPathExpr
-	right jsonPathExpr
+	Op    BinExprType
+	Left  Expr
+	Right Expr
 }
 
-type binPredType int
+// BinPredType is the comparison of a BinPred.
+type BinPredType int
 
 const (
-	eqBinOp binPredType = iota
-	neqBinOp
-	gtBinOp
-	gteBinOp
-	ltBinOp
-	lteBinOp
+	EqBinOp BinPredType = iota
+	NeqBinOp
+	GtBinOp
+	GteBinOp
+	LtBinOp
+	LteBinOp
 )
 
 type BinPred struct {
-	t     binPredType
-	left  jsonPathExpr
-	right jsonPathExpr
+	Op    BinPredType
+	Left  Expr
+	Right Expr
 }
 
-type binLogicType int
+// BinLogicType is the operator of a BinLogic.
+type BinLogicType int
 
 const (
-	andBinOp binLogicType = iota
-	orBinOp
+	AndBinOp BinLogicType = iota
+	OrBinOp
 )
 
 type BinLogic struct {
-	t     binLogicType
-	left  jsonPathPred
-	right jsonPathPred
+	Op    BinLogicType
+	Left  Pred
+	Right Pred
 }
 
-type unaryExprType int
+// UnaryExprType is the operator of a UnaryExpr.
+type UnaryExprType int
 
 const (
-	uminus unaryExprType = iota
-	uplus
+	UMinus UnaryExprType = iota
+	UPlus
 )
 
 type UnaryExpr struct {
-	t    unaryExprType
-	expr jsonPathExpr
+	Op   UnaryExprType
+	Expr Expr
 }
 
+var (
+	binExprOps   = [...]string{PlusBinOp: "+", MinusBinOp: "-", TimesBinOp: "*", DivBinOp: "/", ModBinOp: "%"}
+	binPredOps   = [...]string{EqBinOp: "==", NeqBinOp: "!=", GtBinOp: ">", GteBinOp: ">=", LtBinOp: "<", LteBinOp: "<="}
+	binLogicOps  = [...]string{AndBinOp: "&&", OrBinOp: "||"}
+	unaryExprOps = [...]string{UMinus: "-", UPlus: "+"}
+)
+
+// String returns the operator as it's written in a jsonpath.
+func (t BinExprType) String() string { return binExprOps[t] }
+
+// String returns the comparison as it's written in a jsonpath.
+func (t BinPredType) String() string { return binPredOps[t] }
+
+// String returns the operator as it's written in a jsonpath.
+func (t BinLogicType) String() string { return binLogicOps[t] }
+
+// String returns the operator as it's written in a jsonpath.
+func (t UnaryExprType) String() string { return unaryExprOps[t] }
+
 type UnaryNot struct {
-	expr jsonPathPred
+	Pred Pred
 }
 
+// ParenExpr and ParenPred group an expression or a predicate, as parentheses
+// do in the text. The tree's shape already says how its operators group, so
+// the parser doesn't produce them, and FormatNode writes the parentheses
+// which are needed whether they're there or not.
 type ParenExpr struct {
-	expr jsonPathExpr
+	Expr Expr
 }
 
 type ParenPred struct {
-	expr jsonPathPred
+	Pred Pred
 }
 
+// NumberExpr is a numeric literal, which is held exactly. Make one with
+// NewNumberExpr or NewIntExpr.
 type NumberExpr struct {
-	val float64
+	val numeric
 }
 
+// VariableExpr is `$`, `@` or a named variable, whose Name includes the
+// leading `$`.
 type VariableExpr struct {
-	name string
+	Name string
 }
 
 type LastExpr struct{}
 
-type BoolExpr struct{ val bool }
-type NullExpr struct{ val bool }
-type StringExpr struct{ val string }
+type BoolExpr struct{ Value bool }
+type NullExpr struct{}
+type StringExpr struct{ Value string }
 
 type AccessExpr struct {
-	left  jsonPathExpr
-	right accessor
+	Left  Expr
+	Right Accessor
 }
 
+// DotAccessor accesses the member Name of objects. Quoted makes Format
+// write Name as a string, which it must be if it isn't a valid identifier.
 type DotAccessor struct {
-	val    string
-	quoted bool
+	Name   string
+	Quoted bool
 }
 
 type MemberWildcardAccessor struct{}
 
+// RangeSubscriptNode is one of the subscripts of an ArrayAccessor: a single
+// index, or a range of them if End isn't nil.
 type RangeSubscriptNode struct {
-	start jsonPathExpr
-	end   jsonPathExpr
+	Start Expr
+	End   Expr
 }
 
 type ArrayAccessor struct {
-	subscripts []RangeSubscriptNode
+	Subscripts []RangeSubscriptNode
 }
 
 type WildcardArrayAccessor struct{}
 
-type function int
+// LastLevel stands in for `last` in the level bounds of a
+// RecursiveWildcardAccessor, whose levels otherwise count from 0 for the
+// values it's applied to.
+const LastLevel = -1
+
+type RecursiveWildcardAccessor struct {
+	First int
+	Last  int
+}
+
+// Function is the item method called by a FuncNode.
+type Function int
 
 const (
-	typeFunction function = iota
-	sizeFunction
-	doubleFunction
-	ceilingFunction
-	floorFunction
-	absFunction
-	datetimeFunction
-	keyvalueFunction
+	TypeFunction Function = iota
+	SizeFunction
+	DoubleFunction
+	CeilingFunction
+	FloorFunction
+	AbsFunction
+	DatetimeFunction
+	KeyvalueFunction
+	BigintFunction
+	IntegerFunction
+	NumberFunction
+	DecimalFunction
+	StringFunction
+	BooleanFunction
+	DateFunction
+	TimeFunction
+	TimeTZFunction
+	TimestampFunction
+	TimestampTZFunction
 )
 
+// datetimeMethodKinds maps the typed datetime item methods to the kind of
+// value they produce.
+var datetimeMethodKinds = map[Function]datetimeKind{
+	DateFunction:        dateKind,
+	TimeFunction:        timeKind,
+	TimeTZFunction:      timeTZKind,
+	TimestampFunction:   timestampKind,
+	TimestampTZFunction: timestampTZKind,
+}
+
+// FuncNode calls an item method, such as `.size()`. The only arguments are
+// the template of `.datetime()`, a StringExpr, and the precision and scale
+// of `.decimal()` and the datetime methods, NumberExprs. A `.datetime()`
+// template is compiled once, by NewFuncNode and the parser, and kept to be
+// used for every item.
 type FuncNode struct {
-	f   function
-	arg jsonPathNode
+	Func     Function
+	Args     []Node
+	template *datetimeTemplate
 }
 
 type FilterNode struct {
-	pred jsonPathPred
+	Pred Pred
 }
 
 type ExistsNode struct {
-	expr jsonPathExpr
+	Expr Expr
 }
 
+// LikeRegexNode matches strings against an XQuery regular expression. Make
+// one with NewLikeRegexNode, which checks the pattern and its flags.
 type LikeRegexNode struct {
-	left       jsonPathExpr
-	rawPattern string
-	pattern    *regexp.Regexp
-	flag       *string
+	Left    Expr
+	Pattern string
+	Flag    string
+	regex   *regexp.Regexp
 }
 
 type StartsWithNode struct {
-	left  jsonPathExpr
-	right jsonPathExpr
+	Left  Expr
+	Right Expr
 }
 
 type IsUnknownNode struct {
-	expr jsonPathPred
+	Pred Pred
 }
+
+// BadNode stands in for a part of the input which couldn't be parsed, in the
+// partial AST returned by ParseWithRecovery. It can take the place of an
+// expression, a predicate or an accessor.
+type BadNode struct{}
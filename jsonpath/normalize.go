@@ -0,0 +1,84 @@
+package jsonpath
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// Normalize returns p in a canonical form, in which programs which differ
+// only in how they were written are equal: in whitespace or parentheses,
+// including ParenExpr and ParenPred, in whether the mode was written,
+// in quoting members which don't need it, in the order of like_regex flags,
+// and in trailing zeros after the decimal point of a number which is
+// compared, used as a subscript or passed to an item method.
+//
+// Elsewhere trailing zeros are kept, since arithmetic keeps the scale of its
+// operands, so `$ + 1.0` gives 2.0 where `$ + 1` gives 2 for $ = 1.
+func Normalize(p Program) Program {
+	res, _ := Rewrite(p, func(n Node) Node {
+		switch t := n.(type) {
+		case ParenExpr:
+			return t.Expr
+		case ParenPred:
+			return t.Pred
+		case DotAccessor:
+			t.Quoted = !isIdentifier(t.Name)
+			return t
+		case BinPred:
+			t.Left, t.Right = trimLiteral(t.Left), trimLiteral(t.Right)
+			return t
+		case RangeSubscriptNode:
+			t.Start = trimLiteral(t.Start)
+			if t.End != nil {
+				t.End = trimLiteral(t.End)
+			}
+			return t
+		case FuncNode:
+			for i, a := range t.Args {
+				if e, ok := a.(Expr); ok {
+					t.Args[i] = trimLiteral(e)
+				}
+			}
+			return t
+		case LikeRegexNode:
+			flags := strings.Split(t.Flag, "")
+			sort.Strings(flags)
+			t.Flag = ""
+			for i, f := range flags {
+				if i == 0 || f != flags[i-1] {
+					t.Flag += f
+				}
+			}
+			return t
+		}
+		return n
+	})
+	prog := res.(Program)
+	prog.Implicit, prog.PrintImplicitMode = false, false
+	return prog
+}
+
+// trimLiteral removes the trailing zeros of e if it's a number literal, where
+// they can't be seen.
+func trimLiteral(e Expr) Expr {
+	switch t := e.(type) {
+	case NumberExpr:
+		return NumberExpr{val: t.val.trimScale()}
+	case UnaryExpr:
+		if _, ok := t.Expr.(NumberExpr); ok {
+			t.Expr = trimLiteral(t.Expr)
+			return t
+		}
+	}
+	return e
+}
+
+// Fingerprint returns a hash, in hex, of the canonical form of p, so that
+// programs which Normalize makes equal have the same fingerprint. It's as
+// stable as the output of FormatNode.
+func Fingerprint(p Program) string {
+	sum := sha256.Sum256([]byte(FormatNode(Normalize(p))))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,71 @@
+package jsonpath
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"$.a", "lax $.a"},
+		{"strict $.\"a\".\"b c\"", "strict $.a.\"b c\""},
+		{"lax $[1.0 to 2.500] ? (@ == 1e2 && @ != 0.00)", "lax $[1 to 2.5]?(@ == 100 && @ != 0)"},
+		{"lax $ ? (((@.a == 1)))", "lax $?(@.a == 1)"},
+		{"lax $ ? (@ like_regex \"a\" flag \"sis\")", "lax $?(@ like_regex \"a\" flag \"is\")"},
+		{"lax $.decimal(5, 2)", "lax $.decimal(5, 2)"},
+		{"lax $.decimal(5.0, -2.00)", "lax $.decimal(5, -2)"},
+		{"lax $ ? (@ > -1.50 + 1.0)[2.0]", "lax $?(@ > -1.50 + 1.0)[2]"},
+		{"lax $ ? (@ > -1.50)", "lax $?(@ > -1.5)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			p, err := Parse(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := FormatNode(Normalize(p))
+			if res != tc.expected {
+				t.Fatalf("expected `%s`, got `%s`", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := func(input string) string {
+		p, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Fingerprint(p)
+	}
+
+	same := [][2]string{
+		{"$.a ? (@.b > 1.0)", "lax   $.\"a\"?((@.\"b\" > 1))"},
+		{"lax $[*] ? (@ like_regex \"x\" flag \"iq\")", "lax $[*] ? (@ like_regex \"x\" flag \"qi\")"},
+		{"lax 1 + (2 * 3)", "lax 1 + 2 * 3"},
+	}
+	for _, tc := range same {
+		if fingerprint(tc[0]) != fingerprint(tc[1]) {
+			t.Errorf("expected `%s` and `%s` to have the same fingerprint", tc[0], tc[1])
+		}
+	}
+
+	different := [][2]string{
+		{"lax $.a", "strict $.a"},
+		{"lax $.a", "lax $.\"a \""},
+		{"lax (1 + 2) * 3", "lax 1 + 2 * 3"},
+		{"lax $ ? (@ == 1 && @ == 2)", "lax $ ? (@ == 2 && @ == 1)"},
+		{"lax $ + 1.0", "lax $ + 1"},
+	}
+	for _, tc := range different {
+		if fingerprint(tc[0]) == fingerprint(tc[1]) {
+			t.Errorf("expected `%s` and `%s` to have different fingerprints", tc[0], tc[1])
+		}
+	}
+
+	if f := fingerprint("lax $.a"); len(f) != 64 {
+		t.Errorf("expected a hex SHA-256, got %q", f)
+	}
+}
@@ -0,0 +1,312 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// numeric is an exact decimal number, coef * 10^-scale, following the
+// semantics of PostgreSQL's numeric type. As in PostgreSQL, the scale is
+// never negative and is kept as part of the value, so 1.50 prints as 1.50.
+type numeric struct {
+	coef  *big.Int
+	scale int
+}
+
+const (
+	// minSignificantDigits and maxDisplayScale bound the scale of quotients,
+	// as NUMERIC_MIN_SIG_DIGITS and NUMERIC_MAX_DISPLAY_SCALE do in
+	// PostgreSQL.
+	minSignificantDigits = 16
+	maxDisplayScale      = 1000
+	// maxExponent bounds the exponents accepted when parsing, as PostgreSQL
+	// does, so that a short literal can't describe an enormous number.
+	maxExponent = 1000
+)
+
+var bigTen = big.NewInt(10)
+
+// coefficient returns n's coef, which is nil in the zero value, numeric{},
+// and taken to be 0.
+func (n numeric) coefficient() *big.Int {
+	if n.coef == nil {
+		return new(big.Int)
+	}
+	return n.coef
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+func numericFromInt(i int64) numeric {
+	return numeric{coef: big.NewInt(i)}
+}
+
+func numericFromFloat(f float64) numeric {
+	n, _ := parseNumeric(strconv.FormatFloat(f, 'g', -1, 64))
+	return n
+}
+
+// parseNumeric parses a decimal number with an optional sign, fraction and
+// exponent.
+func parseNumeric(s string) (numeric, bool) {
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil || e > maxExponent || e < -maxExponent {
+			return numeric{}, false
+		}
+		mantissa, exp = s[:i], e
+	}
+	scale := 0
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		scale = len(mantissa) - i - 1
+		mantissa = mantissa[:i] + mantissa[i+1:]
+	}
+	if mantissa == "" || mantissa == "+" || mantissa == "-" {
+		return numeric{}, false
+	}
+	coef, ok := new(big.Int).SetString(mantissa, 10)
+	if !ok {
+		return numeric{}, false
+	}
+	scale -= exp
+	if scale < 0 {
+		coef.Mul(coef, pow10(-scale))
+		scale = 0
+	}
+	return numeric{coef: coef, scale: scale}, true
+}
+
+// asNumeric returns the number held by a JSON value, which can come from a
+// literal, from encoding/json as a float64, from a decoder using UseNumber
+// as a json.Number, or from a Go int passed as a variable.
+func asNumeric(v interface{}) (numeric, bool) {
+	switch t := v.(type) {
+	case numeric:
+		return t, true
+	case float64:
+		return numericFromFloat(t), true
+	case int:
+		return numericFromInt(int64(t)), true
+	case int64:
+		return numericFromInt(t), true
+	case json.Number:
+		return parseNumeric(string(t))
+	}
+	return numeric{}, false
+}
+
+func (n numeric) String() string {
+	s := new(big.Int).Abs(n.coefficient()).String()
+	if n.scale > 0 {
+		if len(s) <= n.scale {
+			s = strings.Repeat("0", n.scale-len(s)+1) + s
+		}
+		s = s[:len(s)-n.scale] + "." + s[len(s)-n.scale:]
+	}
+	if n.coefficient().Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+func (n numeric) MarshalJSON() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+func (n numeric) float64() (float64, error) {
+	return strconv.ParseFloat(n.String(), 64)
+}
+
+// int64 returns the value of n if it is an integer that fits in an int64.
+func (n numeric) int64() (int64, bool) {
+	if !n.isInteger() {
+		return 0, false
+	}
+	i := n.trunc().coef
+	return i.Int64(), i.IsInt64()
+}
+
+func (n numeric) isInteger() bool {
+	return n.cmp(n.trunc()) == 0
+}
+
+func (n numeric) sign() int {
+	return n.coefficient().Sign()
+}
+
+// rescale returns n with the given scale, which must be at least n's.
+func (n numeric) rescale(scale int) numeric {
+	if scale == n.scale {
+		return n
+	}
+	return numeric{coef: new(big.Int).Mul(n.coefficient(), pow10(scale-n.scale)), scale: scale}
+}
+
+// trimScale returns n with the trailing zeros of its fraction removed, so
+// that 1.50 becomes 1.5 and 2.0 becomes 2.
+func (n numeric) trimScale() numeric {
+	coef, scale := n.coefficient(), n.scale
+	for scale > 0 {
+		q, r := new(big.Int).QuoRem(coef, bigTen, new(big.Int))
+		if r.Sign() != 0 {
+			break
+		}
+		coef, scale = q, scale-1
+	}
+	return numeric{coef: coef, scale: scale}
+}
+
+func align(x, y numeric) (numeric, numeric) {
+	if x.scale < y.scale {
+		return x.rescale(y.scale), y
+	}
+	return x, y.rescale(x.scale)
+}
+
+func (n numeric) cmp(o numeric) int {
+	x, y := align(n, o)
+	return x.coefficient().Cmp(y.coefficient())
+}
+
+func (n numeric) neg() numeric {
+	return numeric{coef: new(big.Int).Neg(n.coefficient()), scale: n.scale}
+}
+
+func (n numeric) abs() numeric {
+	return numeric{coef: new(big.Int).Abs(n.coefficient()), scale: n.scale}
+}
+
+func (n numeric) add(o numeric) numeric {
+	x, y := align(n, o)
+	return numeric{coef: new(big.Int).Add(x.coefficient(), y.coefficient()), scale: x.scale}
+}
+
+func (n numeric) sub(o numeric) numeric {
+	return n.add(o.neg())
+}
+
+func (n numeric) mul(o numeric) numeric {
+	return numeric{coef: new(big.Int).Mul(n.coefficient(), o.coefficient()), scale: n.scale + o.scale}
+}
+
+// quo divides num by den, rounding half away from zero.
+func quo(num, den *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() != 0 && new(big.Int).Abs(new(big.Int).Lsh(r, 1)).Cmp(new(big.Int).Abs(den)) >= 0 {
+		if num.Sign() == den.Sign() {
+			q.Add(q, big.NewInt(1))
+		} else {
+			q.Sub(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+// round rounds n half away from zero to the given number of digits after
+// the decimal point, which can be negative to round to tens, hundreds, etc.
+func (n numeric) round(scale int) numeric {
+	if scale >= n.scale {
+		return n.rescale(scale)
+	}
+	coef := quo(n.coefficient(), pow10(n.scale-scale))
+	if scale < 0 {
+		return numeric{coef: coef.Mul(coef, pow10(-scale))}
+	}
+	return numeric{coef: coef, scale: scale}
+}
+
+func (n numeric) trunc() numeric {
+	return numeric{coef: new(big.Int).Quo(n.coefficient(), pow10(n.scale))}
+}
+
+func (n numeric) floor() numeric {
+	t := n.trunc()
+	if n.sign() < 0 && t.cmp(n) != 0 {
+		return t.sub(numericFromInt(1))
+	}
+	return t
+}
+
+func (n numeric) ceil() numeric {
+	t := n.trunc()
+	if n.sign() > 0 && t.cmp(n) != 0 {
+		return t.add(numericFromInt(1))
+	}
+	return t
+}
+
+// weight returns the position of n's leading digit in base 10000, and the
+// value of that digit, as PostgreSQL stores numerics.
+func (n numeric) weight() (int, int64) {
+	if n.sign() == 0 {
+		return 0, 0
+	}
+	exp := len(new(big.Int).Abs(n.coefficient()).String()) - 1 - n.scale
+	w := exp / 4
+	if exp < 0 && exp%4 != 0 {
+		w--
+	}
+	shift := 4*w + n.scale
+	digit := new(big.Int).Abs(n.coefficient())
+	if shift >= 0 {
+		digit.Quo(digit, pow10(shift))
+	} else {
+		digit.Mul(digit, pow10(-shift))
+	}
+	return w, digit.Int64()
+}
+
+// div divides n by o, choosing the scale of the result the way PostgreSQL's
+// select_div_scale does: enough digits for at least 16 significant digits,
+// and no fewer than either argument has.
+func (n numeric) div(o numeric) (numeric, error) {
+	if o.sign() == 0 {
+		return numeric{}, fmt.Errorf("division by zero")
+	}
+	w1, d1 := n.weight()
+	w2, d2 := o.weight()
+	qweight := w1 - w2
+	if d1 <= d2 {
+		qweight--
+	}
+	scale := minSignificantDigits - qweight*4
+	if scale < n.scale {
+		scale = n.scale
+	}
+	if scale < o.scale {
+		scale = o.scale
+	}
+	if scale < 0 {
+		scale = 0
+	}
+	if scale > maxDisplayScale {
+		scale = maxDisplayScale
+	}
+	num := new(big.Int).Mul(n.coefficient(), pow10(o.scale+scale))
+	den := new(big.Int).Mul(o.coefficient(), pow10(n.scale))
+	return numeric{coef: quo(num, den), scale: scale}, nil
+}
+
+// mod returns the remainder of truncated division, which has the sign of n.
+func (n numeric) mod(o numeric) (numeric, error) {
+	if o.sign() == 0 {
+		return numeric{}, fmt.Errorf("division by zero")
+	}
+	x, y := align(n, o)
+	return numeric{coef: new(big.Int).Rem(x.coefficient(), y.coefficient()), scale: x.scale}, nil
+}
+
+// digits returns the number of digits before the decimal point.
+func (n numeric) digits() int {
+	t := n.trunc()
+	if t.sign() == 0 {
+		return 0
+	}
+	return len(new(big.Int).Abs(t.coefficient()).String())
+}
@@ -0,0 +1,89 @@
+package jsonpath
+
+import "testing"
+
+func TestNumeric(t *testing.T) {
+	testCases := []struct {
+		x, op, y string
+		expected string
+	}{
+		{"1", "+", "2", "3"},
+		{"0.1", "+", "0.2", "0.3"},
+		{"1.50", "+", "1", "2.50"},
+		{"1", "-", "1.25", "-0.25"},
+		{"1.5", "*", "1.5", "2.25"},
+		{"1e2", "*", "2", "200"},
+		{"1", "/", "3", "0.33333333333333333333"},
+		{"2", "/", "3", "0.66666666666666666667"},
+		{"-2", "/", "3", "-0.66666666666666666667"},
+		{"10", "/", "4", "2.5000000000000000"},
+		{"1", "/", "0.0001", "10000.0000000000000000"},
+		{"123456789", "/", "1", "123456789.000000000000"},
+		{"1.000000000000000000001", "/", "1", "1.000000000000000000001"},
+		{"7", "%", "3", "1"},
+		{"-7", "%", "3", "-1"},
+		{"7", "%", "-3", "1"},
+		{"5.5", "%", "2", "1.5"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.x+tc.op+tc.y, func(t *testing.T) {
+			x, ok := parseNumeric(tc.x)
+			if !ok {
+				t.Fatalf("couldn't parse %s", tc.x)
+			}
+			y, ok := parseNumeric(tc.y)
+			if !ok {
+				t.Fatalf("couldn't parse %s", tc.y)
+			}
+			var result numeric
+			var err error
+			switch tc.op {
+			case "+":
+				result = x.add(y)
+			case "-":
+				result = x.sub(y)
+			case "*":
+				result = x.mul(y)
+			case "/":
+				result, err = x.div(y)
+			case "%":
+				result, err = x.mod(y)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.String() != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, result.String())
+			}
+		})
+	}
+}
+
+func TestNumericRound(t *testing.T) {
+	testCases := []struct {
+		input    string
+		scale    int
+		expected string
+	}{
+		{"1.5", 0, "2"},
+		{"-1.5", 0, "-2"},
+		{"1.45", 1, "1.5"},
+		{"1.44", 1, "1.4"},
+		{"1.5", 3, "1.500"},
+		{"1250", -2, "1300"},
+		{"0.0001", 2, "0.00"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			n, ok := parseNumeric(tc.input)
+			if !ok {
+				t.Fatalf("couldn't parse %s", tc.input)
+			}
+			if result := n.round(tc.scale).String(); result != tc.expected {
+				t.Fatalf("expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package jsonpath
+
+import "bytes"
+
+// Optimize returns p simplified, so that there's less left to do for each
+// item it's evaluated against, without changing its results or the errors it
+// raises in either mode:
+//
+//   - arithmetic on literal numbers is done once, here, so `2 * 50` becomes
+//     `100`, unless it would fail, as `1 / 0` does;
+//   - `x + 0`, `x - 0`, `x * 1`, `+x` and `--x` become x when x is always a
+//     single number, such as `last`, so `$[last - 0]` becomes `$[last]`;
+//   - `!!p` becomes p;
+//   - a predicate which is always true is dropped from `&&`, as one which is
+//     always false is from `||`, and `p && q` becomes q when q is always
+//     false and p can't raise an error, as `p || q` does when q is true;
+//   - a filter which is always true is dropped;
+//   - ParenExpr and ParenPred are replaced by what they wrap, since the shape
+//     of the tree already says how it groups.
+//
+// The text can't say that a value is worked out once and used for every
+// item of a filter, so instead NewNaiveEvalerForProgram marks each
+// subexpression of a filter which doesn't depend on `@`, and it's evaluated
+// at most once per run.
+func Optimize(p Program) Program {
+	o := optimizer{ctx: &naiveEvalContext{mode: p.Mode}}
+	res, _ := Rewrite(p, o.node)
+	return res.(Program)
+}
+
+type optimizer struct {
+	// ctx evaluates the parts of the tree which don't depend on the input.
+	ctx *naiveEvalContext
+}
+
+func (o optimizer) node(n Node) Node {
+	switch t := n.(type) {
+	case ParenExpr:
+		return t.Expr
+	case ParenPred:
+		return t.Pred
+	case BinExpr:
+		if isNumberLiteral(t.Left) && isNumberLiteral(t.Right) {
+			return o.fold(t)
+		}
+		if isSingleNumber(t.Left) && isIdentity(t.Right, t.Op, false) {
+			return t.Left
+		}
+		if isSingleNumber(t.Right) && isIdentity(t.Left, t.Op, true) {
+			return t.Right
+		}
+	case UnaryExpr:
+		if isNumberLiteral(t.Expr) {
+			return o.fold(t)
+		}
+		if t.Op == UPlus && isSingleNumber(t.Expr) {
+			return t.Expr
+		}
+		if inner, ok := t.Expr.(UnaryExpr); ok && t.Op == UMinus && inner.Op == UMinus && isSingleNumber(inner.Expr) {
+			return inner.Expr
+		}
+	case UnaryNot:
+		if inner, ok := t.Pred.(UnaryNot); ok {
+			return inner.Pred
+		}
+	case BinLogic:
+		return o.logic(t)
+	case AccessExpr:
+		// A string subscript gets a hint in its error which a filtered one
+		// doesn't, so the filter of `["a"?(true == true)]` is kept.
+		if _, ok := t.Left.(StringExpr); ok {
+			break
+		}
+		if f, ok := t.Right.(FilterNode); ok {
+			if v, ok := o.truth(f.Pred); ok && v == sqlJsonTrue {
+				return t.Left
+			}
+		}
+	}
+	return n
+}
+
+// fold evaluates e, whose operands are literal numbers, unless that fails.
+func (o optimizer) fold(e Expr) Expr {
+	res, err := e.naiveEval(o.ctx)
+	if err != nil {
+		return e
+	}
+	if n, ok := res[0].(numeric); ok {
+		return numberLiteral(n)
+	}
+	return e
+}
+
+func (o optimizer) logic(t BinLogic) Node {
+	// unit is the value which t.Op ignores, and zero the one which decides it.
+	unit, zero := sqlJsonTrue, sqlJsonFalse
+	if t.Op == OrBinOp {
+		unit, zero = zero, unit
+	}
+	l, lok := o.truth(t.Left)
+	r, rok := o.truth(t.Right)
+	switch {
+	case lok && l == unit:
+		return t.Right
+	case rok && r == unit:
+		return t.Left
+	case rok && r == zero && !o.canFail(t.Left):
+		return t.Right
+	case lok && l == zero && !o.canFail(t.Right):
+		return t.Left
+	}
+	return t
+}
+
+// truth returns the value of p if it doesn't depend on the input.
+func (o optimizer) truth(p Pred) (sqlJsonBool, bool) {
+	constant := true
+	Inspect(p, func(n Node) bool {
+		switch n.(type) {
+		case VariableExpr, LastExpr, AccessExpr, BadNode, invariantExpr:
+			constant = false
+		}
+		return constant
+	})
+	if !constant {
+		return 0, false
+	}
+	v, err := p.naivePredEval(o.ctx)
+	return v, err == nil
+}
+
+// canFail reports whether evaluating p might raise an error, rather than
+// make it unknown.
+func (o optimizer) canFail(p Pred) bool {
+	if _, ok := o.truth(p); ok {
+		return false
+	}
+	switch t := p.(type) {
+	case ExistsNode:
+		return false
+	case UnaryNot:
+		return o.canFail(t.Pred)
+	case IsUnknownNode:
+		return o.canFail(t.Pred)
+	case BinLogic:
+		return o.canFail(t.Left) || o.canFail(t.Right)
+	}
+	return true
+}
+
+// numberLiteral returns n as the parser would read it, with a negative
+// number written as `-` applied to its absolute value.
+func numberLiteral(n numeric) Expr {
+	if n.sign() < 0 {
+		return NewUnaryExpr(UMinus, NumberExpr{val: n.neg()})
+	}
+	return NumberExpr{val: n}
+}
+
+func isNumberLiteral(e Expr) bool {
+	if u, ok := e.(UnaryExpr); ok && u.Op == UMinus {
+		e = u.Expr
+	}
+	_, ok := e.(NumberExpr)
+	return ok
+}
+
+// isSingleNumber reports whether e always evaluates to a single number, if it
+// doesn't raise an error.
+func isSingleNumber(e Expr) bool {
+	switch t := e.(type) {
+	case NumberExpr, LastExpr, BinExpr:
+		return true
+	case UnaryExpr:
+		return isSingleNumber(t.Expr)
+	}
+	return false
+}
+
+// isIdentity reports whether e is an integer which leaves the other operand
+// of op as it is, scale and all, where left says which side of op e is on.
+func isIdentity(e Expr, op BinExprType, left bool) bool {
+	n, ok := e.(NumberExpr)
+	if !ok || n.val.scale != 0 {
+		return false
+	}
+	switch op {
+	case PlusBinOp:
+		return n.val.sign() == 0
+	case MinusBinOp:
+		return n.val.sign() == 0 && !left
+	case TimesBinOp:
+		return n.val.cmp(numericFromInt(1)) == 0
+	}
+	return false
+}
+
+// invariantExpr stands in for an expression of a filter's predicate which
+// doesn't depend on `@`, so that it's evaluated at most once in a run rather
+// than for every item.
+type invariantExpr struct {
+	expr Expr
+	// slot is the index of its value in naiveEvalContext.invariants.
+	slot int
+}
+
+type invariantResult struct {
+	done bool
+	res  jsonSequence
+	err  error
+}
+
+func (n invariantExpr) Format(b *bytes.Buffer) {
+	n.expr.Format(b)
+}
+
+func (n invariantExpr) Walk(v Visitor) {
+	if rec := v.VisitPre(n); rec {
+		v.VisitPost(n)
+	}
+}
+
+func (n invariantExpr) naiveEval(ctx *naiveEvalContext) (jsonSequence, error) {
+	r := &ctx.invariants[n.slot]
+	if !r.done {
+		r.res, r.err = n.expr.naiveEval(ctx)
+		r.done = true
+	}
+	return r.res, r.err
+}
+
+// hoistInvariants returns p with each expression in its filters which doesn't
+// depend on `@` or `last` replaced by an invariantExpr, and the number of
+// them. Nothing else can change such an expression's value within a run: `$`
+// and the variables are fixed, and whether structural errors are ignored
+// depends only on where it is in the tree.
+func hoistInvariants(p Program) (Program, int) {
+	slots := 0
+	res, _ := Rewrite(p, func(n Node) Node {
+		f, ok := n.(FilterNode)
+		if !ok {
+			return n
+		}
+		// The filters within f have been done already.
+		pred, _ := Rewrite(f.Pred, func(n Node) Node {
+			e, ok := n.(Expr)
+			if !ok {
+				return n
+			}
+			switch e.(type) {
+			case NumberExpr, StringExpr, BoolExpr, NullExpr, VariableExpr, LastExpr, BadNode, invariantExpr:
+				return n
+			}
+			invariant := true
+			Inspect(e, func(n Node) bool {
+				switch t := n.(type) {
+				case VariableExpr:
+					if t.Name == "@" {
+						invariant = false
+					}
+				case LastExpr:
+					invariant = false
+				}
+				return invariant
+			})
+			if !invariant {
+				return n
+			}
+			slots++
+			return invariantExpr{expr: e, slot: slots - 1}
+		})
+		f.Pred = pred.(Pred)
+		return f
+	})
+	return res.(Program), slots
+}
@@ -0,0 +1,102 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"lax $[last - 0]", "lax $[last]"},
+		{"lax $[0 + (last * 1)]", "lax $[last]"},
+		{"lax $[--last, +last]", "lax $[last, last]"},
+		{"lax $ ? (@.x > 2 * 50)", "lax $?(@.x > 100)"},
+		{"lax 1 - 3", "lax -2"},
+		{"lax -(-(1.50 * 2))", "lax 3.00"},
+		{"lax $ ? (!(!(@.a == 1)))", "lax $?(@.a == 1)"},
+		{"lax $ ? (@.a == 1 && 1 == 1)", "lax $?(@.a == 1)"},
+		{"lax $ ? (\"a\" starts with \"b\" || @.a == 1)", "lax $?(@.a == 1)"},
+		{"lax $ ? (exists (@.a) && 1 > 2)", "lax $?(1 > 2)"},
+		{"lax $ ? (exists (@.a) || !(1 > 2))", "lax $"},
+		{"lax $ ? (1 < 2).a", "lax $.a"},
+		{"strict $.** ? (!(1 == 2)).a", "strict $.**.a"},
+
+		// These can't be simplified without losing an error or changing the
+		// scale of the result.
+		{"lax 1 / 0", "lax 1 / 0"},
+		{"lax \"a\" + 1", "lax \"a\" + 1"},
+		{"lax $.a + 0", "lax $.a + 0"},
+		{"lax -(-$.a)", "lax --$.a"},
+		{"lax $[last + 0.0]", "lax $[last + 0.0]"},
+		{"lax $ ? (@.a == 1 && 1 == 2)", "lax $?(@.a == 1 && 1 == 2)"},
+		{"lax $ ? (@ like_regex \"a\" || 1 == 1)", "lax $?(@ like_regex \"a\" || 1 == 1)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			// Parse would reject `"a" + 1`, which can only fail.
+			p, err := parse(tc.input, ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := Optimize(p)
+			if FormatNode(res) != tc.expected {
+				t.Fatalf("expected `%s`, got `%s`", tc.expected, FormatNode(res))
+			}
+			if errs := Validate(res); len(errs) > 0 {
+				t.Fatal(errs[0])
+			}
+		})
+	}
+}
+
+func TestOptimizePreservesResults(t *testing.T) {
+	// The objects have a single member each, so that the results are the
+	// same whichever order a map is iterated in, other than their order.
+	docs := []string{`1`, `"a"`, `[1, "a", [2, 3.5], {"a": [1, 2]}, null, true]`, `{"a": {"b_c": [0, -1]}}`}
+	vars := map[string]interface{}{"x": numericFromInt(2)}
+	pointer := regexp.MustCompile(`0x[0-9a-f]+`)
+	show := func(res jsonSequence, err error) string {
+		if err != nil {
+			// Some errors show the addresses of the big.Ints in numbers.
+			return "error: " + pointer.ReplaceAllString(err.Error(), "0x")
+		}
+		s := make([]string, len(res))
+		for i, v := range res {
+			s[i] = fmt.Sprint(v)
+		}
+		sort.Strings(s)
+		return strings.Join(s, ", ")
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		g := &astGenerator{r: r}
+		p := NewProgram(Mode(r.Intn(2)), g.expr(4))
+		opt := NewNaiveEvalerForProgram(p)
+		if errs := Validate(opt.optimized); len(errs) > 0 {
+			t.Fatalf("`%s` optimized to the invalid `%s`: %v", FormatNode(p), FormatNode(opt.optimized), errs)
+		}
+		unopt := &NaiveEvaler{program: p, optimized: p}
+		for _, doc := range docs {
+			var v interface{}
+			d := json.NewDecoder(strings.NewReader(doc))
+			d.UseNumber()
+			if err := d.Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+			expected := show(unopt.RunWithVars(v, vars))
+			if res := show(opt.RunWithVars(v, vars)); res != expected {
+				t.Fatalf("`%s` optimized to `%s` on %s:\nexpected %s\ngot      %s", FormatNode(p), FormatNode(opt.optimized), doc, expected, res)
+			}
+		}
+	}
+}
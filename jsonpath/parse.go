@@ -1,20 +1,81 @@
 package jsonpath
 
-func Parse(input string) (jsonPathExpr, error) {
+// ParseOptions control how the mode of a path is decided.
+type ParseOptions struct {
+	// Mode is the mode of paths which don't begin with strict or lax. Its
+	// zero value is lax, as in PostgreSQL.
+	Mode Mode
+	// ForceMode makes Mode apply even to paths which begin with strict or
+	// lax.
+	ForceMode bool
+}
+
+// Parse parses a jsonpath, reporting syntax errors as *SyntaxError.
+//
+// Only parsing rejects paths with an expression which can only raise an
+// error, as ParseWithOptions describes. Validate doesn't check for them, so
+// trees from the constructors, the Builder, Extend, Substitute, Rewrite or
+// UnmarshalJSON aren't checked unless they're formatted and parsed again.
+func Parse(input string) (Program, error) {
+	return ParseWithOptions(input, ParseOptions{})
+}
+
+// ParseWithOptions is Parse, with the mode of the path decided by opts.
+// Besides syntax errors and the problems Validate finds, it rejects paths
+// with an expression outside of a filter's predicate which can only raise an
+// error, such as `"a".ceiling()`.
+func ParseWithOptions(input string, opts ParseOptions) (Program, error) {
+	p, err := parse(input, opts)
+	if err != nil {
+		return Program{}, err
+	}
+	if errs := typeCheck(p); len(errs) > 0 {
+		return Program{}, errs[0]
+	}
+	return p, nil
+}
+
+// parse is ParseWithOptions without the check for expressions which can only
+// raise an error, so it reads back anything FormatNode writes.
+func parse(input string, opts ParseOptions) (Program, error) {
 	yyErrorVerbose = true
 	parser := yyNewParser()
 	tok := tokens(input)
+	tok.opts = opts
 	parser.Parse(tok)
 
 	if tok.err != nil {
-		return nil, tok.err
+		return Program{}, tok.err
 	}
 
-	validator := &validationVisitor{}
-	tok.root.Walk(validator)
-	if validator.err != nil {
-		return nil, validator.err
+	if errs := validate(tok.root, tok); len(errs) > 0 {
+		return Program{}, errs[0]
 	}
 
 	return tok.root, nil
 }
+
+// ParseWithRecovery parses input like Parse, but rather than stopping at the
+// first error it skips ahead to the next closing bracket, `&&`, `||` or the
+// end of the filter and carries on. It returns every error found, syntax
+// errors first in the order they occur in the input, along with the AST of
+// whatever could be parsed, in which BadNodes stand in for the parts that
+// couldn't. The AST is only fit for inspection, not evaluation, unless there
+// were no errors.
+func ParseWithRecovery(input string) (Program, []error) {
+	yyErrorVerbose = true
+	parser := yyNewParser()
+	tok := tokens(input)
+	tok.recover = true
+	parser.Parse(tok)
+
+	if tok.root.Root == nil {
+		tok.program(BadNode{})
+	}
+
+	errs := append(tok.diagnostics, validate(tok.root, tok)...)
+	if len(errs) == 0 {
+		errs = typeCheck(tok.root)
+	}
+	return tok.root, errs
+}
@@ -2,32 +2,33 @@ package jsonpath
 
 import (
 	"reflect"
+	"runtime"
 	"testing"
 )
 
 type parseTestCase struct {
 	input  string
-	result jsonPathNode
+	result Node
 }
 
 func TestParseComplete(t *testing.T) {
 	testCases := []parseTestCase{
-		{"lax 1", Program{root: NumberExpr{val: 1}, mode: modeLax}},
+		{"lax 1", Program{Root: NumberExpr{val: numericFromInt(1)}, Mode: ModeLax}},
 		{"lax 1+1*1",
 			Program{
-				mode: modeLax,
-				root: BinExpr{
-					t:     plusBinOp,
-					left:  NumberExpr{val: 1},
-					right: BinExpr{t: timesBinOp, left: NumberExpr{val: 1}, right: NumberExpr{val: 1}},
+				Mode: ModeLax,
+				Root: BinExpr{
+					Op:    PlusBinOp,
+					Left:  NumberExpr{val: numericFromInt(1)},
+					Right: BinExpr{Op: TimesBinOp, Left: NumberExpr{val: numericFromInt(1)}, Right: NumberExpr{val: numericFromInt(1)}},
 				}}},
 		{"lax 1*1+1",
 			Program{
-				mode: modeLax,
-				root: BinExpr{
-					t:     plusBinOp,
-					left:  BinExpr{t: timesBinOp, left: NumberExpr{val: 1}, right: NumberExpr{val: 1}},
-					right: NumberExpr{val: 1},
+				Mode: ModeLax,
+				Root: BinExpr{
+					Op:    PlusBinOp,
+					Left:  BinExpr{Op: TimesBinOp, Left: NumberExpr{val: numericFromInt(1)}, Right: NumberExpr{val: numericFromInt(1)}},
+					Right: NumberExpr{val: numericFromInt(1)},
 				}}},
 	}
 	for _, tc := range testCases {
@@ -51,7 +52,6 @@ func TestParse(t *testing.T) {
 		"lax 1 + 2 + 3",
 		"lax 1 - 1",
 		"lax 1 - (1 + 2)",
-		"lax 1 - ((((1 + 2))))",
 		"lax 1 * 2 / 3 * 4",
 		"lax 1 + -1",
 		"lax 1 + +1",
@@ -70,6 +70,13 @@ func TestParse(t *testing.T) {
 		"lax $.foo",
 		"lax $.\"$foo\"",
 		"lax $.\"$f\\\"oo\"",
+		`lax "a\tb\\c/d"`,
+		`lax "\b\f\n\r\t\v"`,
+		`lax "\u0000\u001b\u200b"`,
+		`lax "é 😀"`,
+		`lax $."a\\b"`,
+		`lax $."tab\there"`,
+		`lax $?(@ like_regex "\\d+")`,
 		"lax $.\"foo bar\"",
 		"lax $.foo.bar",
 		"lax $.*",
@@ -80,35 +87,58 @@ func TestParse(t *testing.T) {
 		"lax $[0, last - 1 to last, 5]",
 		"lax $[\"hello\"]",
 		"lax $[*]",
+		"lax $.**",
+		"lax $.**{2}",
+		"lax $.**{1 to last}",
+		"lax $.**{last}",
+		"lax $.**.foo",
 		"lax $.type()",
 		"lax $.size()",
 		"lax $.double()",
 		"lax $.ceiling()",
 		"lax $.floor()",
 		"lax $.abs()",
-		"lax $.datetime(\"foobar\")",
+		"lax $.datetime()",
+		"lax $.datetime(\"YYYY-MM-DD\")",
 		"lax $.keyvalue()",
+		"lax $.bigint()",
+		"lax $.integer()",
+		"lax $.number()",
+		"lax $.decimal()",
+		"lax $.decimal(6)",
+		"lax $.decimal(6, 2)",
+		"lax $.decimal(6, -2)",
+		"lax $.date()",
+		"lax $.time()",
+		"lax $.time(3)",
+		"lax $.time_tz(0)",
+		"lax $.timestamp()",
+		"lax $.timestamp_tz()",
+		"lax $.timestamp_tz(6)",
+		"lax $.string()",
+		"lax $.boolean()",
 
-		"lax $ ? (exists (@.foobar))",
-		"lax $ ? (1 == 1)",
-		"lax $ ? (1 > 1)",
-		"lax $ ? (1 < 1)",
-		"lax $ ? (1 <= 1)",
-		"lax $ ? (1 >= 1)",
-		"lax $ ? (1 != 1)",
+		"lax $?(exists (@.foobar))",
+		"lax $?(1 == 1)",
+		"lax $?(1 > 1)",
+		"lax $?(1 < 1)",
+		"lax $?(1 <= 1)",
+		"lax $?(1 >= 1)",
+		"lax $?(1 != 1)",
 		// "$ ? (1 <> 1)", <- need Parse2 to test this
-		"lax $ ? (1 != 1 && 1 == 1)",
-		"lax $ ? (1 != 1 || 1 == 1)",
-		"lax $ ? ((1 != 1) || 1 == 1)",
-		"lax $ ? ((1 == 1))",
-		"lax $ ? (!(1 == 1))",
+		"lax $?(1 != 1 && 1 == 1)",
+		"lax $?(1 != 1 || 1 == 1)",
+		"lax $?((1 != 1 || 1 == 1) && 1 == 1)",
+		"lax $?(!(1 == 1 && 1 == 1) || !exists (@))",
+		"lax $?(!(1 == 1))",
 
-		"lax $ ? (\"foo\" like_regex \"bar\")",
-		"lax $ ? (\"foo\" like_regex \"bar\" flag \"i\")",
-		"lax $ ? (\"foo\" starts with \"fo\")",
-		"lax $ ? ((1 == 1) is unknown)",
+		"lax $?(\"foo\" like_regex \"bar\")",
+		"lax $?(\"foo\" like_regex \"bar\" flag \"i\")",
+		"lax $?(\"foo\" like_regex \"^[a-z-[aeiou]]\" flag \"ismxq\")",
+		"lax $?(\"foo\" starts with \"fo\")",
+		"lax $?((1 == 1) is unknown)",
 
-		"lax $ ? (!(1 == 1) is unknown)",
+		"lax $?(!(1 == 1) is unknown)",
 	}
 
 	for _, tc := range testCases {
@@ -124,17 +154,79 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParseOptions(t *testing.T) {
+	testCases := []struct {
+		input string
+		opts  ParseOptions
+		mode  Mode
+		// formatted is the path formatted as it was parsed, and explicit is
+		// it formatted with PrintImplicitMode.
+		formatted string
+		explicit  string
+	}{
+		{"$.a", ParseOptions{}, ModeLax, "$.a", "lax $.a"},
+		{"lax $.a", ParseOptions{}, ModeLax, "lax $.a", "lax $.a"},
+		{"strict $.a", ParseOptions{}, ModeStrict, "strict $.a", "strict $.a"},
+		{"$.a", ParseOptions{Mode: ModeStrict}, ModeStrict, "$.a", "strict $.a"},
+		{"lax $.a", ParseOptions{Mode: ModeStrict}, ModeLax, "lax $.a", "lax $.a"},
+		{"lax $.a", ParseOptions{Mode: ModeStrict, ForceMode: true}, ModeStrict, "strict $.a", "strict $.a"},
+		{"strict $.a", ParseOptions{Mode: ModeLax, ForceMode: true}, ModeLax, "lax $.a", "lax $.a"},
+		{"$.a", ParseOptions{Mode: ModeStrict, ForceMode: true}, ModeStrict, "$.a", "strict $.a"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			p, err := ParseWithOptions(tc.input, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Mode != tc.mode {
+				t.Errorf("expected mode %v, got %v", tc.mode, p.Mode)
+			}
+			if FormatNode(p) != tc.formatted {
+				t.Errorf("expected `%s`, got `%s`", tc.formatted, FormatNode(p))
+			}
+			p.PrintImplicitMode = true
+			if FormatNode(p) != tc.explicit {
+				t.Errorf("expected `%s`, got `%s`", tc.explicit, FormatNode(p))
+			}
+		})
+	}
+}
+
 func TestParseError(t *testing.T) {
 	testCases := []struct {
 		input  string
 		errMsg string
 	}{
-		{"lax (", "syntax error: unexpected $end"},
+		{"lax (", "missing ')' to close the '(' at line 1, column 5"},
+		{"lax $ ? (exists (@.a", "missing ')' to close \"exists (\" at line 1, column 17"},
+		{"lax $[1, 2", "missing ']' to close the '[' at line 1, column 6"},
+		{"", "unexpected end of input"},
+		{"$.a lax", "unexpected 'lax'"},
+		{"lax $ # 1", "unexpected character '#'"},
 		{"lax @.foo", "@ only allowed within filter expressions"},
 		{"lax $ ? ((@.foo == 1) is unknown)[*] + @.foo", "@ only allowed within filter expressions"},
 		{"lax @.foo + $ ? ((@.foo == 1) is unknown)[*]", "@ only allowed within filter expressions"},
-		{"lax $ ? (@.foo)", "filter expressions cannot be raw json values - if you expect `@.foo` to be boolean true, write `@.foo == true`"},
+		{"lax $ ? (@.foo)", "filter expressions cannot be raw json values - if you expect `@.foo` to be boolean true, write `@.foo == true`, or to test that it exists, write `exists (@.foo)`"},
+		{"lax $ ? (1)", "filter expressions cannot be raw json values - if you expect `1` to be boolean true, write `1 == true`"},
 		{"lax last", "`last` can only appear inside an array subscript"},
+		{"lax $ ? (\"foo\" like_regex \"bar\" flag \"g\")", "unrecognized flag character \"g\" in like_regex predicate"},
+		{"lax $ ? (\"foo\" like_regex \"a}\")", "unescaped \"}\" in regular expression; write \\} to match it literally"},
+		{"lax 1.2.3", "trailing junk after numeric literal"},
+		{"lax $[12abc]", "trailing junk after numeric literal"},
+		{"lax $['a']", "array index must be a number, but found 'a'"},
+		{"lax 1 + 1e", "invalid numeric literal"},
+		{"lax 1 = 1", "use == instead of ="},
+		{"lax $.**{1.5}", "recursive wildcard level must be a non-negative integer, but found 1.5"},
+		{"lax $.decimal(1.5)", "expected an integer, but found 1.5"},
+		{"lax $.decimal(0)", "precision of .decimal() must be between 1 and 1000, but was 0"},
+		{"lax $.decimal(5, 1001)", "scale of .decimal() must be between -1000 and 1000, but was 1001"},
+		{"lax $.time(7)", "precision of .time() must be between 0 and 6, but was 7"},
+		{"lax $.timestamp_tz(-1)", "precision of .timestamp_tz() must be between 0 and 6, but was -1"},
+		{"lax $.date(1)", "unexpected number, expecting ')'"},
+		{"lax $.datetime(\"foobar\")", "invalid datetime template element at \"foobar\""},
+		{"lax $.datetime(\"HH24 AM\")", "datetime template element \"HH24\" conflicts with \"AM\""},
 	}
 
 	for _, tc := range testCases {
@@ -143,9 +235,184 @@ func TestParseError(t *testing.T) {
 			if err == nil {
 				t.Fatalf("expected \"%s\" to error with \"%s\", but no error occurred", tc.input, tc.errMsg)
 			}
-			if err.Error() != tc.errMsg {
-				t.Fatalf("expected \"%s\" to error with \"%s\", but error was \"%s\"", tc.input, tc.errMsg, err.Error())
+			msg := err.Error()
+			if e, ok := err.(*SyntaxError); ok {
+				msg = e.Msg
+			}
+			if msg != tc.errMsg {
+				t.Fatalf("expected \"%s\" to error with \"%s\", but error was \"%s\"", tc.input, tc.errMsg, msg)
+			}
+		})
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	testCases := []struct {
+		input    string
+		line     int
+		column   int
+		token    string
+		expected []string
+		rendered string
+	}{
+		{"lax (", 1, 6, "", nil, "syntax error at line 1, column 6: missing ')' to close the '(' at line 1, column 5\nlax (\n     ^"},
+		{"lax 1 = 1", 1, 7, "=", nil, "syntax error at line 1, column 7: use == instead of =\nlax 1 = 1\n      ^"},
+		{"lax $.date(12)", 1, 12, "12", []string{"')'"}, "syntax error at line 1, column 12: unexpected number, expecting ')'\nlax $.date(12)\n           ^~"},
+		{"lax $.a ? (@.b == 1) )", 1, 22, ")", nil, "syntax error at line 1, column 22: unexpected ')'\nlax $.a ? (@.b == 1) )\n                     ^"},
+		{"lax $.a\n  ? (@ == \"x)", 2, 11, "\"x)", nil, "syntax error at line 2, column 11: unterminated string\n  ? (@ == \"x)\n          ^~~"},
+		{"lax exist (1)", 1, 5, "exist", nil, "syntax error at line 1, column 5: unrecognized keyword \"exist\"\nlax exist (1)\n    ^~~~~\nhint: did you mean \"exists\"?"},
+		{"lax\t$.é[12abc]", 1, 9, "12a", nil, "syntax error at line 1, column 9: trailing junk after numeric literal\nlax\t$.é[12abc]\n   \t    ^~~"},
+		{"lax $.**{1.5}", 1, 10, "1.5", nil, "syntax error at line 1, column 10: recursive wildcard level must be a non-negative integer, but found 1.5\nlax $.**{1.5}\n         ^~~"},
+		{"lax $.decimal(- 1.5)", 1, 15, "- 1.5", nil, "syntax error at line 1, column 15: expected an integer, but found -1.5\nlax $.decimal(- 1.5)\n              ^~~~~"},
+		{"lax $ ? (@ like_regex \"(\")", 1, 23, "\"(\"", nil, "syntax error at line 1, column 23: error parsing regexp: missing closing ): `(`\nlax $ ? (@ like_regex \"(\")\n                      ^~~"},
+		{"lax $ ? ( @.a )", 1, 11, "@.a", nil, "syntax error at line 1, column 11: filter expressions cannot be raw json values - if you expect `@.a` to be boolean true, write `@.a == true`, or to test that it exists, write `exists (@.a)`\nlax $ ? ( @.a )\n          ^~~"},
+		{"lax $['a']", 1, 7, "'a'", nil, "syntax error at line 1, column 7: array index must be a number, but found 'a'\nlax $['a']\n      ^~~\nhint: members are written .\"a\", with a dot and double quotes, rather than ['a']"},
+		{"lax $.a + @.b", 1, 11, "@", nil, "syntax error at line 1, column 11: @ only allowed within filter expressions\nlax $.a + @.b\n          ^"},
+		{"lax $[0] + last", 1, 12, "last", nil, "syntax error at line 1, column 12: `last` can only appear inside an array subscript\nlax $[0] + last\n           ^~~~"},
+		{"lax $.datetime(\"foobar\")", 1, 6, ".datetime(\"foobar\")", nil, "syntax error at line 1, column 6: invalid datetime template element at \"foobar\"\nlax $.datetime(\"foobar\")\n     ^~~~~~~~~~~~~~~~~~~"},
+		{"lax $.decimal(0)", 1, 6, ".decimal(0)", nil, "syntax error at line 1, column 6: precision of .decimal() must be between 1 and 1000, but was 0\nlax $.decimal(0)\n     ^~~~~~~~~~~"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := Parse(tc.input)
+			e, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("expected a *SyntaxError, got %#v", err)
+			}
+			if e.Line != tc.line || e.Column != tc.column {
+				t.Errorf("expected line %d, column %d, got line %d, column %d", tc.line, tc.column, e.Line, e.Column)
+			}
+			if e.Token != tc.token || e.Input[e.Offset:e.End] != tc.token {
+				t.Errorf("expected token %q, got %q at [%d, %d)", tc.token, e.Token, e.Offset, e.End)
+			}
+			if !reflect.DeepEqual(e.Expected, tc.expected) {
+				t.Errorf("expected %#v to be expected, got %#v", tc.expected, e.Expected)
+			}
+			if e.Error() != tc.rendered {
+				t.Errorf("expected\n%s\ngot\n%s", tc.rendered, e.Error())
 			}
 		})
 	}
 }
+
+func TestParseWithRecovery(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+		errMsgs  []string
+	}{
+		{"lax $.a", "lax $.a", nil},
+		{"lax 1 = 1", "lax 1", []string{"use == instead of ="}},
+		{"$.a ? (@.b = 1)", "$.a?(@.b == 1)", []string{"use == instead of ="}},
+		{"lax $ ? (@.a == && @.b == 1 || @.c ==)", "lax $?(<error> && @.b == 1 || <error>)", []string{
+			"unexpected '&&'",
+			"unexpected ')'",
+		}},
+		{"lax $ ? (@.a == 1 && @.b | 2 && exists (@.c +))", "lax $?(@.a == 1 && <error> || <error> && exists (<error>))", []string{
+			"| must be followed by |",
+			"unexpected ')'",
+		}},
+		{"lax $[1, *, 3 to ].a[12abc]", "lax $[1, <error>, <error>].a[0]", []string{
+			"unexpected '*'",
+			"unexpected ']'",
+			"trailing junk after numeric literal",
+		}},
+		{"strict $.a ? (exists (@.b", "strict <error>", []string{
+			"missing ')' to close \"exists (\" at line 1, column 22",
+		}},
+		{"lax $.decimal(1.5, 2).**{2.5} ? (@ like_regex \"(\")", "lax $.decimal(<error>, 2).**{0}?(<error>)", []string{
+			"expected an integer, but found 1.5",
+			"recursive wildcard level must be a non-negative integer, but found 2.5",
+			"error parsing regexp: missing closing ): `(`",
+		}},
+		{"lax @ + last", "lax @ + last", []string{
+			"@ only allowed within filter expressions",
+			"`last` can only appear inside an array subscript",
+		}},
+		{"lax $ ? (@ == \"\\y\" && @ == \"\\q\")", "lax $?(@ == \"\" && @ == \"\")", []string{
+			"invalid escape sequence \"\\y\"",
+			"invalid escape sequence \"\\q\"",
+		}},
+		{"", "<error>", []string{"unexpected end of input"}},
+		{"lax \"a\".ceiling()", "lax \"a\".ceiling()", []string{
+			".ceiling() is only defined on type number, but `\"a\"` is of type string",
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			res, errs := ParseWithRecovery(tc.input)
+			var msgs []string
+			for _, err := range errs {
+				msg := err.Error()
+				if e, ok := err.(*SyntaxError); ok {
+					msg = e.Msg
+				}
+				msgs = append(msgs, msg)
+			}
+			if !reflect.DeepEqual(msgs, tc.errMsgs) {
+				t.Errorf("expected errors %#v, got %#v", tc.errMsgs, msgs)
+			}
+			if FormatNode(res) != tc.expected {
+				t.Errorf("expected `%s`, got `%s`", tc.expected, FormatNode(res))
+			}
+		})
+	}
+}
+
+func TestSyntaxErrorHint(t *testing.T) {
+	testCases := []struct {
+		input string
+		hint  string
+	}{
+		{"lax $ ? (exist (@.a))", "did you mean \"exists\"?"},
+		{"lax $ ? (@ startswith \"a\")", "did you mean \"starts with\"?"},
+		{"lax $ ? (@ like \"a\")", "did you mean \"like_regex\"?"},
+		{"lax $ ? (@ == TRUE)", "did you mean \"true\"?"},
+		{"lax $ + foo", ""},
+		{"lax $.a.ceil()", "did you mean .ceiling()?"},
+		{"lax $.a.flor()", "did you mean .floor()?"},
+		{"lax $.a.length()", "did you mean .size()?"},
+		{"lax $.a.foo()", ""},
+		{"lax $..foo", "recursive descent is written .** rather than .., as in $.**.name"},
+		{"lax $.items[?(@.price > 10)]", "filters follow the path rather than going in brackets, as in $.items ? (@.price > 10)"},
+		{"lax $['a b']", "members are written .\"a b\", with a dot and double quotes, rather than ['a b']"},
+		{"lax $[ 'a' ].b", "members are written .\"a\", with a dot and double quotes, rather than ['a']"},
+		{"lax $.a)", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := Parse(tc.input)
+			e, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("expected a *SyntaxError, got %#v", err)
+			}
+			if e.Hint != tc.hint {
+				t.Errorf("expected hint %q, got %q", tc.hint, e.Hint)
+			}
+		})
+	}
+}
+
+func TestParseErrorDoesNotLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if _, err := Parse("lax $.a ? (@ == 1) ) + 1"); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("expected no more than %d goroutines after failed parses, but there were %d", before, after)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	input := `strict $.items[*] ? (@.price > 10 && @.tags[*] == "sale").name.string()`
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package jsonpath
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// PrettyOptions control the layout of FormatNodePretty.
+type PrettyOptions struct {
+	// Width is the column a line should end before, if it can be broken. Its
+	// zero value means 80.
+	Width int
+	// Indent is written once for each level of nesting. Its zero value means
+	// two spaces.
+	Indent string
+}
+
+// FormatNodePretty writes n as FormatNode does, but breaks whatever doesn't
+// fit within opts.Width over several lines: each clause of a chain of `&&`
+// or `||` on its own line, the predicates of filters indented within them,
+// and the subscripts of an array accessor aligned under the first. Parse
+// reads the result back as it would the output of FormatNode.
+func FormatNodePretty(n Node, opts PrettyOptions) string {
+	if opts.Width == 0 {
+		opts.Width = 80
+	}
+	if opts.Indent == "" {
+		opts.Indent = "  "
+	}
+	p := &prettyPrinter{opts: opts}
+	p.node(n, 0)
+	return p.b.String()
+}
+
+type prettyPrinter struct {
+	b    bytes.Buffer
+	opts PrettyOptions
+	col  int
+}
+
+func (p *prettyPrinter) write(s string) {
+	p.b.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.col = utf8.RuneCountInString(s[i+1:])
+	} else {
+		p.col += utf8.RuneCountInString(s)
+	}
+}
+
+func (p *prettyPrinter) newline(indent int) {
+	p.write("\n" + strings.Repeat(p.opts.Indent, indent))
+}
+
+// flat writes n on the current line if it fits there.
+func (p *prettyPrinter) flat(n Node) bool {
+	s := FormatNode(n)
+	if p.col+utf8.RuneCountInString(s) > p.opts.Width {
+		return false
+	}
+	p.write(s)
+	return true
+}
+
+// node writes n starting at the current column, where indent is the level
+// of nesting of the line it's on.
+func (p *prettyPrinter) node(n Node, indent int) {
+	if p.flat(n) {
+		return
+	}
+	switch t := n.(type) {
+	case Program:
+		p.write(strings.TrimSuffix(FormatNode(t), FormatNode(t.Root)))
+		p.node(t.Root, indent)
+	case BinExpr:
+		prec := exprPrec(t)
+		p.expr(t.Left, prec, indent)
+		p.write(" " + t.Op.String() + " ")
+		p.expr(t.Right, prec+1, indent)
+	case UnaryExpr:
+		p.write(t.Op.String())
+		p.expr(t.Expr, precUnary, indent)
+	case AccessExpr:
+		if _, ok := unparen(t.Left).(AccessExpr); ok {
+			p.node(t.Left, indent)
+		} else {
+			var b bytes.Buffer
+			formatAccessed(&b, t.Left)
+			p.write(b.String())
+		}
+		p.node(t.Right, indent)
+	case ArrayAccessor:
+		p.write("[")
+		align := strings.Repeat(" ", p.col)
+		for i, s := range t.Subscripts {
+			if i > 0 {
+				p.write(",\n" + align)
+			}
+			p.node(s, indent)
+		}
+		p.write("]")
+	case RangeSubscriptNode:
+		p.node(t.Start, indent)
+		if t.End != nil {
+			p.write(" to ")
+			p.node(t.End, indent)
+		}
+	case FilterNode:
+		p.write("?(")
+		p.newline(indent + 1)
+		p.node(t.Pred, indent+1)
+		p.newline(indent)
+		p.write(")")
+	case BinLogic:
+		p.logic(t, indent)
+	case BinPred:
+		p.node(t.Left, indent)
+		p.write(" " + t.Op.String() + " ")
+		p.node(t.Right, indent)
+	case ParenExpr:
+		p.node(t.Expr, indent)
+	case ParenPred:
+		p.node(t.Pred, indent)
+	case UnaryNot:
+		p.write("!")
+		switch unparenPred(t.Pred).(type) {
+		case ExistsNode, IsUnknownNode, UnaryNot:
+			p.node(t.Pred, indent)
+		default:
+			p.group(t.Pred, indent)
+		}
+	case ExistsNode:
+		p.write("exists (")
+		p.node(t.Expr, indent)
+		p.write(")")
+	case LikeRegexNode:
+		p.node(t.Left, indent)
+		p.write(strings.TrimPrefix(FormatNode(t), FormatNode(t.Left)))
+	case StartsWithNode:
+		p.node(t.Left, indent)
+		p.write(" starts with ")
+		p.node(t.Right, indent)
+	case IsUnknownNode:
+		p.group(t.Pred, indent)
+		p.write(" is unknown")
+	default:
+		p.write(FormatNode(n))
+	}
+}
+
+// expr writes e, in parentheses if it binds more loosely than prec.
+func (p *prettyPrinter) expr(e Expr, prec int, indent int) {
+	if exprPrec(e) < prec {
+		p.write("(")
+		p.node(e, indent)
+		p.write(")")
+	} else {
+		p.node(e, indent)
+	}
+}
+
+// group writes pred in parentheses, on lines of its own if it doesn't fit.
+func (p *prettyPrinter) group(pred Pred, indent int) {
+	p.write("(")
+	if !p.flat(pred) {
+		p.newline(indent + 1)
+		p.node(pred, indent+1)
+		p.newline(indent)
+	}
+	p.write(")")
+}
+
+// logic writes a chain of clauses joined by the same operator one clause to
+// a line, each line after the first beginning with the operator.
+func (p *prettyPrinter) logic(t BinLogic, indent int) {
+	prec := predPrec(t)
+	for i, c := range logicClauses(t) {
+		if i > 0 {
+			p.newline(indent)
+			p.write(t.Op.String() + " ")
+		}
+		switch {
+		case i > 0 && predPrec(c) < prec+1 || i == 0 && predPrec(c) < prec:
+			p.group(c, indent)
+		case predPrec(c) != precNot:
+			// A chain of `&&` within one of `||` is indented beneath its
+			// first clause, so that the grouping is still clear.
+			if !p.flat(c) {
+				p.logic(c.(BinLogic), indent+1)
+			}
+		default:
+			p.node(c, indent)
+		}
+	}
+}
+
+// logicClauses returns the clauses of the chain of operators the same as
+// t's, which group to the left, that t is the last of.
+func logicClauses(t BinLogic) []Pred {
+	if l, ok := t.Left.(BinLogic); ok && l.Op == t.Op {
+		return append(logicClauses(l), t.Right)
+	}
+	return []Pred{t.Left, t.Right}
+}
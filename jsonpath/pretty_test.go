@@ -0,0 +1,90 @@
+package jsonpath
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestFormatNodePretty(t *testing.T) {
+	testCases := []struct {
+		input    string
+		opts     PrettyOptions
+		expected string
+	}{
+		{"lax $.a ? (@.b == 1 && @.c == 2)", PrettyOptions{}, "lax $.a?(@.b == 1 && @.c == 2)"},
+		{
+			`strict $.items[*] ? (@.price > 10 && @.tags[*] == "sale" && (@.stock < 5 || @.backorder == true) && exists (@.discounts ? (@.amount > 0 && @.expires > "2024-01-01".datetime()))).name`,
+			PrettyOptions{Width: 40},
+			`strict $.items[*]?(
+  @.price > 10
+  && @.tags[*] == "sale"
+  && (@.stock < 5 || @.backorder == true)
+  && exists (@.discounts?(
+    @.amount > 0
+    && @.expires > "2024-01-01".datetime()
+  ))
+).name`,
+		},
+		{
+			`lax $.orders[0, 2 to 4, last - 1, $.index to last].lines ? (@.sku starts with "ABC" || @.sku starts with "DEF" && @.qty > 100 || !(@.qty <= 0 && @.cancelled == false))`,
+			PrettyOptions{Width: 40, Indent: "\t"},
+			"lax $.orders[0,\n" +
+				"             2 to 4,\n" +
+				"             last - 1,\n" +
+				"             $.index to last].lines?(\n" +
+				"\t@.sku starts with \"ABC\"\n" +
+				"\t|| @.sku starts with \"DEF\"\n" +
+				"\t\t&& @.qty > 100\n" +
+				"\t|| !(@.qty <= 0 && @.cancelled == false)\n" +
+				")",
+		},
+		{
+			"lax $ ? ((@.a == 1 || @.b == 2 || @.c == 3) is unknown)",
+			PrettyOptions{Width: 30},
+			"lax $?(\n" +
+				"  (\n" +
+				"    @.a == 1\n" +
+				"    || @.b == 2\n" +
+				"    || @.c == 3\n" +
+				"  ) is unknown\n" +
+				")",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			p, err := Parse(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := FormatNodePretty(p, tc.opts)
+			if res != tc.expected {
+				t.Fatalf("expected\n%s\ngot\n%s", tc.expected, res)
+			}
+			parsed, err := Parse(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, p) {
+				t.Fatalf("expected `%s` to parse as `%s`, got `%s`", res, FormatNode(p), FormatNode(parsed))
+			}
+		})
+	}
+}
+
+func TestFormatNodePrettyRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		g := &astGenerator{r: r}
+		p := NewProgram(Mode(r.Intn(2)), g.expr(4))
+		text := FormatNodePretty(p, PrettyOptions{Width: r.Intn(60)})
+		parsed, err := parse(text, ParseOptions{})
+		if err != nil {
+			t.Fatalf("could not parse\n%s\n%v", text, err)
+		}
+		if !reflect.DeepEqual(parsed, p) {
+			t.Fatalf("\n%s\nparsed as `%s`, rather than `%s`", text, FormatNode(parsed), FormatNode(p))
+		}
+	}
+}
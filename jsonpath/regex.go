@@ -0,0 +1,457 @@
+package jsonpath
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// like_regex patterns are written in the XQuery regular expression dialect
+// (XQuery F&O 3.1, section 5.6). This file translates them into RE2 syntax
+// for Go's regexp package, rejecting the constructs RE2 cannot express.
+
+type regexFlags struct {
+	caseInsensitive bool
+	dotAll          bool
+	multiline       bool
+	extended        bool
+	literal         bool
+}
+
+func parseRegexFlags(flag string) (regexFlags, error) {
+	var f regexFlags
+	for _, r := range flag {
+		switch r {
+		case 'i':
+			f.caseInsensitive = true
+		case 's':
+			f.dotAll = true
+		case 'm':
+			f.multiline = true
+		case 'x':
+			f.extended = true
+		case 'q':
+			f.literal = true
+		default:
+			return f, fmt.Errorf("unrecognized flag character %q in like_regex predicate", string(r))
+		}
+	}
+	return f, nil
+}
+
+func compileXQueryRegex(pattern string, flag string) (*regexp.Regexp, error) {
+	flags, err := parseRegexFlags(flag)
+	if err != nil {
+		return nil, err
+	}
+	translated, err := translateXQueryRegex(pattern, flags)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(translated)
+}
+
+func translateXQueryRegex(pattern string, flags regexFlags) (string, error) {
+	var b strings.Builder
+	if flags.caseInsensitive {
+		b.WriteString("(?i)")
+	}
+	if flags.literal {
+		// With q, every character is ordinary and m, s and x have no effect.
+		b.WriteString(regexp.QuoteMeta(pattern))
+		return b.String(), nil
+	}
+	if flags.multiline {
+		b.WriteString("(?m)")
+	}
+
+	t := regexTranslator{input: []rune(pattern), flags: flags}
+	for t.pos < len(t.input) {
+		r := t.input[t.pos]
+		switch {
+		case flags.extended && isRegexWhitespace(r):
+			t.pos++
+		case r == '\\':
+			t.pos++
+			s, err := t.escape()
+			if err != nil {
+				return "", err
+			}
+			if s.set != nil {
+				s.set.writeClass(&b, s.negated)
+			} else {
+				b.WriteString(regexp.QuoteMeta(string(s.ch)))
+			}
+		case r == '[':
+			t.pos++
+			set, negated, err := t.charClass()
+			if err != nil {
+				return "", err
+			}
+			set.writeClass(&b, negated)
+		case r == '.':
+			t.pos++
+			if flags.dotAll {
+				b.WriteString("(?s:.)")
+			} else {
+				b.WriteString(`[^\n\r]`)
+			}
+		case r == '{':
+			q, err := t.quantifier()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(q)
+		case r == '(':
+			t.pos++
+			if t.peek() == '?' {
+				if t.pos+1 < len(t.input) && t.input[t.pos+1] == ':' {
+					t.pos += 2
+					b.WriteString("(?:")
+					continue
+				}
+				return "", fmt.Errorf("invalid group syntax at %q in regular expression", string(t.input[t.pos-1:]))
+			}
+			b.WriteByte('(')
+		case r == ']' || r == '}':
+			return "", fmt.Errorf("unescaped %q in regular expression; write \\%s to match it literally", string(r), string(r))
+		case strings.ContainsRune("^$|)?*+", r):
+			t.pos++
+			b.WriteRune(r)
+		default:
+			t.pos++
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return b.String(), nil
+}
+
+func isRegexWhitespace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+type regexTranslator struct {
+	input []rune
+	pos   int
+	flags regexFlags
+}
+
+func (t *regexTranslator) peek() rune {
+	if t.pos >= len(t.input) {
+		return eof
+	}
+	return t.input[t.pos]
+}
+
+// regexAtom is either a single character or a set of characters, which is
+// complemented if negated is set.
+type regexAtom struct {
+	ch      rune
+	set     *runeSet
+	negated bool
+}
+
+// escape translates the escape sequence following a backslash.
+func (t *regexTranslator) escape() (regexAtom, error) {
+	if t.pos >= len(t.input) {
+		return regexAtom{}, fmt.Errorf("trailing \\ in regular expression")
+	}
+	r := t.input[t.pos]
+	t.pos++
+	switch r {
+	case 'n':
+		return regexAtom{ch: '\n'}, nil
+	case 'r':
+		return regexAtom{ch: '\r'}, nil
+	case 't':
+		return regexAtom{ch: '\t'}, nil
+	case '\\', '|', '.', '?', '*', '+', '(', ')', '{', '}', '-', '[', ']', '^', '$':
+		return regexAtom{ch: r}, nil
+	case 'd', 'D':
+		return regexAtom{set: runeSetFromTable(unicode.Nd), negated: r == 'D'}, nil
+	case 's', 'S':
+		return regexAtom{set: newRuneSet(runeRange{' ', ' '}, runeRange{'\t', '\n'}, runeRange{'\r', '\r'}), negated: r == 'S'}, nil
+	case 'w', 'W':
+		notWord := runeSetFromTable(unicode.P).union(runeSetFromTable(unicode.Z)).union(runeSetFromTable(unicode.C))
+		return regexAtom{set: notWord, negated: r == 'w'}, nil
+	case 'i', 'I':
+		return regexAtom{set: xmlNameStartChars, negated: r == 'I'}, nil
+	case 'c', 'C':
+		return regexAtom{set: xmlNameChars, negated: r == 'C'}, nil
+	case 'p', 'P':
+		if t.peek() != '{' {
+			return regexAtom{}, fmt.Errorf("expected { after \\%s in regular expression", string(r))
+		}
+		end := t.pos
+		for end < len(t.input) && t.input[end] != '}' {
+			end++
+		}
+		if end == len(t.input) {
+			return regexAtom{}, fmt.Errorf("unterminated \\%s{ in regular expression", string(r))
+		}
+		name := string(t.input[t.pos+1 : end])
+		t.pos = end + 1
+		if strings.HasPrefix(name, "Is") {
+			return regexAtom{}, fmt.Errorf("unicode block escape \\%s{%s} is not supported", string(r), name)
+		}
+		table, ok := unicode.Categories[name]
+		if !ok {
+			return regexAtom{}, fmt.Errorf("unknown unicode category %q in regular expression", name)
+		}
+		return regexAtom{set: runeSetFromTable(table), negated: r == 'P'}, nil
+	}
+	if r >= '1' && r <= '9' {
+		return regexAtom{}, fmt.Errorf("back-references such as \\%s are not supported", string(r))
+	}
+	return regexAtom{}, fmt.Errorf("invalid escape sequence \\%s in regular expression", string(r))
+}
+
+// charClass translates a character class expression, following the opening
+// bracket, into the set of characters it matches. Subtractions are applied
+// eagerly since RE2 has no equivalent.
+func (t *regexTranslator) charClass() (*runeSet, bool, error) {
+	negated := false
+	if t.peek() == '^' {
+		negated = true
+		t.pos++
+	}
+	set := newRuneSet()
+	first := true
+	for {
+		if t.pos >= len(t.input) {
+			return nil, false, fmt.Errorf("unterminated character class in regular expression")
+		}
+		r := t.input[t.pos]
+		switch {
+		case r == ']' && !first:
+			t.pos++
+			return set, negated, nil
+		case r == '-' && t.pos+1 < len(t.input) && t.input[t.pos+1] == '[' && !first:
+			t.pos += 2
+			sub, subNegated, err := t.charClass()
+			if err != nil {
+				return nil, false, err
+			}
+			if t.peek() != ']' {
+				return nil, false, fmt.Errorf("a character class subtraction must end its character class")
+			}
+			t.pos++
+			// Close both operands under case folding before complementing
+			// them, so the difference doesn't depend on which spelling of a
+			// letter was written.
+			if t.flags.caseInsensitive {
+				set, sub = set.foldClosure(), sub.foldClosure()
+			}
+			if subNegated {
+				sub = sub.complement()
+			}
+			if negated {
+				set = set.complement()
+			}
+			return set.subtract(sub), false, nil
+		case r == '[':
+			return nil, false, fmt.Errorf("unescaped [ in character class; write \\[ to match it literally")
+		}
+		first = false
+
+		lo, err := t.classAtom()
+		if err != nil {
+			return nil, false, err
+		}
+		if lo.set != nil {
+			if lo.negated {
+				set = set.union(lo.set.complement())
+			} else {
+				set = set.union(lo.set)
+			}
+			continue
+		}
+		if t.peek() == '-' && t.pos+1 < len(t.input) && t.input[t.pos+1] != ']' && t.input[t.pos+1] != '[' {
+			t.pos++
+			hi, err := t.classAtom()
+			if err != nil {
+				return nil, false, err
+			}
+			if hi.set != nil {
+				return nil, false, fmt.Errorf("invalid character range in regular expression")
+			}
+			if hi.ch < lo.ch {
+				return nil, false, fmt.Errorf("invalid character range %s-%s in regular expression", string(lo.ch), string(hi.ch))
+			}
+			set = set.union(newRuneSet(runeRange{lo.ch, hi.ch}))
+			continue
+		}
+		set = set.union(newRuneSet(runeRange{lo.ch, lo.ch}))
+	}
+}
+
+func (t *regexTranslator) classAtom() (regexAtom, error) {
+	r := t.input[t.pos]
+	t.pos++
+	if r == '\\' {
+		return t.escape()
+	}
+	return regexAtom{ch: r}, nil
+}
+
+// quantifier validates a {n}, {n,} or {n,m} quantifier, which XQuery
+// requires to be well formed.
+func (t *regexTranslator) quantifier() (string, error) {
+	start := t.pos
+	t.pos++
+	digits := func() int {
+		n := 0
+		for t.peek() >= '0' && t.peek() <= '9' {
+			t.pos++
+			n++
+		}
+		return n
+	}
+	if digits() == 0 {
+		return "", fmt.Errorf("invalid quantifier at %q in regular expression", string(t.input[start:]))
+	}
+	if t.peek() == ',' {
+		t.pos++
+		digits()
+	}
+	if t.peek() != '}' {
+		return "", fmt.Errorf("invalid quantifier at %q in regular expression", string(t.input[start:]))
+	}
+	t.pos++
+	return string(t.input[start:t.pos]), nil
+}
+
+type runeRange struct {
+	lo, hi rune
+}
+
+// runeSet is a set of characters stored as sorted, non-overlapping,
+// non-adjacent ranges.
+type runeSet struct {
+	ranges []runeRange
+}
+
+func newRuneSet(ranges ...runeRange) *runeSet {
+	sorted := append([]runeRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].lo < sorted[j].lo })
+	result := &runeSet{}
+	for _, r := range sorted {
+		last := len(result.ranges) - 1
+		if last >= 0 && r.lo <= result.ranges[last].hi+1 {
+			if r.hi > result.ranges[last].hi {
+				result.ranges[last].hi = r.hi
+			}
+		} else {
+			result.ranges = append(result.ranges, r)
+		}
+	}
+	return result
+}
+
+func runeSetFromTable(table *unicode.RangeTable) *runeSet {
+	var ranges []runeRange
+	for _, r := range table.R16 {
+		if r.Stride == 1 {
+			ranges = append(ranges, runeRange{rune(r.Lo), rune(r.Hi)})
+			continue
+		}
+		for c := rune(r.Lo); c <= rune(r.Hi); c += rune(r.Stride) {
+			ranges = append(ranges, runeRange{c, c})
+		}
+	}
+	for _, r := range table.R32 {
+		if r.Stride == 1 {
+			ranges = append(ranges, runeRange{rune(r.Lo), rune(r.Hi)})
+			continue
+		}
+		for c := rune(r.Lo); c <= rune(r.Hi); c += rune(r.Stride) {
+			ranges = append(ranges, runeRange{c, c})
+		}
+	}
+	return newRuneSet(ranges...)
+}
+
+func (s *runeSet) union(o *runeSet) *runeSet {
+	return newRuneSet(append(append([]runeRange(nil), s.ranges...), o.ranges...)...)
+}
+
+func (s *runeSet) complement() *runeSet {
+	result := &runeSet{}
+	next := rune(0)
+	for _, r := range s.ranges {
+		if r.lo > next {
+			result.ranges = append(result.ranges, runeRange{next, r.lo - 1})
+		}
+		next = r.hi + 1
+	}
+	if next <= unicode.MaxRune {
+		result.ranges = append(result.ranges, runeRange{next, unicode.MaxRune})
+	}
+	return result
+}
+
+func (s *runeSet) subtract(o *runeSet) *runeSet {
+	return s.complement().union(o).complement()
+}
+
+// foldClosure adds every case variant of each character in the set, so that
+// subtracting it under the i flag removes all spellings of a letter.
+func (s *runeSet) foldClosure() *runeSet {
+	var extra []runeRange
+	for _, r := range s.ranges {
+		for c := r.lo; c <= r.hi; c++ {
+			for f := unicode.SimpleFold(c); f != c; f = unicode.SimpleFold(f) {
+				extra = append(extra, runeRange{f, f})
+			}
+		}
+	}
+	return s.union(newRuneSet(extra...))
+}
+
+func writeClassRune(b *strings.Builder, r rune) {
+	if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+		b.WriteRune(r)
+	} else {
+		fmt.Fprintf(b, `\x{%x}`, r)
+	}
+}
+
+func (s *runeSet) writeClass(b *strings.Builder, negated bool) {
+	if len(s.ranges) == 0 {
+		if negated {
+			b.WriteString(`(?s:.)`)
+		} else {
+			b.WriteString(`[^\x00-\x{10ffff}]`)
+		}
+		return
+	}
+	b.WriteByte('[')
+	if negated {
+		b.WriteByte('^')
+	}
+	for _, r := range s.ranges {
+		writeClassRune(b, r.lo)
+		if r.hi != r.lo {
+			b.WriteByte('-')
+			writeClassRune(b, r.hi)
+		}
+	}
+	b.WriteByte(']')
+}
+
+// xmlNameStartChars and xmlNameChars are the characters matched by \i and \c,
+// the NameStartChar and NameChar productions of XML 1.0 (fifth edition).
+var xmlNameStartChars = newRuneSet(
+	runeRange{':', ':'}, runeRange{'A', 'Z'}, runeRange{'_', '_'}, runeRange{'a', 'z'},
+	runeRange{0xC0, 0xD6}, runeRange{0xD8, 0xF6}, runeRange{0xF8, 0x2FF},
+	runeRange{0x370, 0x37D}, runeRange{0x37F, 0x1FFF}, runeRange{0x200C, 0x200D},
+	runeRange{0x2070, 0x218F}, runeRange{0x2C00, 0x2FEF}, runeRange{0x3001, 0xD7FF},
+	runeRange{0xF900, 0xFDCF}, runeRange{0xFDF0, 0xFFFD}, runeRange{0x10000, 0xEFFFF},
+)
+
+var xmlNameChars = xmlNameStartChars.union(newRuneSet(
+	runeRange{'-', '.'}, runeRange{'0', '9'}, runeRange{0xB7, 0xB7},
+	runeRange{0x300, 0x36F}, runeRange{0x203F, 0x2040},
+))
@@ -0,0 +1,116 @@
+package jsonpath
+
+import "testing"
+
+func TestXQueryRegex(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		flag    string
+		input   string
+		matches bool
+	}{
+		{"foo", "", "afoob", true},
+		{"^foo$", "", "afoob", false},
+		{"foo", "", "FOO", false},
+		{"foo", "i", "FOO", true},
+		{"a.c", "", "a\nc", false},
+		{"a.c", "", "a\rc", false},
+		{"a.c", "s", "a\nc", true},
+		{"^b$", "", "a\nb\nc", false},
+		{"^b$", "m", "a\nb\nc", true},
+		{"a b c", "", "abc", false},
+		{"a b c", "x", "abc", true},
+		{"a[ ]b", "x", "a b", true},
+		{"a.c", "q", "abc", false},
+		{"a.c", "q", "a.c", true},
+		{"A.C", "qi", "a.c", true},
+		{"(?:ab)+", "", "abab", true},
+		{"a{2,3}", "", "aa", true},
+		{"^a{2}$", "", "aaa", false},
+
+		// Character class subtraction.
+		{"^[a-z-[aeiou]]+$", "", "bcd", true},
+		{"^[a-z-[aeiou]]+$", "", "bad", false},
+		{"^[a-z-[aeiou]]+$", "i", "BCD", true},
+		{"^[a-z-[aeiou]]+$", "i", "BAD", false},
+		{"^[\\p{L}-[a-z]]$", "", "Q", true},
+		{"^[\\p{L}-[a-z]]$", "", "q", false},
+		{"^[^a-z-[xyz]]$", "", "x", false},
+		{"^[^a-z-[xyz]]$", "", "1", true},
+		{"^[a-z-[^aeiou]]$", "", "e", true},
+		{"^[a-z-[^aeiou]]$", "", "b", false},
+		{"^[a-z-[a-z]]$", "", "a", false},
+		{"^[\\d-[5]]$", "", "4", true},
+		{"^[\\d-[5]]$", "", "5", false},
+
+		// XQuery's multi-character escapes.
+		{"^\\d$", "", "٣", true},
+		{"^\\s$", "", "\f", false},
+		{"^\\s$", "", "\r", true},
+		{"^\\w+$", "", "héllo", true},
+		{"^\\w$", "", "-", false},
+		{"^\\W$", "", "-", true},
+		{"^\\i\\c*$", "", "foo-bar.baz", true},
+		{"^\\i\\c*$", "", "-foo", false},
+		{"^\\I$", "", "1", true},
+		{"^\\C$", "", "1", false},
+		{"^[\\i-[_]]$", "", "_", false},
+		{"^\\p{Lu}$", "", "A", true},
+		{"^\\P{Lu}$", "", "A", false},
+		{"^[\\S]$", "", " ", false},
+		{"^[\\S]$", "", "x", true},
+		{"^[-a]$", "", "-", true},
+		{"^[a-]$", "", "-", true},
+		{"^\\.$", "", ".", true},
+		{"^\\.$", "", "x", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+"/"+tc.flag+"/"+tc.input, func(t *testing.T) {
+			re, err := compileXQueryRegex(tc.pattern, tc.flag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if re.MatchString(tc.input) != tc.matches {
+				t.Fatalf("expected %q (translated to %q) matching %q to be %t", tc.pattern, re.String(), tc.input, tc.matches)
+			}
+		})
+	}
+}
+
+func TestXQueryRegexErrors(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		flag    string
+		errMsg  string
+	}{
+		{"foo", "z", `unrecognized flag character "z" in like_regex predicate`},
+		{"foo", "ig", `unrecognized flag character "g" in like_regex predicate`},
+		{"(a)\\1", "", `back-references such as \1 are not supported`},
+		{"\\bfoo", "", `invalid escape sequence \b in regular expression`},
+		{"foo\\", "", `trailing \ in regular expression`},
+		{"\\p{IsBasicLatin}", "", `unicode block escape \p{IsBasicLatin} is not supported`},
+		{"\\p{Foo}", "", `unknown unicode category "Foo" in regular expression`},
+		{"\\p{L", "", `unterminated \p{ in regular expression`},
+		{"[abc", "", `unterminated character class in regular expression`},
+		{"[a[b]]", "", `unescaped [ in character class; write \[ to match it literally`},
+		{"[a-z-[aeiou]x]", "", `a character class subtraction must end its character class`},
+		{"[z-a]", "", `invalid character range z-a in regular expression`},
+		{"a{x}", "", `invalid quantifier at "{x}" in regular expression`},
+		{"a{1", "", `invalid quantifier at "{1" in regular expression`},
+		{"a}", "", `unescaped "}" in regular expression; write \} to match it literally`},
+		{"(?i)a", "", `invalid group syntax at "(?i)a" in regular expression`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+"/"+tc.flag, func(t *testing.T) {
+			_, err := compileXQueryRegex(tc.pattern, tc.flag)
+			if err == nil {
+				t.Fatalf("expected %q to error with %q, but no error occurred", tc.pattern, tc.errMsg)
+			}
+			if err.Error() != tc.errMsg {
+				t.Fatalf("expected %q to error with %q, but error was %q", tc.pattern, tc.errMsg, err.Error())
+			}
+		})
+	}
+}
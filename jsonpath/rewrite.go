@@ -0,0 +1,156 @@
+package jsonpath
+
+import "fmt"
+
+// Rewrite rebuilds the tree rooted at n from the bottom up, replacing each
+// node with what f returns for it, once the node's children have been
+// rewritten. f should return its argument to keep a node as it is. The
+// original tree is left untouched.
+//
+// It's an error for f to return nil, a node which can't take the place of
+// the one it replaces, such as a predicate in place of an expression, or a
+// like_regex predicate whose pattern doesn't compile, in which case the
+// original node is kept.
+func Rewrite(n Node, f func(Node) Node) (Node, error) {
+	r := &rewriter{f: f}
+	return r.node(n), r.err
+}
+
+type rewriter struct {
+	f   func(Node) Node
+	err error
+}
+
+func (r *rewriter) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *rewriter) mismatch(old, new Node, want string) {
+	r.fail(fmt.Errorf("cannot replace %T `%s` with %T `%s`, which is not %s", old, FormatNode(old), new, FormatNode(new), want))
+}
+
+func (r *rewriter) expr(e Expr) Expr {
+	n := r.node(e)
+	if res, ok := n.(Expr); ok {
+		return res
+	}
+	r.mismatch(e, n, "an expression")
+	return e
+}
+
+func (r *rewriter) pred(p Pred) Pred {
+	n := r.node(p)
+	if res, ok := n.(Pred); ok {
+		return res
+	}
+	r.mismatch(p, n, "a predicate")
+	return p
+}
+
+func (r *rewriter) accessor(a Accessor) Accessor {
+	n := r.node(a)
+	if res, ok := n.(Accessor); ok {
+		return res
+	}
+	r.mismatch(a, n, "an accessor")
+	return a
+}
+
+func (r *rewriter) subscript(s RangeSubscriptNode) RangeSubscriptNode {
+	n := r.node(s)
+	if res, ok := n.(RangeSubscriptNode); ok {
+		return res
+	}
+	r.mismatch(s, n, "a subscript")
+	return s
+}
+
+func (r *rewriter) node(n Node) Node {
+	switch t := n.(type) {
+	case Program:
+		t.Root = r.expr(t.Root)
+		n = t
+	case BinExpr:
+		t.Left, t.Right = r.expr(t.Left), r.expr(t.Right)
+		n = t
+	case BinPred:
+		t.Left, t.Right = r.expr(t.Left), r.expr(t.Right)
+		n = t
+	case BinLogic:
+		t.Left, t.Right = r.pred(t.Left), r.pred(t.Right)
+		n = t
+	case UnaryExpr:
+		t.Expr = r.expr(t.Expr)
+		n = t
+	case UnaryNot:
+		t.Pred = r.pred(t.Pred)
+		n = t
+	case ParenExpr:
+		t.Expr = r.expr(t.Expr)
+		n = t
+	case ParenPred:
+		t.Pred = r.pred(t.Pred)
+		n = t
+	case AccessExpr:
+		t.Left, t.Right = r.expr(t.Left), r.accessor(t.Right)
+		n = t
+	case ArrayAccessor:
+		subscripts := make([]RangeSubscriptNode, len(t.Subscripts))
+		for i, s := range t.Subscripts {
+			subscripts[i] = r.subscript(s)
+		}
+		t.Subscripts = subscripts
+		n = t
+	case RangeSubscriptNode:
+		t.Start = r.expr(t.Start)
+		if t.End != nil {
+			t.End = r.expr(t.End)
+		}
+		n = t
+	case FuncNode:
+		if t.Args != nil {
+			args := make([]Node, len(t.Args))
+			for i, a := range t.Args {
+				args[i] = r.node(a)
+			}
+			t.Args = args
+		}
+		n = t
+	case FilterNode:
+		t.Pred = r.pred(t.Pred)
+		n = t
+	case ExistsNode:
+		t.Expr = r.expr(t.Expr)
+		n = t
+	case LikeRegexNode:
+		t.Left = r.expr(t.Left)
+		n = t
+	case StartsWithNode:
+		t.Left, t.Right = r.expr(t.Left), r.expr(t.Right)
+		n = t
+	case IsUnknownNode:
+		t.Pred = r.pred(t.Pred)
+		n = t
+	}
+	res := r.f(n)
+	if res == nil {
+		r.fail(fmt.Errorf("cannot replace %T `%s` with nil", n, FormatNode(n)))
+		return n
+	}
+	// What a like_regex pattern or a .datetime() template was compiled from
+	// may have changed, so it's compiled again.
+	switch t := res.(type) {
+	case LikeRegexNode:
+		like, err := NewLikeRegexNode(t.Left, t.Pattern, t.Flag)
+		if err != nil {
+			r.fail(err)
+			return n
+		}
+		res = like
+	case FuncNode:
+		res = NewFuncNode(t.Func, t.Args...)
+	}
+	return res
+}
@@ -0,0 +1,224 @@
+package jsonpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	renameField := func(n Node) Node {
+		if d, ok := n.(DotAccessor); ok && d.Name == "customer_id" {
+			return NewDotAccessor("customer.id")
+		}
+		return n
+	}
+	tenantFilter := func(n Node) Node {
+		if v, ok := n.(VariableExpr); ok && v.Name == "$" {
+			tenant := NewBinPred(EqBinOp, NewAccessExpr(NewVariableExpr("@"), NewDotAccessor("tenant")), NewVariableExpr("$tenant"))
+			return NewAccessExpr(v, NewFilterNode(tenant))
+		}
+		return n
+	}
+	doubleNumbers := func(n Node) Node {
+		if num, ok := n.(NumberExpr); ok {
+			return NewBinExpr(TimesBinOp, num, NewIntExpr(2))
+		}
+		return n
+	}
+	negateComparisons := func(n Node) Node {
+		if p, ok := n.(BinPred); ok {
+			return NewUnaryNot(p)
+		}
+		return n
+	}
+	likeB := func(n Node) Node {
+		if l, ok := n.(LikeRegexNode); ok {
+			l.Pattern = "^b"
+			return l
+		}
+		return n
+	}
+	badRegex := func(n Node) Node {
+		if l, ok := n.(LikeRegexNode); ok {
+			l.Pattern = "("
+			return l
+		}
+		return n
+	}
+	deleteFilters := func(n Node) Node {
+		if _, ok := n.(FilterNode); ok {
+			return nil
+		}
+		return n
+	}
+	predForExpr := func(n Node) Node {
+		if _, ok := n.(StringExpr); ok {
+			return NewExistsNode(NewVariableExpr("@"))
+		}
+		return n
+	}
+
+	testCases := []struct {
+		input    string
+		f        func(Node) Node
+		expected string
+		errMsg   string
+	}{
+		{"lax $.orders[*].customer_id", renameField, "lax $.orders[*].\"customer.id\"", ""},
+		{"lax $.a ? (@.customer_id == $.customer_id)", renameField, "lax $.a?(@.\"customer.id\" == $.\"customer.id\")", ""},
+		{"strict $.orders[*].total", tenantFilter, "strict $?(@.tenant == $tenant).orders[*].total", ""},
+		{"lax $[1 to 2, 3].decimal(4)", doubleNumbers, "lax $[1 * 2 to 2 * 2, 3 * 2].decimal(4 * 2)", ""},
+		{"lax $ ? (@ > 1 && @.a == 2)", negateComparisons, "lax $?(!(@ > 1) && !(@.a == 2))", ""},
+		{"lax $[*] ? (@ like_regex \"^a\")", likeB, "lax $[*]?(@ like_regex \"^b\")", ""},
+		{"lax $[*] ? (@ like_regex \"^a\")", badRegex, "lax $[*]?(@ like_regex \"^a\")", "error parsing regexp: missing closing ): `(`"},
+		{"lax $[*] ? (@ > 1)", deleteFilters, "lax $[*]?(@ > 1)", "cannot replace jsonpath.FilterNode `?(@ > 1)` with nil"},
+		{"lax $ ? (@ starts with \"a\")", predForExpr, "lax $?(@ starts with \"a\")", "cannot replace jsonpath.StringExpr `\"a\"` with jsonpath.ExistsNode `exists (@)`, which is not an expression"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			p, err := Parse(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := FormatNode(p)
+			res, err := Rewrite(p, tc.f)
+			if tc.errMsg != "" {
+				if err == nil || err.Error() != tc.errMsg {
+					t.Fatalf("expected error %q, got %v", tc.errMsg, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if FormatNode(res) != tc.expected {
+				t.Errorf("expected `%s`, got `%s`", tc.expected, FormatNode(res))
+			}
+			if FormatNode(p) != before {
+				t.Errorf("expected the original to be left as `%s`, but it became `%s`", before, FormatNode(p))
+			}
+		})
+	}
+}
+
+func TestRewriteRecompiles(t *testing.T) {
+	p, err := Parse(`lax $[*] ? (@ like_regex "^a")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Rewrite(p, func(n Node) Node {
+		if l, ok := n.(LikeRegexNode); ok {
+			l.Pattern = "^b"
+			return l
+		}
+		return n
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched, err := NewNaiveEvalerForProgram(res.(Program)).Run([]interface{}{"abc", "bcd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(matched, jsonSequence{"bcd"}) {
+		t.Errorf("expected the new pattern to match only \"bcd\", got %v", matched)
+	}
+
+	p, err = Parse(`lax $.datetime("YYYY").type()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = Rewrite(p, func(n Node) Node {
+		if f, ok := n.(FuncNode); ok && f.Func == DatetimeFunction {
+			f.Args = []Node{NewStringExpr("HH24")}
+			return f
+		}
+		return n
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, err := NewNaiveEvalerForProgram(res.(Program)).Run("12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(typ, jsonSequence{"time without time zone"}) {
+		t.Errorf("expected the new template to parse a time, got %v", typ)
+	}
+}
+
+func TestRewriteValidate(t *testing.T) {
+	p, err := Parse("lax $.a[last]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Moving `last` out of its subscript makes the tree invalid.
+	res, err := Rewrite(p, func(n Node) Node {
+		if a, ok := n.(AccessExpr); ok {
+			if sub, ok := a.Right.(ArrayAccessor); ok {
+				return NewBinExpr(PlusBinOp, a.Left, sub.Subscripts[0].Start)
+			}
+		}
+		return n
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := Validate(res)
+	if len(errs) != 1 || errs[0].Error() != "`last` can only appear inside an array subscript" {
+		t.Fatalf("expected `%s` to be invalid, got %v", FormatNode(res), errs)
+	}
+
+	testCases := []struct {
+		node   Node
+		errMsg string
+	}{
+		{NewFuncNode(DecimalFunction, NewBinExpr(TimesBinOp, NewIntExpr(4), NewIntExpr(2))), "arguments of .decimal() must be number literals, but found `4 * 2`"},
+		{NewFuncNode(DatetimeFunction, NewIntExpr(1)), "arguments of .datetime() must be string literals, but found `1`"},
+		{NewFuncNode(TimeFunction, NewIntExpr(1), NewIntExpr(2)), "too many arguments for .time(): at most 1, but got 2"},
+		{NewFuncNode(SizeFunction, NewIntExpr(1)), "too many arguments for .size(): at most 0, but got 1"},
+		{NewFuncNode(DateFunction, NewIntExpr(1)), "too many arguments for .date(): at most 0, but got 1"},
+		{DotAccessor{Name: "a b"}, "member name \"a b\" must be quoted"},
+		{NewArrayAccessor(), "an array subscript needs at least one index"},
+		{NewArrayAccessor(NewSubscript(NewIntExpr(-1))), "a number literal can only be negative as an argument of an item method, but found -1"},
+		{NewArrayAccessor(NewSubscript(NewVariableExpr("x"))), "invalid variable name \"x\""},
+		{NewRecursiveWildcardAccessor(-2, 1), "recursive wildcard level must be a non-negative integer, but found -2"},
+		{NewArrayAccessor(RangeSubscriptNode{End: NewIntExpr(1)}), "RangeSubscriptNode is missing its Start"},
+		{NewFilterNode(NewBinPred(EqBinOp, NewVariableExpr("@"), nil)), "BinPred is missing its Right"},
+		{NewFuncNode(DecimalFunction, NewIntExpr(5), nil), "FuncNode is missing its argument 2"},
+	}
+	for _, tc := range testCases {
+		errs := Validate(NewAccessExpr(NewVariableExpr("$"), tc.node.(Accessor)))
+		if len(errs) != 1 || errs[0].Error() != tc.errMsg {
+			t.Errorf("expected %q, got %v", tc.errMsg, errs)
+		}
+	}
+	if errs := Validate(NewProgram(ModeLax, BinExpr{})); len(errs) != 1 || errs[0].Error() != "BinExpr is missing its Left" {
+		t.Errorf("expected an error for the missing operand, got %v", errs)
+	}
+	// An argument which failed to parse has been reported already.
+	if errs := Validate(NewAccessExpr(NewVariableExpr("$"), NewFuncNode(DatetimeFunction, BadNode{}))); len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	p, err := Parse("lax $.a ? (@.b == 1 && exists (@.c)).d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	Inspect(p, func(n Node) bool {
+		if d, ok := n.(DotAccessor); ok {
+			names = append(names, d.Name)
+		}
+		// Don't look inside exists.
+		_, ok := n.(ExistsNode)
+		return !ok
+	})
+	if expected := []string{"a", "b", "d"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	if vars := Variables(p); len(vars) != 0 {
+		t.Fatalf("expected no variables, got %v", vars)
+	}
+}
@@ -0,0 +1,105 @@
+package jsonpath
+
+import (
+	"sort"
+	"strings"
+)
+
+// keywordPhrases are the keywords which only make sense in pairs, so that
+// something like `startswith` can be matched against what was meant.
+var keywordPhrases = []string{"starts with", "is unknown"}
+
+// functionAliases maps the names other JSONPath dialects give item methods
+// to the names they have here, where spelling alone won't get there.
+var functionAliases = map[string]string{
+	"length": "size",
+	"count":  "size",
+	"float":  "double",
+}
+
+var keywordCandidates, functionCandidates []string
+
+func init() {
+	for k := range keywords {
+		keywordCandidates = append(keywordCandidates, k)
+	}
+	keywordCandidates = append(keywordCandidates, keywordPhrases...)
+	sort.Strings(keywordCandidates)
+	for k := range funcs {
+		functionCandidates = append(functionCandidates, k)
+	}
+	sort.Strings(functionCandidates)
+}
+
+// keywordHint suggests the keyword that an unrecognized one was probably
+// meant to be.
+func keywordHint(word string) string {
+	if s, ok := suggest(word, keywordCandidates); ok {
+		return "did you mean \"" + s + "\"?"
+	}
+	return ""
+}
+
+// functionHint suggests the item method that an invalid one was probably
+// meant to be.
+func functionHint(name string) string {
+	s, ok := functionAliases[strings.ToLower(name)]
+	if !ok {
+		s, ok = suggest(name, functionCandidates)
+	}
+	if ok {
+		return "did you mean ." + s + "()?"
+	}
+	return ""
+}
+
+// suggest returns the candidate closest to word, if any is close enough to
+// be a likely misspelling: within a third of its length in edits, or
+// beginning with word, as `ceil` does `ceiling`. Ties go to the candidate
+// which sorts first.
+func suggest(word string, candidates []string) (string, bool) {
+	word = strings.ToLower(word)
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		d := editDistance(word, c)
+		limit := len(c) / 3
+		if limit < 1 {
+			limit = 1
+		}
+		if d > limit && !(len(word) >= 3 && strings.HasPrefix(c, word)) {
+			continue
+		}
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best, bestDist >= 0
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(t)]
+}
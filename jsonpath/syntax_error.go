@@ -0,0 +1,153 @@
+package jsonpath
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// SyntaxError is returned by Parse for input which isn't a jsonpath. Its
+// Error method renders the offending line of the input with a marker under
+// the problem, followed by a hint if there is one:
+//
+//	syntax error at line 1, column 5: unrecognized keyword "exist"
+//	lax exist (1)
+//	    ^~~~~
+//	hint: did you mean "exists"?
+type SyntaxError struct {
+	Msg string
+	// Line and Column are 1-based, and Column counts characters rather than
+	// bytes.
+	Line   int
+	Column int
+	// Offset and End are the byte span of the problem within Input.
+	Offset int
+	End    int
+	// Token is the text of the offending token, which is empty at the end
+	// of the input.
+	Token string
+	// Expected lists the tokens which could have come instead, when there
+	// are few enough of them to be helpful.
+	Expected []string
+	// Hint suggests a fix, such as the keyword which was probably meant, and
+	// is empty when there's nothing more to say than Msg.
+	Hint  string
+	Input string
+}
+
+func newSyntaxError(input []rune, msg string, begin, end int, expected []string) *SyntaxError {
+	if begin > len(input) {
+		begin = len(input)
+	}
+	if end > len(input) {
+		end = len(input)
+	}
+	if end < begin {
+		end = begin
+	}
+	line, lineStart := 1, 0
+	for i, r := range input[:begin] {
+		if r == '\n' {
+			line++
+			lineStart = i + 1
+		}
+	}
+	offset := len(string(input[:begin]))
+	return &SyntaxError{
+		Msg:      msg,
+		Line:     line,
+		Column:   begin - lineStart + 1,
+		Offset:   offset,
+		End:      offset + len(string(input[begin:end])),
+		Token:    string(input[begin:end]),
+		Expected: expected,
+		Input:    string(input),
+	}
+}
+
+func (e *SyntaxError) Error() string {
+	s := fmt.Sprintf("syntax error at line %d, column %d: %s\n%s", e.Line, e.Column, e.Msg, e.Snippet())
+	if e.Hint != "" {
+		s += "\nhint: " + e.Hint
+	}
+	return s
+}
+
+// Snippet returns the line of the input containing the error, and below it
+// a caret under the start of the problem followed by tildes under the rest.
+func (e *SyntaxError) Snippet() string {
+	lineStart := strings.LastIndexByte(e.Input[:e.Offset], '\n') + 1
+	lineEnd := len(e.Input)
+	if i := strings.IndexByte(e.Input[e.Offset:], '\n'); i >= 0 {
+		lineEnd = e.Offset + i
+	}
+	var b strings.Builder
+	b.WriteString(e.Input[lineStart:lineEnd])
+	b.WriteByte('\n')
+	// Copy tabs so the marker lines up however the line is displayed.
+	for _, r := range e.Input[lineStart:e.Offset] {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	end := e.End
+	if end > lineEnd {
+		end = lineEnd
+	}
+	if n := utf8.RuneCountInString(e.Input[e.Offset:end]); n > 1 {
+		b.WriteString(strings.Repeat("~", n-1))
+	}
+	return b.String()
+}
+
+// parseParserError takes apart one of goyacc's verbose messages, such as
+// "syntax error: unexpected NUMBER, expecting ')' or ','", into a message in
+// terms of jsonpath's tokens and the list of expected tokens.
+func parseParserError(e string) (string, []string) {
+	e = strings.TrimPrefix(e, "syntax error: ")
+	var expected []string
+	if i := strings.Index(e, ", expecting "); i >= 0 {
+		for _, tok := range strings.Split(e[i+len(", expecting "):], " or ") {
+			expected = append(expected, tokenDisplayName(tok))
+		}
+		e = e[:i]
+	}
+	if strings.HasPrefix(e, "unexpected ") {
+		e = "unexpected " + tokenDisplayName(strings.TrimPrefix(e, "unexpected "))
+	}
+	if len(expected) > 0 {
+		e += ", expecting " + strings.Join(expected, " or ")
+	}
+	return e, expected
+}
+
+var tokenDisplayNames = map[string]string{
+	"$end":   "end of input",
+	"$unk":   "unknown token",
+	"NUMBER": "number",
+	"STR":    "string",
+	"IDENT":  "identifier",
+	"EQ":     "'=='",
+	"NEQ":    "'!='",
+	"LTE":    "'<='",
+	"GTE":    "'>='",
+	"AND":    "'&&'",
+	"OR":     "'||'",
+	"UNOT":   "'!'",
+	"ANY":    "'**'",
+}
+
+// tokenDisplayName turns the name goyacc gives a token into how it's
+// written in a jsonpath.
+func tokenDisplayName(tok string) string {
+	if name, ok := tokenDisplayNames[tok]; ok {
+		return name
+	}
+	if strings.HasPrefix(tok, "'") {
+		return tok
+	}
+	return "'" + strings.ToLower(strings.TrimPrefix(tok, "FUNC_")) + "'"
+}
@@ -0,0 +1,72 @@
+package jsonpath
+
+import (
+	"archive/zip"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// zoneinfo.zip is a copy of $GOROOT/lib/time/zoneinfo.zip, currently tz
+// 2026c from Go 1.27.1; run go generate to refresh it. Time zones are always
+// loaded from it, never from the host, so that evaluation gives the same
+// results everywhere. The time/tzdata package can't be used for this, since
+// time.LoadLocation only falls back to it when the host has no database.
+//
+//go:generate sh -c "cp \"$(go env GOROOT)/lib/time/zoneinfo.zip\" zoneinfo.zip && chmod 644 zoneinfo.zip"
+//go:embed zoneinfo.zip
+var zoneinfoZip []byte
+
+var (
+	zoneinfoOnce  sync.Once
+	zoneinfoFiles map[string]*zip.File
+	zoneinfoErr   error
+	locations     sync.Map
+)
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "UTC" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	zoneinfoOnce.Do(func() {
+		r, err := zip.NewReader(bytes.NewReader(zoneinfoZip), int64(len(zoneinfoZip)))
+		if err != nil {
+			zoneinfoErr = err
+			return
+		}
+		zoneinfoFiles = make(map[string]*zip.File, len(r.File))
+		for _, f := range r.File {
+			zoneinfoFiles[f.Name] = f
+		}
+	})
+	if zoneinfoErr != nil {
+		return nil, zoneinfoErr
+	}
+
+	f, ok := zoneinfoFiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocationFromTZData(name, data)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
@@ -0,0 +1,390 @@
+package jsonpath
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Kinds is a set of the kinds of value a path can return.
+type Kinds uint8
+
+const (
+	NullKind     Kinds = 1 << nullValue
+	BooleanKind  Kinds = 1 << booleanValue
+	NumberKind   Kinds = 1 << numberValue
+	StringKind   Kinds = 1 << stringValue
+	DatetimeKind Kinds = 1 << datetimeValue
+	ArrayKind    Kinds = 1 << arrayValue
+	ObjectKind   Kinds = 1 << objectValue
+
+	AnyKind = NullKind | BooleanKind | NumberKind | StringKind | DatetimeKind | ArrayKind | ObjectKind
+)
+
+// String returns the names of the kinds in k, such as "number or string".
+func (k Kinds) String() string {
+	if k == AnyKind {
+		return "any"
+	}
+	var names []string
+	for v := nullValue; v <= objectValue; v++ {
+		if k&(1<<v) != 0 {
+			names = append(names, valueKindNames[v])
+		}
+	}
+	if len(names) == 0 {
+		return "nothing"
+	}
+	return strings.Join(names, " or ")
+}
+
+// Cardinality is how many values a path can return.
+type Cardinality int
+
+const (
+	ExactlyOne Cardinality = iota
+	AtMostOne
+	Many
+)
+
+var cardinalityNames = [...]string{ExactlyOne: "exactly one", AtMostOne: "at most one", Many: "many"}
+
+func (c Cardinality) String() string { return cardinalityNames[c] }
+
+// ResultType is what a path can return, if it doesn't raise an error.
+type ResultType struct {
+	Kinds       Kinds
+	Cardinality Cardinality
+}
+
+func (t ResultType) String() string {
+	return t.Kinds.String() + ", " + t.Cardinality.String()
+}
+
+// TypeOptions describe the values a path will be evaluated with.
+type TypeOptions struct {
+	// Root is the kinds `$` can be. Its zero value means any.
+	Root Kinds
+	// Vars maps the name of each named variable, without its leading `$`, to
+	// the kinds it can be. Variables it doesn't mention can be anything.
+	Vars map[string]Kinds
+}
+
+// TypeOf returns what p can return when evaluated against any value.
+func TypeOf(p Program) ResultType {
+	return TypeOfWithOptions(p, TypeOptions{})
+}
+
+// TypeOfWithOptions returns what p can return when evaluated with values
+// described by opts. In lax mode, a path which accesses a value which might
+// be an array can return many values, since the array is unwrapped, so
+// `lax $.a` returns at most one value only if `$` can't be an array.
+func TypeOfWithOptions(p Program, opts TypeOptions) ResultType {
+	t := newTyper(p.Mode, opts)
+	v := t.expr(p.Root)
+	res := ResultType{Kinds: v.kinds, Cardinality: Many}
+	switch {
+	case v.min == 1 && v.max == 1:
+		res.Cardinality = ExactlyOne
+	case v.max <= 1:
+		res.Cardinality = AtMostOne
+	}
+	return res
+}
+
+// typeCheck returns the expressions of p which can only raise an error when
+// they're evaluated, such as `"a".ceiling()`, or `$[*] ? (1 == 2) + 1`. Those
+// within a filter's predicate aren't included, since there an error only
+// makes the predicate unknown, and nor are those in the subscripts of a value
+// which might be empty, since then they aren't evaluated.
+func typeCheck(p Program) []error {
+	t := newTyper(p.Mode, TypeOptions{})
+	t.expr(p.Root)
+	return t.errs
+}
+
+// unbounded is the most values of a valueType which can return any number.
+const unbounded = math.MaxInt32
+
+// valueType is the kinds of value an expression can return, and the least and
+// most values it can return.
+type valueType struct {
+	kinds    Kinds
+	min, max int
+}
+
+func one(k Kinds) valueType {
+	return valueType{kinds: k, min: 1, max: 1}
+}
+
+func mulBound(a, b int) int {
+	switch {
+	case a == 0 || b == 0:
+		return 0
+	case a >= unbounded/b:
+		return unbounded
+	}
+	return a * b
+}
+
+func addBound(a, b int) int {
+	if a >= unbounded-b {
+		return unbounded
+	}
+	return a + b
+}
+
+// methodTypes gives the kinds of value each item method can be applied to
+// and returns, and whether it unwraps arrays in lax mode.
+var methodTypes = map[Function]struct {
+	accepts, returns Kinds
+	unwraps          bool
+}{
+	TypeFunction:        {AnyKind, StringKind, false},
+	SizeFunction:        {AnyKind, NumberKind, false},
+	DoubleFunction:      {NumberKind | StringKind, NumberKind, true},
+	CeilingFunction:     {NumberKind, NumberKind, false},
+	FloorFunction:       {NumberKind, NumberKind, true},
+	AbsFunction:         {NumberKind, NumberKind, false},
+	DatetimeFunction:    {StringKind, DatetimeKind, true},
+	KeyvalueFunction:    {ObjectKind, ObjectKind, true},
+	BigintFunction:      {NumberKind | StringKind, NumberKind, true},
+	IntegerFunction:     {NumberKind | StringKind, NumberKind, true},
+	NumberFunction:      {NumberKind | StringKind, NumberKind, true},
+	DecimalFunction:     {NumberKind | StringKind, NumberKind, true},
+	StringFunction:      {BooleanKind | NumberKind | StringKind | DatetimeKind, StringKind, true},
+	BooleanFunction:     {BooleanKind | NumberKind | StringKind, BooleanKind, true},
+	DateFunction:        {StringKind | DatetimeKind, DatetimeKind, true},
+	TimeFunction:        {StringKind | DatetimeKind, DatetimeKind, true},
+	TimeTZFunction:      {StringKind | DatetimeKind, DatetimeKind, true},
+	TimestampFunction:   {StringKind | DatetimeKind, DatetimeKind, true},
+	TimestampTZFunction: {StringKind | DatetimeKind, DatetimeKind, true},
+}
+
+// typer works out the valueTypes of expressions, following the evaluator,
+// and notes those which can only raise an error.
+type typer struct {
+	mode Mode
+	opts TypeOptions
+	// atSigns is the kinds of the items of each enclosing filter.
+	atSigns []Kinds
+	// lenient is set for the accessors which follow a `.**`, which don't
+	// raise structural errors in strict mode.
+	lenient bool
+	// quiet counts the filters' predicates being typed, where an error only
+	// makes the predicate unknown, and the subscripts which might not be
+	// evaluated. No errors are reported within them.
+	quiet int
+	errs  []error
+}
+
+func newTyper(mode Mode, opts TypeOptions) *typer {
+	if opts.Root == 0 {
+		opts.Root = AnyKind
+	}
+	return &typer{mode: mode, opts: opts}
+}
+
+func (t *typer) errorf(format string, args ...interface{}) {
+	if t.quiet > 0 {
+		return
+	}
+	t.errs = append(t.errs, fmt.Errorf(format, args...))
+}
+
+// unwraps reports whether v's arrays are unwrapped by the accessors which
+// unwrap them in lax mode.
+func (t *typer) unwraps(v valueType) bool {
+	return t.mode == ModeLax && v.kinds&ArrayKind != 0
+}
+
+func (t *typer) expr(e Expr) valueType {
+	switch n := e.(type) {
+	case NumberExpr:
+		return one(NumberKind)
+	case StringExpr:
+		return one(StringKind)
+	case BoolExpr:
+		return one(BooleanKind)
+	case NullExpr:
+		return one(NullKind)
+	case ParenExpr:
+		return t.expr(n.Expr)
+	case LastExpr:
+		return one(NumberKind)
+	case VariableExpr:
+		switch n.Name {
+		case "$":
+			return one(t.opts.Root)
+		case "@":
+			if len(t.atSigns) > 0 {
+				return one(t.atSigns[len(t.atSigns)-1])
+			}
+			return one(AnyKind)
+		}
+		if k, ok := t.opts.Vars[n.Name[1:]]; ok {
+			return one(k)
+		}
+		return one(AnyKind)
+	case BinExpr:
+		for _, operand := range []Expr{n.Left, n.Right} {
+			v := t.expr(operand)
+			if v.min > 1 || v.max == 0 {
+				t.errorf("binary operators can only operate on single values, but `%s` is never one", FormatNode(operand))
+			} else if v.kinds&NumberKind == 0 {
+				t.errorf("binary operators can only operate on numbers, but `%s` is of type %s", FormatNode(operand), v.kinds)
+			}
+		}
+		return one(NumberKind)
+	case UnaryExpr:
+		v := t.expr(n.Expr)
+		if v.min > 0 && v.kinds&NumberKind == 0 && !t.unwraps(v) {
+			name := "minus"
+			if n.Op == UPlus {
+				name = "plus"
+			}
+			t.errorf("unary %s can only accept numbers, but `%s` is of type %s", name, FormatNode(n.Expr), v.kinds)
+		}
+		if t.unwraps(v) {
+			return valueType{kinds: NumberKind, max: unbounded}
+		}
+		return valueType{kinds: NumberKind, min: v.min, max: v.max}
+	case AccessExpr:
+		v := t.expr(n.Left)
+		if t.mode == ModeStrict && !t.lenient && followsRecursiveWildcard(n.Left) {
+			t.lenient = true
+			defer func() { t.lenient = false }()
+		}
+		item := t.access(n.Right, n.Left, v)
+		return valueType{kinds: item.kinds, min: mulBound(v.min, item.min), max: mulBound(v.max, item.max)}
+	}
+	return valueType{kinds: AnyKind, max: unbounded}
+}
+
+// access returns the valueType of what a returns for each value of left,
+// whose valueType is in.
+func (t *typer) access(a Accessor, left Expr, in valueType) valueType {
+	// strict is whether a raises an error rather than return nothing.
+	strict := t.mode == ModeStrict && !t.lenient
+	switch n := a.(type) {
+	case DotAccessor:
+		switch {
+		case strict:
+			return one(AnyKind)
+		case t.unwraps(in):
+			return valueType{kinds: AnyKind, max: unbounded}
+		case in.kinds&ObjectKind != 0:
+			return valueType{kinds: AnyKind, max: 1}
+		}
+		return valueType{kinds: AnyKind}
+	case MemberWildcardAccessor:
+		if in.kinds&ObjectKind != 0 || t.unwraps(in) {
+			return valueType{kinds: AnyKind, max: unbounded}
+		}
+		return valueType{kinds: AnyKind}
+	case ArrayAccessor:
+		// The subscripts are evaluated for each array, or each item in lax
+		// mode, so not at all if there are none. Following a `.**` in strict
+		// mode, items which aren't arrays are skipped.
+		if in.min == 0 || t.mode == ModeStrict && t.lenient && in.kinds != ArrayKind {
+			t.quiet++
+			defer func() { t.quiet-- }()
+		}
+		var res valueType
+		for _, s := range n.Subscripts {
+			sub := t.subscript(s, strict)
+			res.min, res.max = addBound(res.min, sub.min), addBound(res.max, sub.max)
+		}
+		res.kinds = AnyKind
+		return res
+	case WildcardArrayAccessor:
+		if in.kinds&ArrayKind != 0 {
+			return valueType{kinds: AnyKind, max: unbounded}
+		}
+		return one(in.kinds)
+	case RecursiveWildcardAccessor:
+		res := valueType{kinds: AnyKind, max: unbounded}
+		if n.First == 0 {
+			res.min = 1
+		}
+		if in.kinds&(ArrayKind|ObjectKind) == 0 {
+			res.kinds, res.max = in.kinds, res.min
+		}
+		return res
+	case FuncNode:
+		m := methodTypes[n.Func]
+		unwraps := m.unwraps && t.unwraps(in)
+		if in.min > 0 && in.kinds&m.accepts == 0 && !unwraps {
+			t.errorf(".%s() is only defined on type %s, but `%s` is of type %s", functionNames[n.Func], m.accepts, FormatNode(left), in.kinds)
+		}
+		if unwraps || n.Func == KeyvalueFunction {
+			return valueType{kinds: m.returns, max: unbounded}
+		}
+		return one(m.returns)
+	case FilterNode:
+		t.atSigns = append(t.atSigns, in.kinds)
+		t.quiet++
+		t.pred(n.Pred)
+		t.quiet--
+		t.atSigns = t.atSigns[:len(t.atSigns)-1]
+		o := optimizer{ctx: &naiveEvalContext{mode: t.mode}}
+		if v, ok := o.truth(n.Pred); ok {
+			if v == sqlJsonTrue {
+				return one(in.kinds)
+			}
+			return valueType{kinds: in.kinds}
+		}
+		return valueType{kinds: in.kinds, max: 1}
+	}
+	return valueType{kinds: AnyKind, max: unbounded}
+}
+
+// subscript returns the valueType of the elements s selects from an array.
+func (t *typer) subscript(s RangeSubscriptNode, strict bool) valueType {
+	t.expr(s.Start)
+	if s.End == nil {
+		if strict {
+			return one(AnyKind)
+		}
+		return valueType{kinds: AnyKind, max: 1}
+	}
+	t.expr(s.End)
+	start, ok1 := s.Start.(NumberExpr)
+	end, ok2 := s.End.(NumberExpr)
+	if ok1 && ok2 {
+		i, ok1 := start.val.trunc().int64()
+		j, ok2 := end.val.trunc().int64()
+		if ok1 && ok2 && i <= j && j-i < unbounded {
+			res := valueType{kinds: AnyKind, max: int(j - i + 1)}
+			if strict {
+				res.min = res.max
+			}
+			return res
+		}
+	}
+	return valueType{kinds: AnyKind, max: unbounded}
+}
+
+func (t *typer) pred(p Pred) {
+	switch n := p.(type) {
+	case BinPred:
+		t.expr(n.Left)
+		t.expr(n.Right)
+	case BinLogic:
+		t.pred(n.Left)
+		t.pred(n.Right)
+	case UnaryNot:
+		t.pred(n.Pred)
+	case ParenPred:
+		t.pred(n.Pred)
+	case IsUnknownNode:
+		t.pred(n.Pred)
+	case ExistsNode:
+		t.expr(n.Expr)
+	case LikeRegexNode:
+		t.expr(n.Left)
+	case StartsWithNode:
+		t.expr(n.Left)
+		t.expr(n.Right)
+	}
+}
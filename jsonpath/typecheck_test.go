@@ -0,0 +1,151 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestTypeOf(t *testing.T) {
+	testCases := []struct {
+		input    string
+		opts     TypeOptions
+		expected string
+	}{
+		{"lax 1 + 2", TypeOptions{}, "number, exactly one"},
+		{"lax $.*", TypeOptions{}, "any, many"},
+		{"lax $.a.size()", TypeOptions{Root: ObjectKind}, "number, at most one"},
+		{"lax $.a.size()", TypeOptions{}, "number, many"},
+		{"strict $.a.size()", TypeOptions{}, "number, exactly one"},
+		{"strict $.**.a.size()", TypeOptions{}, "number, many"},
+		{"lax $.type()", TypeOptions{}, "string, exactly one"},
+		{"lax $[0]", TypeOptions{}, "any, at most one"},
+		{"strict $[0, 1]", TypeOptions{}, "any, many"},
+		{"lax $ ? (@ > 1)", TypeOptions{}, "any, at most one"},
+		{"lax $ ? (1 > 2)", TypeOptions{}, "any, at most one"},
+		{"lax $[*]", TypeOptions{Root: StringKind | NullKind}, "null or string, exactly one"},
+		{"lax $.datetime()", TypeOptions{}, "datetime, many"},
+		{"strict $.datetime()", TypeOptions{}, "datetime, exactly one"},
+		{"lax $x", TypeOptions{Vars: map[string]Kinds{"x": NumberKind | StringKind}}, "number or string, exactly one"},
+		{"lax $x.keyvalue()", TypeOptions{Vars: map[string]Kinds{"x": ObjectKind}}, "object, many"},
+		{"lax -$", TypeOptions{}, "number, many"},
+		{"strict -$", TypeOptions{}, "number, exactly one"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			p, err := Parse(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := TypeOfWithOptions(p, tc.opts).String(); res != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestTypeCheck(t *testing.T) {
+	testCases := []struct {
+		input  string
+		errMsg string
+	}{
+		{"lax \"a\".ceiling()", ".ceiling() is only defined on type number, but `\"a\"` is of type string"},
+		{"lax $.type().abs()", ".abs() is only defined on type number, but `$.type()` is of type string"},
+		{"lax 1 .datetime()", ".datetime() is only defined on type string, but `1` is of type number"},
+		{"lax $.size().keyvalue()", ".keyvalue() is only defined on type object, but `$.size()` is of type number"},
+		{"lax $ ? (1 == 2) + 1", "binary operators can only operate on single values, but `$?(1 == 2)` is never one"},
+		{"strict $[0, 1] * 2", "binary operators can only operate on single values, but `$[0, 1]` is never one"},
+		{"strict 1 + $[0 to 2]", "binary operators can only operate on single values, but `$[0 to 2]` is never one"},
+		{"lax true + 1", "binary operators can only operate on numbers, but `true` is of type boolean"},
+		{"lax $[$.type() - 1]", "binary operators can only operate on numbers, but `$.type()` is of type string"},
+		{"lax -\"a\"", "unary minus can only accept numbers, but `\"a\"` is of type string"},
+		{"strict +$.datetime()", "unary plus can only accept numbers, but `$.datetime()` is of type datetime"},
+
+		// These only fail for some values.
+		{"lax $.a + 1", ""},
+		{"lax $[*] + 1", ""},
+		{"lax $[0 to 1] + 1", ""},
+		{"strict $.** + 1", ""},
+		{"lax $.a.ceiling()", ""},
+		{"lax $.keyvalue().ceiling()", ""},
+		{"lax -$.datetime()", ""},
+		{"lax $.type().size()", ""},
+		{"lax $ ? (1 == 1) + 1", ""},
+
+		// Subscripts aren't evaluated if there's nothing to subscript.
+		{"lax $.a[$.type() - 1]", ""},
+		{"lax $.a[true + 1]", ""},
+		{"lax $.a.**.b ? (@ > 1)[-\"a\"]", ""},
+		{"strict $.**[\"a\".ceiling()]", ""},
+		{"lax $[*][true + 1]", ""},
+
+		// Within a predicate, an error only makes it unknown.
+		{"lax $ ? (@.type().floor() > 1)", ""},
+		{"lax $ ? (@ + \"a\" > 1)", ""},
+		{"lax $ ? ((\"a\".ceiling() == 1) is unknown)", ""},
+		{"lax $ ? (exists (\"a\".ceiling()))", ""},
+		{"lax $ ? (@[\"a\".ceiling()] == 1)", ""},
+	}
+
+	docs := []interface{}{numericFromInt(1), "a", []interface{}{}, map[string]interface{}{}, []interface{}{numericFromInt(1), "a"}}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := Parse(tc.input)
+			if tc.errMsg == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.errMsg {
+				t.Fatalf("expected error %q, got %v", tc.errMsg, err)
+			}
+			// What's rejected must fail however it's evaluated.
+			p, err := parse(tc.input, ParseOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, doc := range docs {
+				if res, err := NewNaiveEvalerForProgram(p).Run(doc); err == nil {
+					t.Errorf("expected evaluating against %v to fail, got %v", doc, res)
+				}
+			}
+		})
+	}
+}
+
+func TestTypeOfMatchesResults(t *testing.T) {
+	docs := []string{`1`, `"a"`, `[1, "a", [2, 3.5], {"a": [1, 2]}, null, true]`, `{"a": {"b_c": [0, -1]}}`, `[]`, `{}`, `"2017-03-10"`}
+	vars := map[string]interface{}{"x": numericFromInt(2)}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		g := &astGenerator{r: r}
+		p := NewProgram(Mode(r.Intn(2)), g.expr(4))
+		v := newTyper(p.Mode, TypeOptions{}).expr(p.Root)
+		e := NewNaiveEvalerForProgram(p)
+		for _, doc := range docs {
+			var dollar interface{}
+			d := json.NewDecoder(strings.NewReader(doc))
+			d.UseNumber()
+			if err := d.Decode(&dollar); err != nil {
+				t.Fatal(err)
+			}
+			res, err := e.RunWithOptions(dollar, RunOptions{Vars: vars, TimeZone: "UTC"})
+			if err != nil {
+				continue
+			}
+			if len(res) < v.min || len(res) > v.max {
+				t.Fatalf("`%s` returned %d values on %s, expected between %d and %d", FormatNode(p), len(res), doc, v.min, v.max)
+			}
+			for _, val := range res {
+				if k, _ := kindOf(val); v.kinds&(1<<k) == 0 {
+					t.Fatalf("`%s` returned %v on %s, which isn't of type %s", FormatNode(p), val, doc, v.kinds)
+				}
+			}
+		}
+	}
+}
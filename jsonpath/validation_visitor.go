@@ -1,40 +1,254 @@
 package jsonpath
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
+// validationVisitor checks what the grammar can't: that `@` and `last` only
+// appear where they have a value, and the arguments of item methods. It also
+// checks that a tree built by hand is one the parser could have produced.
 type validationVisitor struct {
-	err                error
+	errs               []error
 	filterDepth        int
 	arrayAccessorDepth int
+	funcDepth          int
+
+	// nodes holds, for each of errs, the number of the node it was found
+	// in, counting nodes in the order VisitPost sees them.
+	nodes []int
+	// found holds, for each node whose children are being visited, the
+	// range of errs found in the node itself.
+	found [][2]int
+	// visited counts the calls to VisitPost, and skipped is set if the
+	// children of some node weren't visited, which throws the count off.
+	visited int
+	skipped bool
 }
 
-func (v *validationVisitor) VisitPre(n jsonPathNode) bool {
-	if v.err != nil {
-		return false
+func (v *validationVisitor) errorf(format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+func (v *validationVisitor) VisitPre(n Node) bool {
+	start := len(v.errs)
+	recurse := v.check(n)
+	for range v.errs[start:] {
+		v.nodes = append(v.nodes, -1)
+	}
+	if recurse {
+		v.found = append(v.found, [2]int{start, len(v.errs)})
+	} else {
+		v.skipped = true
 	}
+	return recurse
+}
 
+func (v *validationVisitor) check(n Node) bool {
+	// A tree built by hand might leave out a child, which can't be walked.
+	if field := missingChild(n); field != "" {
+		v.errorf("%s is missing its %s", strings.TrimPrefix(fmt.Sprintf("%T", n), "jsonpath."), field)
+		return false
+	}
 	switch t := n.(type) {
 	case ArrayAccessor:
 		v.arrayAccessorDepth++
+		if len(t.Subscripts) == 0 {
+			v.errorf("an array subscript needs at least one index")
+		}
+	case RecursiveWildcardAccessor:
+		for _, level := range []int{t.First, t.Last} {
+			if level < 0 && level != LastLevel {
+				v.errorf("recursive wildcard level must be a non-negative integer, but found %d", level)
+			}
+		}
+	case DotAccessor:
+		if !t.Quoted && !isIdentifier(t.Name) {
+			v.errorf("member name %q must be quoted", t.Name)
+		}
+	case NumberExpr:
+		// The parser reads -1 as `-` applied to 1.
+		if v.funcDepth == 0 && t.val.sign() < 0 {
+			v.errorf("a number literal can only be negative as an argument of an item method, but found %v", t.val)
+		}
 	case LastExpr:
 		if v.arrayAccessorDepth == 0 {
-			v.err = fmt.Errorf("`last` can only appear inside an array subscript")
+			v.errorf("`last` can only appear inside an array subscript")
 		}
 	case FilterNode:
 		v.filterDepth++
+	case AccessExpr:
+		if err := checkAccess(t.Left); err != nil {
+			v.errs = append(v.errs, err)
+		}
 	case VariableExpr:
-		if t.name == "@" && v.filterDepth == 0 {
-			v.err = fmt.Errorf("@ only allowed within filter expressions")
+		if t.Name == "@" && v.filterDepth == 0 {
+			v.errorf("@ only allowed within filter expressions")
+		} else if t.Name != "@" && (!strings.HasPrefix(t.Name, "$") || !isIdentifier(t.Name)) {
+			v.errorf("invalid variable name %q", t.Name)
+		}
+	case FuncNode:
+		v.funcDepth++
+		if err := checkArgs(t); err != nil {
+			v.errs = append(v.errs, err)
+			return true
+		}
+		// Arguments which failed to parse have been reported already.
+		if t.Func == DatetimeFunction && len(t.Args) > 0 {
+			if tmpl, ok := t.Args[0].(StringExpr); ok {
+				if _, err := compileDatetimeTemplate(tmpl.Value); err != nil {
+					v.errs = append(v.errs, err)
+				}
+			}
+		}
+		if _, ok := datetimeMethodKinds[t.Func]; ok && len(t.Args) > 0 {
+			if precision, ok := t.Args[0].(NumberExpr); ok && !intInRange(precision.val, 0, 6) {
+				v.errorf("precision of .%s() must be between 0 and 6, but was %v", functionNames[t.Func], precision.val)
+			}
+		}
+		if t.Func == DecimalFunction && len(t.Args) > 0 {
+			precision, ok := t.Args[0].(NumberExpr)
+			if ok && !intInRange(precision.val, 1, 1000) {
+				v.errorf("precision of .decimal() must be between 1 and 1000, but was %v", precision.val)
+			} else if len(t.Args) > 1 {
+				if scale, ok := t.Args[1].(NumberExpr); ok && !intInRange(scale.val, -1000, 1000) {
+					v.errorf("scale of .decimal() must be between -1000 and 1000, but was %v", scale.val)
+				}
+			}
 		}
 	}
 	return true
 }
 
-func (v *validationVisitor) VisitPost(n jsonPathNode) {
+func (v *validationVisitor) VisitPost(n Node) {
 	switch n.(type) {
 	case ArrayAccessor:
 		v.arrayAccessorDepth--
 	case FilterNode:
 		v.filterDepth--
+	case FuncNode:
+		v.funcDepth--
+	}
+	found := v.found[len(v.found)-1]
+	v.found = v.found[:len(v.found)-1]
+	for i := found[0]; i < found[1]; i++ {
+		v.nodes[i] = v.visited
+	}
+	v.visited++
+}
+
+// Validate returns the problems with the tree rooted at n which Parse would
+// report, such as `@` outside of a filter, which makes it useful for checking
+// trees built or rewritten by hand. It doesn't report expressions which can
+// only raise an error, which only parsing rejects.
+func Validate(n Node) []error {
+	return validate(n, nil)
+}
+
+// validate is Validate, but if the tree was parsed by t without errors, the
+// problems are reported as syntax errors in the node they were found in.
+func validate(n Node, t *tokenStream) []error {
+	v := &validationVisitor{}
+	n.Walk(v)
+	if t == nil || len(t.diagnostics) > 0 || v.skipped || v.visited != len(t.spans) {
+		return v.errs
+	}
+	for i, err := range v.errs {
+		if node := v.nodes[i]; node >= 0 {
+			v.errs[i] = t.errorAt(err.Error(), t.spans[node])
+		}
+	}
+	return v.errs
+}
+
+// missingChild returns the name of the first child of n which is nil, other
+// than the optional end of a subscript.
+func missingChild(n Node) string {
+	var children []Node
+	var names []string
+	switch t := n.(type) {
+	case Program:
+		children, names = []Node{t.Root}, []string{"Root"}
+	case BinExpr:
+		children, names = []Node{t.Left, t.Right}, []string{"Left", "Right"}
+	case UnaryExpr:
+		children, names = []Node{t.Expr}, []string{"Expr"}
+	case AccessExpr:
+		children, names = []Node{t.Left, t.Right}, []string{"Left", "Right"}
+	case BinPred:
+		children, names = []Node{t.Left, t.Right}, []string{"Left", "Right"}
+	case BinLogic:
+		children, names = []Node{t.Left, t.Right}, []string{"Left", "Right"}
+	case UnaryNot:
+		children, names = []Node{t.Pred}, []string{"Pred"}
+	case ParenExpr:
+		children, names = []Node{t.Expr}, []string{"Expr"}
+	case ParenPred:
+		children, names = []Node{t.Pred}, []string{"Pred"}
+	case FilterNode:
+		children, names = []Node{t.Pred}, []string{"Pred"}
+	case ExistsNode:
+		children, names = []Node{t.Expr}, []string{"Expr"}
+	case LikeRegexNode:
+		children, names = []Node{t.Left}, []string{"Left"}
+	case StartsWithNode:
+		children, names = []Node{t.Left, t.Right}, []string{"Left", "Right"}
+	case IsUnknownNode:
+		children, names = []Node{t.Pred}, []string{"Pred"}
+	case RangeSubscriptNode:
+		children, names = []Node{t.Start}, []string{"Start"}
+	case FuncNode:
+		for i, a := range t.Args {
+			children, names = append(children, a), append(names, fmt.Sprintf("argument %d", i+1))
+		}
+	}
+	for i, c := range children {
+		if c == nil {
+			return names[i]
+		}
 	}
+	return ""
+}
+
+// checkArgs checks that an item method has the literal arguments the
+// grammar would give it, which a tree built or rewritten by hand might not.
+func checkArgs(f FuncNode) error {
+	max, want := 0, "number"
+	if f.Func == DatetimeFunction {
+		max, want = 1, "string"
+	} else if f.Func == DecimalFunction {
+		max = 2
+	} else if kind, ok := datetimeMethodKinds[f.Func]; ok && kind != dateKind {
+		max = 1
+	}
+	if len(f.Args) > max {
+		return fmt.Errorf("too many arguments for .%s(): at most %d, but got %d", f.Func, max, len(f.Args))
+	}
+	for _, a := range f.Args {
+		_, isString := a.(StringExpr)
+		_, isNumber := a.(NumberExpr)
+		// Arguments which failed to parse have been reported already.
+		_, isBad := a.(BadNode)
+		if !isBad && (want == "string" && !isString || want == "number" && !isNumber) {
+			return fmt.Errorf("arguments of .%s() must be %s literals, but found `%s`", f.Func, want, FormatNode(a))
+		}
+	}
+	return nil
+}
+
+// checkAccess checks that e can be followed by an accessor. The grammar
+// doesn't allow one after parentheses, so the result of arithmetic can't be
+// accessed.
+func checkAccess(e Expr) error {
+	switch unparen(e).(type) {
+	case BinExpr, UnaryExpr:
+		return fmt.Errorf("cannot access `%s`, which is not a literal, variable or path", FormatNode(e))
+	}
+	return nil
+}
+
+// intInRange reports whether n is an integer between lo and hi inclusive.
+func intInRange(n numeric, lo, hi int64) bool {
+	i, ok := n.int64()
+	return ok && i >= lo && i <= hi
 }
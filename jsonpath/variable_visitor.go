@@ -0,0 +1,31 @@
+package jsonpath
+
+import "sort"
+
+// variableVisitor collects the names of the named variables (everything but
+// `$` and `@`) referenced by a program.
+type variableVisitor struct {
+	names map[string]struct{}
+}
+
+func (v *variableVisitor) VisitPre(n Node) bool {
+	if t, ok := n.(VariableExpr); ok && t.Name != "$" && t.Name != "@" {
+		v.names[t.Name[1:]] = struct{}{}
+	}
+	return true
+}
+
+func (v *variableVisitor) VisitPost(n Node) {}
+
+// Variables returns the sorted names, without the leading `$`, of the named
+// variables referenced within n.
+func Variables(n Node) []string {
+	v := &variableVisitor{names: make(map[string]struct{})}
+	n.Walk(v)
+	result := make([]string, 0, len(v.names))
+	for name := range v.names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -1,191 +1,217 @@
 package jsonpath
 
-type visitor interface {
-	VisitPre(jsonPathNode) (recurse bool)
-	VisitPost(jsonPathNode)
+// Visitor is called for each node of a tree by Walk, in depth-first order.
+// VisitPre is called before a node's children are visited, and can return
+// false to skip them, along with the call to VisitPost which would follow.
+type Visitor interface {
+	VisitPre(Node) (recurse bool)
+	VisitPost(Node)
 }
 
-func (n Program) Walk(v visitor) {
+type inspector func(Node) bool
+
+func (f inspector) VisitPre(n Node) bool { return f(n) }
+func (f inspector) VisitPost(Node)       {}
+
+// Inspect calls f for each node of the tree rooted at n in depth-first
+// order, skipping the children of nodes for which it returns false.
+func Inspect(n Node, f func(Node) bool) {
+	n.Walk(inspector(f))
+}
+
+func (n Program) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.root.Walk(v)
+		n.Root.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n BinExpr) Walk(v visitor) {
+func (n BinExpr) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.left.Walk(v)
-		n.right.Walk(v)
+		n.Left.Walk(v)
+		n.Right.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n BinPred) Walk(v visitor) {
+func (n BinPred) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.left.Walk(v)
-		n.right.Walk(v)
+		n.Left.Walk(v)
+		n.Right.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n BinLogic) Walk(v visitor) {
+func (n BinLogic) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.left.Walk(v)
-		n.right.Walk(v)
+		n.Left.Walk(v)
+		n.Right.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n UnaryExpr) Walk(v visitor) {
+func (n UnaryExpr) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.expr.Walk(v)
+		n.Expr.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n UnaryNot) Walk(v visitor) {
+func (n UnaryNot) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.expr.Walk(v)
+		n.Pred.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n ParenPred) Walk(v visitor) {
+func (n ParenPred) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.expr.Walk(v)
+		n.Pred.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n ParenExpr) Walk(v visitor) {
+func (n ParenExpr) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.expr.Walk(v)
+		n.Expr.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n NumberExpr) Walk(v visitor) {
+func (n NumberExpr) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
 		v.VisitPost(n)
 	}
 }
 
-func (n VariableExpr) Walk(v visitor) {
+func (n VariableExpr) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
 		v.VisitPost(n)
 	}
 }
 
-func (n LastExpr) Walk(v visitor) {
+func (n LastExpr) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
 		v.VisitPost(n)
 	}
 }
 
-func (n BoolExpr) Walk(v visitor) {
+func (n BoolExpr) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
 		v.VisitPost(n)
 	}
 }
 
-func (n NullExpr) Walk(v visitor) {
+func (n NullExpr) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
 		v.VisitPost(n)
 	}
 }
 
-func (n StringExpr) Walk(v visitor) {
+func (n StringExpr) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
 		v.VisitPost(n)
 	}
 }
 
-func (n AccessExpr) Walk(v visitor) {
+func (n AccessExpr) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.left.Walk(v)
-		n.right.Walk(v)
+		n.Left.Walk(v)
+		n.Right.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n DotAccessor) Walk(v visitor) {
+func (n DotAccessor) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
 		v.VisitPost(n)
 	}
 }
 
-func (n MemberWildcardAccessor) Walk(v visitor) {
+func (n MemberWildcardAccessor) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
 		v.VisitPost(n)
 	}
 }
 
-func (n ArrayAccessor) Walk(v visitor) {
+func (n ArrayAccessor) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		for _, e := range n.subscripts {
+		for _, e := range n.Subscripts {
 			e.Walk(v)
 		}
 		v.VisitPost(n)
 	}
 }
 
-func (n RangeSubscriptNode) Walk(v visitor) {
+func (n RangeSubscriptNode) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.start.Walk(v)
-		if n.end != nil {
-			n.end.Walk(v)
+		n.Start.Walk(v)
+		if n.End != nil {
+			n.End.Walk(v)
 		}
 		v.VisitPost(n)
 	}
 }
 
-func (n WildcardArrayAccessor) Walk(v visitor) {
+func (n WildcardArrayAccessor) Walk(v Visitor) {
+	if rec := v.VisitPre(n); rec {
+		v.VisitPost(n)
+	}
+}
+
+func (n RecursiveWildcardAccessor) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
 		v.VisitPost(n)
 	}
 }
 
-func (n FuncNode) Walk(v visitor) {
+func (n FuncNode) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		if n.arg != nil {
-			n.arg.Walk(v)
+		for _, a := range n.Args {
+			a.Walk(v)
 		}
 		v.VisitPost(n)
 	}
 }
 
-func (n FilterNode) Walk(v visitor) {
+func (n FilterNode) Walk(v Visitor) {
+	if rec := v.VisitPre(n); rec {
+		n.Pred.Walk(v)
+		v.VisitPost(n)
+	}
+}
+
+func (n ExistsNode) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.pred.Walk(v)
+		n.Expr.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n ExistsNode) Walk(v visitor) {
+func (n LikeRegexNode) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.expr.Walk(v)
+		n.Left.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n LikeRegexNode) Walk(v visitor) {
+func (n StartsWithNode) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.left.Walk(v)
+		n.Left.Walk(v)
+		n.Right.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n StartsWithNode) Walk(v visitor) {
+func (n IsUnknownNode) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.left.Walk(v)
-		n.right.Walk(v)
+		n.Pred.Walk(v)
 		v.VisitPost(n)
 	}
 }
 
-func (n IsUnknownNode) Walk(v visitor) {
+func (n BadNode) Walk(v Visitor) {
 	if rec := v.VisitPre(n); rec {
-		n.expr.Walk(v)
 		v.VisitPost(n)
 	}
 }
@@ -6,24 +6,43 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/justinj/jsonpath/jsonpath"
 )
 
 func main() {
+	varsFlag := flag.String("vars", "", "JSON object binding the named variables used in the path")
+	tzFlag := flag.String("tz", "", "time zone used to convert between datetimes with and without a time zone")
+	optimizedFlag := flag.Bool("optimized", false, "print the path as it will be evaluated, after optimization, and exit")
 	flag.Parse()
 	program := flag.Args()
+	if *optimizedFlag {
+		p, err := jsonpath.Parse(program[0])
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(jsonpath.FormatNode(jsonpath.Optimize(p)))
+		return
+	}
 	machine, err := jsonpath.NewNaiveEvaler(program[0])
 	if err != nil {
 		panic(err)
 	}
 
+	var vars map[string]interface{}
+	if *varsFlag != "" {
+		if err := decode(*varsFlag, &vars); err != nil {
+			panic(err)
+		}
+	}
+
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
 		line := scanner.Text()
 		var obj interface{}
-		json.Unmarshal([]byte(line), &obj)
-		result, err := machine.Run(obj)
+		decode(line, &obj)
+		result, err := machine.RunWithOptions(obj, jsonpath.RunOptions{Vars: vars, TimeZone: *tzFlag})
 		if err != nil {
 			panic(err)
 		}
@@ -38,3 +57,11 @@ func main() {
 	}
 
 }
+
+// decode parses JSON keeping numbers as json.Number, so that they are
+// evaluated exactly.
+func decode(s string, v interface{}) error {
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	return d.Decode(v)
+}